@@ -5,6 +5,7 @@ import (
 	//"encoding/json"
 	"github.com/ginuerzh/sports/errors"
 	"github.com/ginuerzh/sports/models"
+	"github.com/ginuerzh/sports/oauth"
 	"github.com/martini-contrib/binding"
 	"gopkg.in/go-martini/martini.v1"
 	//"io/ioutil"
@@ -30,6 +31,65 @@ func BindAccountApi(m *martini.ClassicMartini) {
 		binding.Json(loginForm{}),
 		ErrorHandler,
 		loginHandler)
+	m.Get("/1/user/accounts",
+		binding.Form(identitiesForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		identitiesHandler)
+	m.Post("/1/user/link",
+		binding.Json(linkForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		linkHandler)
+	m.Post("/1/user/unlink",
+		binding.Json(unlinkForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		loadUserHandler,
+		unlinkHandler)
+	m.Post("/1/account/upgrade",
+		binding.Json(upgradeForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		loadUserHandler,
+		upgradeHandler)
+	m.Post("/1/account/refreshToken",
+		binding.Json(refreshTokenForm{}),
+		ErrorHandler,
+		refreshTokenHandler)
+	m.Get("/1/user/sessions",
+		binding.Form(sessionsForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		sessionsHandler)
+	m.Post("/1/user/sessions/revoke",
+		binding.Json(revokeSessionForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		revokeSessionHandler)
+	m.Post("/1/account/sendVerifyCode",
+		binding.Json(sendCodeForm{}),
+		ErrorHandler,
+		sendCodeHandler)
+	m.Post("/1/account/forgotPassword",
+		binding.Json(forgotPasswordForm{}),
+		ErrorHandler,
+		forgotPasswordHandler)
+	m.Post("/1/account/resetPassword",
+		binding.Json(resetPasswordForm{}),
+		ErrorHandler,
+		resetPasswordHandler)
+	m.Post("/1/user/changePassword",
+		binding.Json(changePasswordForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		loadUserHandler,
+		changePasswordHandler)
+	m.Post("/1/user/bindPhone",
+		binding.Json(bindPhoneForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		bindPhoneHandler)
 	m.Get("/1/user/getDailyLoginRewardInfo",
 		binding.Form(loginAwardsForm{}, (*Parameter)(nil)),
 		ErrorHandler,
@@ -46,6 +106,11 @@ func BindAccountApi(m *martini.ClassicMartini) {
 		checkTokenHandler,
 		loadUserHandler,
 		recommendHandler)
+	m.Post("/1/user/recommend/dismiss",
+		binding.Json(dismissRecommendForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		dismissRecommendHandler)
 	m.Get("/1/user/getInfo",
 		binding.Form(getInfoForm{}, (*Parameter)(nil)),
 		ErrorHandler,
@@ -114,6 +179,7 @@ type userRegForm struct {
 	Email    string `json:"email" binding:"required"`
 	Nickname string `json:"nikename"`
 	Password string `json:"password" binding:"required"`
+	Code     string `json:"verifycode"`
 	//Role     string `json:"role"`
 }
 
@@ -148,8 +214,18 @@ func registerHandler(request *http.Request, resp http.ResponseWriter, redis *mod
 		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.UserExistError))
 		return
 	}
+	// the phone must be verified
+	if t == "phone" && !redis.CheckVerifyCode(VerifyRegister, user.Phone, form.Code) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.VerifyCodeError))
+		return
+	}
 	user.Nickname = form.Nickname
-	user.Password = Md5(form.Password)
+	password, err := models.HashPassword(form.Password)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	user.Password = password
 	user.Role = "usrpass"
 	user.RegTime = time.Now()
 	//user.LastAccess = time.Now()
@@ -191,6 +267,7 @@ type loginForm struct {
 	Userid   string `json:"userid"`
 	Password string `json:"verfiycode"`
 	Type     string `json:"account_type"`
+	Device   string `json:"device"`
 }
 
 /*
@@ -198,66 +275,6 @@ func (this loginForm) getUserId() string {
 	return this.Userid
 }
 */
-func weiboLogin(uid, password string, redis *models.RedisLogger) (bool, *models.Account, error) {
-	user := &models.Account{Weibo: strings.ToLower(uid)}
-	exists, err := user.Exists("weibo")
-	if err != nil {
-		return false, nil, err
-	}
-
-	p := Md5(password)
-	registered := user.RegTime.Unix() > 0
-
-	if registered {
-		if user.Password != p {
-			user.ChangePassword(p)
-		}
-		return false, user, nil
-	}
-	weiboUser, err := GetWeiboUserInfo(uid, password)
-	if err != nil {
-		return false, nil, err
-	}
-
-	user.Nickname = weiboUser.ScreenName
-	user.Password = p
-	user.Gender = weiboUser.Gender
-	user.Url = weiboUser.Url
-	user.Profile = weiboUser.Avatar
-	user.Addr = &models.Address{Desc: weiboUser.Location}
-	user.About = weiboUser.Description
-	user.Role = "weibo"
-	user.RegTime = time.Now()
-
-	dbw, err := getNewWallet()
-	if err != nil {
-		return true, nil, err
-	}
-	user.Wallet = *dbw
-
-	if !exists {
-		if err := user.Save(); err != nil {
-			return true, nil, err
-		}
-	} else {
-		if err := user.Update(); err != nil {
-			return true, nil, err
-		}
-	}
-	redis.LogRegister(user.Id)
-
-	// ws push
-	regNotice(user.Id, redis)
-
-	return true, user, nil
-}
-func guestLogin(redis *models.RedisLogger) (*models.Account, error) {
-	user := &models.Account{}
-	user.Id = models.GuestUserPrefix + strconv.Itoa(time.Now().Nanosecond()) + ":" + strconv.Itoa(random.Intn(65536))
-
-	return user, nil
-}
-
 var ran = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 func loginAwards(days, level int) Awards {
@@ -292,24 +309,28 @@ func loginHandler(request *http.Request, resp http.ResponseWriter, redis *models
 	user := &models.Account{}
 	var err error
 	var reg bool
-	token := Uuid()
 
 	switch form.Type {
-	case "weibo":
-		reg, user, err = weiboLogin(form.Userid, form.Password, redis)
-	case "weixin":
-		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.UnimplementedError))
-		return
+	case "weibo", "weixin", "qq":
+		reg, user, err = oauthLogin(form.Type, form.Userid, form.Password, redis)
+	case "phone":
+		reg, user, err = phoneLogin(form.Userid, form.Password, redis)
+	case "guest":
+		reg, user, err = guestLogin(ClientIp(request), redis)
 	case "usrpass":
 		fallthrough
 	default:
 		var find bool
-		if find, err = user.FindByUserPass(strings.ToLower(form.Userid), Md5(form.Password)); !find {
+		if find, err = user.FindByUserPass(strings.ToLower(form.Userid), form.Password); !find {
 			if err == nil {
 				err = errors.NewError(errors.AuthError)
 			}
 		}
 	}
+	// the expired password must be reset before any kind of login
+	if err == nil && user.PasswordExpired {
+		err = errors.NewError(errors.PasswordExpiredError)
+	}
 
 	if err != nil {
 		writeResponse(request.RequestURI, resp, nil, err)
@@ -322,7 +343,7 @@ func loginHandler(request *http.Request, resp http.ResponseWriter, redis *models
 	}
 
 	//user.UpdateAction(ActLogin, d)
-	redis.SetOnlineUser(token, user.Id)
+	session := redis.NewSession(user.Id, form.Device, ClientIp(request))
 	redis.LogLogin(user.Id)
 
 	awards := Awards{}
@@ -346,7 +367,10 @@ func loginHandler(request *http.Request, resp http.ResponseWriter, redis *models
 	}
 
 	data := map[string]interface{}{
-		"access_token":    token,
+		"access_token":    session.AccessToken,
+		"refresh_token":   session.RefreshToken,
+		"expires_in":      models.AccessTokenExpire,
+		"session_id":      session.Id,
 		"userid":          user.Id,
 		"register":        reg,
 		"last_login_time": user.LastLogin.Unix(),
@@ -375,19 +399,93 @@ func recommendHandler(r *http.Request, w http.ResponseWriter,
 	redis *models.RedisLogger, user *models.Account, p Parameter) {
 
 	form := p.(recommendForm)
+	if form.Paging.Count == 0 {
+		form.Paging.Count = models.DefaultPageSize
+	}
 
-	users, _ := user.Recommend(redis.Friends(models.RelFollowing, user.Id))
-	var list []*leaderboardResp
-	for i, _ := range users {
-		if users[i].Id == user.Id {
-			continue
+	firstPage := len(form.Paging.Last) == 0
+
+	ids, reasons, computed := redis.Recommends(user.Id)
+	if !computed {
+		ids, reasons = recommendUsers(redis, user)
+		redis.SetRecommends(user.Id, ids, reasons)
+	}
+	if reasons == nil {
+		reasons = make(map[string]string)
+	}
+
+	// the recommendations after the last one of the previous page, the previous page is the last
+	// if it ends with the fallback users, which are not in the recommendations.
+	if !firstPage {
+		found := false
+		for i, id := range ids {
+			if id == form.Paging.Last {
+				ids = ids[i+1:]
+				found = true
+				break
+			}
+		}
+		if !found {
+			ids = nil
 		}
+	}
 
-		rel := redis.Relationship(user.Id, users[i].Id)
+	var page []string
+	for _, id := range ids {
+		rel := redis.Relationship(user.Id, id)
 		if rel == models.RelFollowing || rel == models.RelFriend {
 			continue
 		}
+		if page = append(page, id); len(page) >= form.Paging.Count {
+			break
+		}
+	}
+
+	var users []models.Account
+	if len(page) > 0 {
+		found, _ := models.FindUsers(page)
+		for _, id := range page {
+			for i, _ := range found {
+				if found[i].Id == id {
+					users = append(users, found[i])
+					break
+				}
+			}
+		}
+	}
+
+	form.Paging.First = ""
+	form.Paging.Last = ""
+	if len(page) > 0 {
+		form.Paging.First = page[0]
+		form.Paging.Last = page[len(page)-1]
+	}
+
+	// not enough recommendations for the new users
+	if len(page) < form.Paging.Count && firstPage {
+		excludes := append(redis.Friends(models.RelFollowing, user.Id), user.Id)
+		excludes = append(excludes, redis.Friends(models.RelBlacklist, user.Id)...)
+		excludes = append(excludes, redis.Dismissed(user.Id)...)
+		more, _ := user.Recommend(excludes)
+		for i, _ := range more {
+			if len(users) >= form.Paging.Count {
+				break
+			}
+			if containsString(excludes, more[i].Id) || more[i].IsGuest() {
+				continue
+			}
+			excludes = append(excludes, more[i].Id)
+			reasons[more[i].Id] = "为你推荐"
+			users = append(users, more[i])
+		}
+		if len(users) > 0 {
+			form.Paging.First = users[0].Id
+			form.Paging.Last = users[len(users)-1].Id
+		}
+	}
 
+	var list []*leaderboardResp
+	for i, _ := range users {
 		lb := &leaderboardResp{
 			Userid:   users[i].Id,
 			Score:    users[i].Props.Score,
@@ -397,11 +495,16 @@ func recommendHandler(r *http.Request, w http.ResponseWriter,
 			Gender:   users[i].Gender,
 			LastLog:  users[i].LastLogin.Unix(),
 			Birth:    users[i].Birth,
-			Location: users[i].Loc,
-			Addr:     users[i].LocAddr,
+			Reason:   reasons[users[i].Id],
+		}
+		rel := relationTo(redis, users[i].Id, user.Id)
+		lb.Location, lb.Addr = users[i].VisibleLoc(rel)
+		if models.Visible(users[i].Privacy.Records, rel) {
+			lb.Distance, _ = redis.RecStats(users[i].Id)
+		}
+		if latest := users[i].LatestArticle(); canViewArticle(redis, latest, &users[i], user.Id) {
+			lb.Status, _ = latest.Cover()
 		}
-		lb.Distance, _ = redis.RecStats(users[i].Id)
-		lb.Status, _ = users[i].LatestArticle().Cover()
 		list = append(list, lb)
 	}
 
@@ -413,6 +516,20 @@ func recommendHandler(r *http.Request, w http.ResponseWriter,
 	writeResponse(r.RequestURI, w, respData, nil)
 }
 
+type dismissRecommendForm struct {
+	Userid string `json:"userid" binding:"required"`
+	parameter
+}
+
+// the dismissed user is not recommended again
+func dismissRecommendHandler(r *http.Request, w http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(dismissRecommendForm)
+	redis.DismissRecommend(user.Id, form.Userid)
+	writeResponse(r.RequestURI, w, nil, nil)
+}
+
 type getInfoForm struct {
 	Userid string `form:"userid" binding:"required"`
 	parameter
@@ -466,6 +583,12 @@ func userInfoHandler(request *http.Request, resp http.ResponseWriter, redis *mod
 		return
 	}
 
+	rel := relationTo(redis, user.Id, redis.OnlineUser(form.Token))
+	if rel == models.RelBlacklist {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError, "无权查看该用户"))
+		return
+	}
+
 	info := &userJsonStruct{
 		Userid:   user.Id,
 		Nickname: user.Nickname,
@@ -480,7 +603,6 @@ func userInfoHandler(request *http.Request, resp http.ResponseWriter, redis *mod
 		Weight:   user.Weight,
 		Birth:    user.Birth,
 		Actor:    userActor(user.Actor),
-		Location: user.Loc,
 
 		//Rank:   userRank(user.Level),
 		Online: redis.IsOnline(user.Id),
@@ -505,6 +627,7 @@ func userInfoHandler(request *http.Request, resp http.ResponseWriter, redis *mod
 		LastLog: user.LastLogin.Unix(),
 	}
 
+	info.Location, _ = user.VisibleLoc(rel)
 	info.Follows, info.Followers, _, _ = redis.FriendCount(user.Id)
 
 	if user.Addr != nil {
@@ -526,6 +649,25 @@ func userInfoHandler(request *http.Request, resp http.ResponseWriter, redis *mod
 			info.Relation = "FANS"
 		case models.RelBlacklist:
 			info.Relation = "DEFRIEND"
+		case models.RelNone:
+			if redis.FollowRequested(uid, user.Id) {
+				info.Relation = "REQUESTED"
+			}
+		}
+	}
+
+	// the contacts are for the owner only, and the others see the basic info only if the profile is not visible
+	if rel != models.RelSelf {
+		info.Email = ""
+		info.Phone = ""
+	}
+	if !models.Visible(user.Privacy.Profile, rel) {
+		info = &userJsonStruct{
+			Userid:   info.Userid,
+			Nickname: info.Nickname,
+			Profile:  info.Profile,
+			Gender:   info.Gender,
+			Relation: info.Relation,
 		}
 	}
 
@@ -564,7 +706,6 @@ func setInfoHandler(request *http.Request, resp http.ResponseWriter,
 	user.Birth = form.UserInfo.Birth
 	user.Actor = form.UserInfo.Actor
 	user.Gender = form.UserInfo.Gender
-	user.Phone = form.UserInfo.Phone
 	user.About = form.UserInfo.About
 
 	addr := &models.Address{
@@ -580,6 +721,9 @@ func setInfoHandler(request *http.Request, resp http.ResponseWriter,
 	//setinfo := user.Setinfo
 	user.Setinfo = true
 	err := user.Update()
+	if err == nil {
+		user.LocateAddr()
+	}
 
 	score := 0
 	/*
@@ -732,15 +876,19 @@ type searchForm struct {
 }
 
 func searchHandler(r *http.Request, w http.ResponseWriter,
-	user *models.Account, form searchForm) {
-	users := []models.Account{}
+	redis *models.RedisLogger, user *models.Account, form searchForm) {
+	users := []models.Neighbor{}
 	var err error
 
 	if form.Nearby > 0 {
 		form.Paging.Count = 50
 		users, err = user.SearchNear(&form.Paging, 50000)
 	} else {
-		users, err = models.Search(form.Nickname, &form.Paging)
+		var list []models.Account
+		list, err = models.Search(form.Nickname, &form.Paging)
+		for i, _ := range list {
+			users = append(users, models.Neighbor{Account: list[i]})
+		}
 	}
 
 	var list []*leaderboardResp
@@ -757,7 +905,12 @@ func searchHandler(r *http.Request, w http.ResponseWriter,
 			Gender:   users[i].Gender,
 			LastLog:  users[i].LastLogin.Unix(),
 			Birth:    users[i].Birth,
-			Location: users[i].Loc,
+		}
+		lb.Location, lb.Addr = users[i].VisibleLoc(relationTo(redis, users[i].Id, user.Id))
+		if form.Nearby > 0 {
+			// the exact distance would reveal the location by trilateration, the one to the fuzzed location is shown
+			lb.Nearby = int(users[i].FuzzDistance/100+0.5) * 100
+			lb.NearbyRange = models.DistanceBucket(users[i].Distance)
 		}
 		list = append(list, lb)
 	}
@@ -774,7 +927,7 @@ type importFriendsForm struct {
 	Type     string `json:"account_type"`
 	Uid      string `json:"userid" binding:"required"`
 	AppKey   string `json:"appkey"`
-	AppToken string `json:"verfiycode" binding:"required"`
+	AppToken string `json:"verfiycode"`
 	parameter
 }
 
@@ -786,36 +939,73 @@ func importFriendsHandler(r *http.Request, w http.ResponseWriter,
 	redis *models.RedisLogger, user *models.Account, p Parameter) {
 	form := p.(importFriendsForm)
 
-	switch form.Type {
-	case "weibo":
-		log.Println("get weibo friends")
-		friends, err := GetWeiboFriends(form.AppKey, form.Uid, form.AppToken)
-		if err != nil {
-			writeResponse(r.RequestURI, w, nil, errors.NewError(errors.DbError, err.Error()))
-			return
+	provider, err := oauth.Get(form.Type)
+	if err != nil {
+		writeResponse(r.RequestURI, w, nil, errors.NewError(errors.UnimplementedError))
+		return
+	}
+	token := form.AppToken
+	if len(token) == 0 {
+		// the token saved at the last login
+		identity := &models.Identity{}
+		if find, _ := identity.FindByUser(form.Type, user.Id); find {
+			token = identity.Token
 		}
-		log.Println("import weibo friends", len(friends))
-		for _, friend := range friends {
-			//log.Println(friend.Id, friend.ScreenName)
-			u := &models.Account{
-				Id:       strconv.FormatInt(int64(friend.Id), 10),
-				Nickname: friend.ScreenName,
-				Profile:  friend.Avatar,
-				Role:     "weibo",
-				Gender:   friend.Gender,
-				Addr:     &models.Address{Desc: friend.Location},
-			}
-			if find, _ := u.Exists(""); find {
-				if u.RegTime.Unix() > 0 { // registered users only
-					redis.ImportFriend(user.Id, u.Id)
-				}
+	}
+	friends, err := provider.Friends(form.Uid, token)
+	if err != nil {
+		if err == oauth.ErrUnsupported {
+			err = errors.NewError(errors.UnimplementedError)
+		} else {
+			err = errors.NewError(errors.HttpError, err.Error())
+		}
+		writeResponse(r.RequestURI, w, nil, err)
+		return
+	}
+	log.Println("import", form.Type, "friends", len(friends))
+
+	for i, _ := range friends {
+		friend := &friends[i]
+		identity := &models.Identity{}
+		if find, _ := identity.FindByUid(form.Type, friend.Uid); find {
+			u := &models.Account{}
+			if find, _ := u.FindByUserid(identity.Userid); !find {
 				continue
 			}
-			if err := u.Save(); err == nil {
+			if u.RegTime.Unix() > 0 { // registered users only
+				if redis.Relationship(u.Id, user.Id) == models.RelBlacklist {
+					continue
+				}
+				// following the private accounts needs the approval
+				if u.Privacy.Private {
+					if redis.AddFollowRequest(user.Id, u.Id) {
+						followNotice(redis, models.EventFollowRequest, user, u.Id)
+					}
+					continue
+				}
+				redis.ImportFriend(user.Id, u.Id)
+			} else if form.Type == "weibo" {
 				redis.SetWBImport(user.Id, u.Id)
 			}
+			continue
+		}
+
+		// keep the unregistered friend, it's registered when the friend logins
+		u := &models.Account{Role: form.Type}
+		setOAuthProfile(u, friend)
+		if err := u.Save(); err != nil {
+			continue
+		}
+		identity.Provider = form.Type
+		identity.Uid = friend.Uid
+		identity.Userid = u.Id
+		if err := identity.Save(); err != nil {
+			log.Println(err)
+			continue
+		}
+		if form.Type == "weibo" {
+			redis.SetWBImport(user.Id, u.Id)
 		}
-	default:
 	}
 	writeResponse(r.RequestURI, w, map[string]interface{}{"ExpEffect": Awards{}}, nil)
 }
@@ -830,9 +1020,20 @@ type userArticlesForm struct {
 func userArticlesHandler(request *http.Request, resp http.ResponseWriter,
 	redis *models.RedisLogger, form userArticlesForm) {
 
-	//user := &models.User{Id: form.Id}
-	user := &models.Account{Id: form.Id}
-	_, articles, err := user.Articles(form.Type, &form.Paging)
+	user := &models.Account{}
+	if find, err := user.FindByUserid(form.Id); !find {
+		if err == nil {
+			err = errors.NewError(errors.NotExistsError)
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	rel := relationTo(redis, user.Id, redis.OnlineUser(form.Token))
+	if !models.Visible(user.Privacy.Articles, rel) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError, "无权查看该用户的文章"))
+		return
+	}
+	_, articles, err := user.Articles(form.Type, models.HiddenVisibilities(rel), &form.Paging)
 
 	jsonStructs := make([]*articleJsonStruct, len(articles))
 	for i, _ := range articles {
@@ -0,0 +1,487 @@
+// activity
+package controllers
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/models"
+	"github.com/martini-contrib/binding"
+	"gopkg.in/go-martini/martini.v1"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	ActivityNearby = 50000 // search the activities within 50km by default
+)
+
+func BindActivityApi(m *martini.ClassicMartini) {
+	m.Post("/1/activity/new",
+		binding.Json(newActivityForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		loadUserHandler,
+		checkLimitHandler,
+		checkGuestHandler,
+		newActivityHandler)
+	m.Get("/1/activity/info",
+		binding.Form(activityInfoForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		activityInfoHandler)
+	m.Get("/1/activity/nearby",
+		binding.Form(nearbyActivitiesForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		loadUserHandler,
+		nearbyActivitiesHandler)
+	m.Get("/1/activity/group",
+		binding.Form(groupActivitiesForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		groupActivitiesHandler)
+	m.Post("/1/activity/join",
+		binding.Json(joinActivityForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		joinActivityHandler)
+	m.Post("/1/activity/cancel",
+		binding.Json(activityForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		cancelActivityHandler)
+	m.Post("/1/activity/checkin",
+		binding.Json(checkinForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		checkinHandler)
+	m.Post("/1/activity/result",
+		binding.Json(activityResultForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		activityResultHandler)
+	m.Get("/1/activity/results",
+		binding.Form(activityInfoForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		activityResultsHandler)
+}
+
+type activityJsonStruct struct {
+	Id        string          `json:"activity_id"`
+	Creator   string          `json:"creator_id"`
+	Gid       string          `json:"group_id,omitempty"`
+	Title     string          `json:"title"`
+	Desc      string          `json:"desc"`
+	Addr      *models.Address `json:"addr,omitempty"`
+	Loc       models.Location `json:"loc"`
+	Radius    int             `json:"radius"`
+	Capacity  int             `json:"capacity"`
+	Start     int64           `json:"start_time"`
+	End       int64           `json:"end_time"`
+	Going     int             `json:"going_count"`
+	Waitlist  int             `json:"waitlist_count"`
+	Checkins  int             `json:"checkin_count"`
+	Cancelled bool            `json:"cancelled"`
+	Status    string          `json:"status"`                 // the status of the current user
+	Code      string          `json:"checkin_code,omitempty"` // for the creator only
+}
+
+func convertActivity(activity *models.Activity, userid string) *activityJsonStruct {
+	info := &activityJsonStruct{
+		Id:        activity.Id.Hex(),
+		Creator:   activity.Creator,
+		Gid:       activity.Gid,
+		Title:     activity.Title,
+		Desc:      activity.Desc,
+		Addr:      activity.Addr,
+		Loc:       activity.Loc,
+		Radius:    activity.Radius,
+		Capacity:  activity.Capacity,
+		Start:     activity.Start.Unix(),
+		End:       activity.End.Unix(),
+		Going:     len(activity.Going),
+		Waitlist:  len(activity.Waitlist),
+		Checkins:  len(activity.Checkins),
+		Cancelled: activity.Cancelled,
+		Status:    activity.Status(userid),
+	}
+	if activity.Creator == userid {
+		info.Code = activity.Code
+	}
+	return info
+}
+
+func loadActivity(id string) (*models.Activity, error) {
+	activity := &models.Activity{}
+	if find, err := activity.FindById(id); !find {
+		if err == nil {
+			err = errors.NewError(errors.NotFoundError, "活动不存在")
+		}
+		return nil, err
+	}
+	return activity, nil
+}
+
+// notify the user of the activity
+func activityNotice(redis *models.RedisLogger, activity *models.Activity, to, status string) {
+	event := &models.Event{
+		Type: models.EventMsg,
+		Time: time.Now().Unix(),
+		Data: models.EventData{
+			Type: models.EventActivity,
+			Id:   activity.Id.Hex(),
+			From: activity.Creator,
+			To:   to,
+			Body: []models.MsgBody{
+				{Type: "status", Content: status},
+				{Type: "title", Content: activity.Title},
+			},
+		},
+	}
+	redis.PubMsg(models.EventMsg, to, event.Bytes())
+	if err := event.Save(); err == nil {
+		redis.IncrEventCount(to, event.Data.Type, 1)
+	}
+}
+
+type newActivityForm struct {
+	Gid      string `json:"group_id"`
+	Title    string `json:"title" binding:"required"`
+	Desc     string `json:"desc"`
+	Start    int64  `json:"start_time" binding:"required"`
+	End      int64  `json:"end_time" binding:"required"`
+	Capacity int    `json:"capacity"`
+	Radius   int    `json:"radius"`
+	models.Address
+	models.Location
+	parameter
+}
+
+func newActivityHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(newActivityForm)
+
+	if form.End <= form.Start || form.End <= time.Now().Unix() || form.Capacity < 0 {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.JsonError, "无效的活动参数"))
+		return
+	}
+	if len(form.Gid) > 0 {
+		if _, err := loadGroup(form.Gid, user.Id, true); err != nil {
+			writeResponse(request.RequestURI, resp, nil, err)
+			return
+		}
+	}
+
+	activity := &models.Activity{
+		Creator:  user.Id,
+		Gid:      form.Gid,
+		Title:    form.Title,
+		Desc:     form.Desc,
+		Loc:      form.Location,
+		Radius:   form.Radius,
+		Capacity: form.Capacity,
+		Start:    time.Unix(form.Start, 0),
+		End:      time.Unix(form.End, 0),
+		Code:     Uuid(),
+	}
+	if form.Address.String() != "" {
+		activity.Addr = &form.Address
+		if activity.Loc.Lat == 0 && activity.Loc.Lng == 0 {
+			activity.Loc = models.Addr2Loc(form.Address)
+		}
+	}
+	if activity.Loc.Lat == 0 && activity.Loc.Lng == 0 {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.InvalidAddrError))
+		return
+	}
+
+	if err := activity.Save(); err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	activity.Join(user.Id)
+
+	writeResponse(request.RequestURI, resp, convertActivity(activity, user.Id), nil)
+}
+
+type activityInfoForm struct {
+	Id string `form:"activity_id" binding:"required"`
+	parameter
+}
+
+func activityInfoHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(activityInfoForm)
+
+	activity, err := loadActivity(form.Id)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	writeResponse(request.RequestURI, resp, convertActivity(activity, user.Id), nil)
+}
+
+type nearbyActivitiesForm struct {
+	Lat      float64 `form:"latitude"`
+	Lng      float64 `form:"longitude"`
+	Distance int     `form:"distance"` // in meters
+	models.Paging
+	parameter
+}
+
+// the upcoming activities near the location, or near the user if the location is not set.
+func nearbyActivitiesHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(nearbyActivitiesForm)
+
+	loc := models.Location{Lat: form.Lat, Lng: form.Lng}
+	if loc.Lat == 0 && loc.Lng == 0 {
+		loc = user.Loc
+	}
+	if loc.Lat == 0 && loc.Lng == 0 {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.InvalidAddrError))
+		return
+	}
+	if form.Distance <= 0 {
+		form.Distance = ActivityNearby
+	}
+
+	activities, err := models.NearbyActivities(loc, form.Distance, &form.Paging)
+	list := make([]*activityJsonStruct, len(activities))
+	for i, _ := range activities {
+		list[i] = convertActivity(&activities[i], user.Id)
+	}
+	respData := map[string]interface{}{
+		"activities":    list,
+		"page_frist_id": form.Paging.First,
+		"page_last_id":  form.Paging.Last,
+	}
+	writeResponse(request.RequestURI, resp, respData, err)
+}
+
+type groupActivitiesForm struct {
+	Gid string `form:"group_id" binding:"required"`
+	parameter
+}
+
+func groupActivitiesHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(groupActivitiesForm)
+
+	activities, err := models.GroupActivities(form.Gid)
+	list := make([]*activityJsonStruct, len(activities))
+	for i, _ := range activities {
+		list[i] = convertActivity(&activities[i], user.Id)
+	}
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"activities": list}, err)
+}
+
+type joinActivityForm struct {
+	Id    string `json:"activity_id" binding:"required"`
+	Leave bool   `json:"leave"`
+	parameter
+}
+
+// sign up or leave the activity, the users moved from the waitlist are notified.
+func joinActivityHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(joinActivityForm)
+
+	activity, err := loadActivity(form.Id)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	if form.Leave {
+		promoted, err := activity.Leave(user.Id)
+		for _, userid := range promoted {
+			activityNotice(redis, activity, userid, "going")
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	if activity.Cancelled || activity.End.Before(time.Now()) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError, "活动已结束"))
+		return
+	}
+	status, err := activity.Join(user.Id)
+	writeResponse(request.RequestURI, resp, map[string]string{"status": status}, err)
+}
+
+type activityForm struct {
+	Id string `json:"activity_id" binding:"required"`
+	parameter
+}
+
+func cancelActivityHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(activityForm)
+
+	activity, err := loadActivity(form.Id)
+	if err == nil && activity.Creator != user.Id {
+		err = errors.NewError(errors.AccessError)
+	}
+	if err == nil {
+		err = activity.Cancel()
+	}
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	for _, userid := range append(activity.Going, activity.Waitlist...) {
+		if userid != user.Id {
+			activityNotice(redis, activity, userid, "cancelled")
+		}
+	}
+	writeResponse(request.RequestURI, resp, nil, nil)
+}
+
+type checkinForm struct {
+	Id   string `json:"activity_id" binding:"required"`
+	Code string `json:"checkin_code"` // scanned from the qrcode
+	models.Location
+	parameter
+}
+
+// check in by the code of the qrcode, or by the location within the geofence of the activity.
+func checkinHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(checkinForm)
+
+	activity, err := loadActivity(form.Id)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	if activity.Status(user.Id) != "going" && activity.Status(user.Id) != "checkedin" {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError, "未报名活动"))
+		return
+	}
+	now := time.Now()
+	if activity.Cancelled || now.Before(activity.Start.Add(-models.ActivityCheckinEarly*time.Second)) ||
+		now.After(activity.End) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError, "不在签到时间内"))
+		return
+	}
+
+	method := ""
+	if len(form.Code) > 0 {
+		if form.Code != activity.Code {
+			writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.InviteCodeError, "签到码无效"))
+			return
+		}
+		method = "qrcode"
+	} else {
+		if (form.Lat == 0 && form.Lng == 0) ||
+			models.Distance(form.Location, activity.Loc) > float64(activity.Radius) {
+			writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.InvalidAddrError, "不在签到范围内"))
+			return
+		}
+		method = "geofence"
+	}
+
+	err = activity.Checkin(user.Id, method)
+	writeResponse(request.RequestURI, resp, map[string]string{"status": "checkedin"}, err)
+}
+
+type activityResultForm struct {
+	Id     string `json:"activity_id" binding:"required"`
+	Record string `json:"record_id" binding:"required"`
+	parameter
+}
+
+// attach the record during the activity as the result, the user must be checked in.
+func activityResultHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(activityResultForm)
+
+	activity, err := loadActivity(form.Id)
+	if err == nil && activity.Status(user.Id) != "checkedin" {
+		err = errors.NewError(errors.AccessError, "未签到")
+	}
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	record := &models.Record{}
+	if find, err := record.FindById(form.Record); !find || record.Uid != user.Id || record.Sport == nil {
+		if err == nil {
+			err = errors.NewError(errors.NotFoundError, "记录不存在")
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	if record.Time.Before(activity.Start) || record.Time.After(activity.End) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError, "不是活动期间的记录"))
+		return
+	}
+
+	err = activity.SetResult(record)
+	writeResponse(request.RequestURI, resp, nil, err)
+}
+
+type activityResultJsonStruct struct {
+	models.ActivityResult
+	Nickname string `json:"nikename"`
+	Profile  string `json:"user_profile_image"`
+	Rank     int    `json:"index"`
+}
+
+type activityResults []models.ActivityResult
+
+func (r activityResults) Len() int      { return len(r) }
+func (r activityResults) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+
+// the longer distance first, then the shorter duration
+func (r activityResults) Less(i, j int) bool {
+	if r[i].Distance != r[j].Distance {
+		return r[i].Distance > r[j].Distance
+	}
+	return r[i].Duration < r[j].Duration
+}
+
+func activityResultsHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(activityInfoForm)
+
+	activity, err := loadActivity(form.Id)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	sort.Sort(activityResults(activity.Results))
+	ids := make([]string, len(activity.Results))
+	for i, r := range activity.Results {
+		ids[i] = r.Userid
+	}
+	users, _ := models.FindUsers(ids)
+
+	list := make([]activityResultJsonStruct, len(activity.Results))
+	for i, r := range activity.Results {
+		list[i].ActivityResult = r
+		list[i].Rank = i + 1
+		for j, _ := range users {
+			if users[j].Id == r.Userid {
+				list[i].Nickname = users[j].Nickname
+				list[i].Profile = users[j].Profile
+				break
+			}
+		}
+	}
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"results": list}, nil)
+}
@@ -2,13 +2,11 @@
 package admin
 
 import (
-	"crypto/md5"
 	"encoding/json"
-	"fmt"
+	"github.com/ginuerzh/sports/controllers"
 	"github.com/ginuerzh/sports/errors"
 	"github.com/ginuerzh/sports/models"
 	"github.com/martini-contrib/binding"
-	"github.com/nu7hatch/gouuid"
 	"gopkg.in/go-martini/martini.v1"
 	"io"
 	"labix.org/v2/mgo/bson"
@@ -23,6 +21,9 @@ import (
 
 var defaultCount = 50
 
+// the device of the sessions logged in the admin console
+const adminDevice = "admin"
+
 type response struct {
 	ReqPath  string      `json:"req_path"`
 	RespData interface{} `json:"response_data"`
@@ -37,6 +38,8 @@ func BindAccountApi(m *martini.ClassicMartini) {
 	m.Get("/admin/user/search", binding.Form(getSearchListForm{}), adminErrorHandler, getSearchListHandler)
 	m.Get("/admin/user/friendship", binding.Form(getUserFriendsForm{}), adminErrorHandler, getUserFriendsHandler)
 	m.Post("/admin/user/ban", binding.Json(banUserForm{}), adminErrorHandler, banUserHandler)
+	m.Post("/admin/user/quota", binding.Json(userQuotaForm{}), adminErrorHandler, userQuotaHandler)
+	m.Post("/admin/user/expirepass", binding.Json(expirePasswordForm{}), adminErrorHandler, expirePasswordHandler)
 	m.Post("/admin/user/update", updateUserInfoHandler)
 	//m.Post("/admin/user/update", binding.Json(userInfoForm{}), adminErrorHandler, updateUserInfoHandler)
 }
@@ -50,23 +53,15 @@ type adminLoginForm struct {
 func adminLoginHandler(request *http.Request, resp http.ResponseWriter, redis *models.RedisLogger, form adminLoginForm) {
 	user := &models.Account{}
 
-	u4, err := uuid.NewV4()
-	if err != nil {
-		writeResponse(resp, err)
-		return
-	}
-	token := u4.String()
 	var find bool
-	//var err error
-
-	h := md5.New()
-	io.WriteString(h, form.Password)
-	pwd := fmt.Sprintf("%x", h.Sum(nil))
+	var err error
 
-	if find, err = user.FindByUserPass(strings.ToLower(form.UserName), pwd); !find {
+	if find, err = user.FindByUserPass(strings.ToLower(form.UserName), form.Password); !find {
 		if err == nil {
 			err = errors.NewError(errors.AuthError)
 		}
+	} else if user.PasswordExpired {
+		err = errors.NewError(errors.PasswordExpiredError)
 	}
 
 	if err != nil {
@@ -75,12 +70,14 @@ func adminLoginHandler(request *http.Request, resp http.ResponseWriter, redis *m
 	}
 
 	user.SetLastLogin(0, time.Now())
-	redis.SetOnlineUser(token, user.Id)
+	session := redis.NewSession(user.Id, adminDevice, controllers.ClientIp(request))
 	redis.LogLogin(user.Id)
 
 	data := map[string]interface{}{
-		"userid":       user.Id,
-		"access_token": token,
+		"userid":        user.Id,
+		"access_token":  session.AccessToken,
+		"refresh_token": session.RefreshToken,
+		"expires_in":    models.AccessTokenExpire,
 	}
 	writeResponse(resp, data)
 }
@@ -874,12 +871,82 @@ func banUserHandler(request *http.Request, resp http.ResponseWriter, redis *mode
 		writeResponse(resp, err)
 		return
 	}
+	if user.TimeLimit != 0 {
+		redis.RevokeSessions(user.Id, "")
+	}
 	respData := map[string]interface{}{
 		"ban": form.Duration,
 	}
 	writeResponse(resp, respData)
 }
 
+type userQuotaForm struct {
+	Userid string `json:"userid" binding:"required"`
+	Quota  int64  `json:"quota"`
+	Token  string `json:"access_token" binding:"required"`
+}
+
+// This function sets the storage quota of user in bytes, the default quota is restored if Quota is 0.
+func userQuotaHandler(request *http.Request, resp http.ResponseWriter, redis *models.RedisLogger, form userQuotaForm) {
+	valid, errT := checkToken(redis, form.Token)
+	if !valid {
+		writeResponse(resp, errT)
+		return
+	}
+
+	user := &models.Account{}
+	if find, err := user.FindByUserid(form.Userid); !find {
+		if err == nil {
+			err = errors.NewError(errors.NotExistsError, "user '"+form.Userid+"' not exists")
+		}
+		writeResponse(resp, err)
+		return
+	}
+
+	if err := user.SetQuota(form.Quota); err != nil {
+		writeResponse(resp, err)
+		return
+	}
+	respData := map[string]interface{}{
+		"quota":        user.StorageQuota(),
+		"storage_used": user.StorageUsed,
+	}
+	writeResponse(resp, respData)
+}
+
+type expirePasswordForm struct {
+	Userid  string `json:"userid" binding:"required"`
+	Expired bool   `json:"expired"`
+	Token   string `json:"access_token" binding:"required"`
+}
+
+// This function forces the user to reset the password of the compromised account.
+func expirePasswordHandler(request *http.Request, resp http.ResponseWriter, redis *models.RedisLogger, form expirePasswordForm) {
+	valid, errT := checkToken(redis, form.Token)
+	if !valid {
+		writeResponse(resp, errT)
+		return
+	}
+
+	user := &models.Account{}
+	if find, err := user.FindByUserid(form.Userid); !find {
+		if err == nil {
+			err = errors.NewError(errors.NotExistsError, "user '"+form.Userid+"' not exists")
+		}
+		writeResponse(resp, err)
+		return
+	}
+
+	if err := user.ExpirePassword(form.Expired); err != nil {
+		writeResponse(resp, err)
+		return
+	}
+	if form.Expired {
+		redis.RevokeSessions(user.Id, "")
+	}
+	writeResponse(resp, map[string]interface{}{"expired": form.Expired})
+}
+
 /*
 type userInfoForm struct {
 	Userid   string `json:"userid" binding:"required"`
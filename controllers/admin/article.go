@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/fulltext"
 	"github.com/ginuerzh/sports/models"
 	"github.com/martini-contrib/binding"
 	"gopkg.in/go-martini/martini.v1"
@@ -23,6 +24,7 @@ func BindArticleApi(m *martini.ClassicMartini) {
 	m.Post("/admin/article/delete", binding.Json(delArticleForm{}), adminErrorHandler, delArticleHandler)
 	m.Get("/admin/article/search", binding.Form(articleSearchForm{}), adminErrorHandler, articleSearchHandler)
 	m.Post("/admin/article/update", binding.Json(articleUpdateForm{}), adminErrorHandler, articleUpdateHandler)
+	m.Post("/admin/search/rebuild", binding.Json(rebuildIndexForm{}), adminErrorHandler, rebuildIndexHandler)
 }
 
 type articleInfo struct {
@@ -40,6 +42,7 @@ type articleInfo struct {
 	RewardUsers  []string       `json:"rewards_users"`
 	Tags         []string       `json:"tags"`
 	Contents     string         `json:"contents"`
+	Highlight    string         `json:"highlight,omitempty"`
 }
 
 func convertArticle(article *models.Article, redis *models.RedisLogger) *articleInfo {
@@ -278,8 +281,11 @@ func delArticleHandler(w http.ResponseWriter, redis *models.RedisLogger, form de
 }
 
 type articleSearchForm struct {
-	Keyword string `form:"keyword" binding:"required"`
+	Keyword string `form:"keyword"`
 	Tag     string `form:"tag"`
+	Author  string `form:"author"`
+	Start   int64  `form:"start_time"`
+	End     int64  `form:"end_time"`
 	AdminPaging
 	Token string `form:"access_token"`
 }
@@ -295,11 +301,23 @@ func articleSearchHandler(w http.ResponseWriter, redis *models.RedisLogger, form
 	if form.PageCount == 0 {
 		form.PageCount = 50
 	}
-	total, articles, _ := models.AdminSearchArticle(form.Keyword, form.Tag, form.PageIndex, form.PageCount)
+	query := fulltext.Query{
+		Keyword: form.Keyword,
+		Tag:     form.Tag,
+		Author:  form.Author,
+	}
+	if form.Start > 0 {
+		query.Start = time.Unix(form.Start, 0)
+	}
+	if form.End > 0 {
+		query.End = time.Unix(form.End, 0)
+	}
+	total, articles, highlights, _ := models.AdminSearchArticle(query, form.PageIndex, form.PageCount)
 
 	list := make([]*articleInfo, len(articles))
 	for i, _ := range articles {
 		list[i] = convertArticle(&articles[i], redis)
+		list[i].Highlight = highlights[list[i].Id]
 	}
 
 	pages := total / form.PageCount
@@ -356,3 +374,20 @@ func articleUpdateHandler(w http.ResponseWriter, redis *models.RedisLogger, form
 
 	writeResponse(w, map[string]interface{}{})
 }
+
+type rebuildIndexForm struct {
+	Token string `json:"access_token" binding:"required"`
+}
+
+func rebuildIndexHandler(w http.ResponseWriter, redis *models.RedisLogger, form rebuildIndexForm) {
+	if valid, err := checkToken(redis, form.Token); !valid {
+		writeResponse(w, err)
+		return
+	}
+
+	if err := models.RebuildSearchIndex(); err != nil {
+		writeResponse(w, err)
+		return
+	}
+	writeResponse(w, map[string]interface{}{})
+}
@@ -0,0 +1,318 @@
+// report
+package admin
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/models"
+	"github.com/martini-contrib/binding"
+	"gopkg.in/go-martini/martini.v1"
+	"labix.org/v2/mgo/bson"
+	"log"
+	"net/http"
+	"time"
+)
+
+func BindReportApi(m *martini.ClassicMartini) {
+	m.Get("/admin/report/list", binding.Form(reportListForm{}), adminErrorHandler, reportListHandler)
+	m.Post("/admin/report/assign", binding.Json(reportAssignForm{}), adminErrorHandler, reportAssignHandler)
+	m.Post("/admin/report/resolve", binding.Json(reportResolveForm{}), adminErrorHandler, reportResolveHandler)
+}
+
+type reportInfo struct {
+	Id          string   `json:"report_id"`
+	Type        string   `json:"type"`
+	Target      string   `json:"target"`
+	Owner       string   `json:"owner"`
+	Reporter    string   `json:"reporter"`
+	Reason      string   `json:"reason"`
+	Evidence    []string `json:"evidence"`
+	Contents    string   `json:"contents"`
+	Time        int64    `json:"time"`
+	Status      string   `json:"status"`
+	Assignee    string   `json:"assignee"`
+	Resolution  string   `json:"resolution"`
+	Resolver    string   `json:"resolver"`
+	Note        string   `json:"note"`
+	ResolveTime int64    `json:"resolve_time"`
+}
+
+func convertReport(report *models.Report) *reportInfo {
+	info := &reportInfo{
+		Id:         report.Id.Hex(),
+		Type:       report.Type,
+		Target:     report.Target,
+		Owner:      report.Owner,
+		Reporter:   report.Reporter,
+		Reason:     report.Reason,
+		Evidence:   report.Evidence,
+		Time:       report.Time.Unix(),
+		Status:     report.Status,
+		Assignee:   report.Assignee,
+		Resolution: report.Resolution,
+		Resolver:   report.Resolver,
+		Note:       report.Note,
+	}
+	if !report.ResolveTime.IsZero() {
+		info.ResolveTime = report.ResolveTime.Unix()
+	}
+
+	// the snapshot taken when reported, or the current content for the reports without it
+	if len(report.Contents) > 0 {
+		info.Contents = formatArticleContent(report.Contents)
+		return info
+	}
+	switch report.Type {
+	case models.ReportArticle, models.ReportComment:
+		article := &models.Article{}
+		if find, _ := article.FindById(report.Target); find {
+			info.Contents = formatArticleContent(article.Contents)
+		}
+	case models.ReportMessage:
+		msg := &models.Message{}
+		if find, _ := msg.FindById(report.Target); find {
+			info.Contents = formatMsgContent(msg.Body)
+		}
+	case models.ReportUser:
+		user := &models.Account{}
+		if find, _ := user.FindByUserid(report.Target); find {
+			info.Contents = user.Nickname + "\n\n" + user.About
+		}
+	}
+	return info
+}
+
+type reportListForm struct {
+	Status   string `form:"status"`
+	Type     string `form:"type"`
+	Assignee string `form:"assignee"`
+	Owner    string `form:"owner"`
+	Reporter string `form:"reporter"`
+	AdminPaging
+	Token string `form:"access_token" binding:"required"`
+}
+
+// the moderation queue, the oldest reports first.
+func reportListHandler(w http.ResponseWriter, redis *models.RedisLogger, form reportListForm) {
+	if valid, err := checkToken(redis, form.Token); !valid {
+		writeResponse(w, err)
+		return
+	}
+
+	if form.PageCount == 0 {
+		form.PageCount = 50
+	}
+	total, reports, err := models.Reports(form.Status, form.Type, form.Assignee,
+		form.Owner, form.Reporter, form.PageIndex, form.PageCount)
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+
+	list := make([]*reportInfo, len(reports))
+	for i, _ := range reports {
+		list[i] = convertReport(&reports[i])
+	}
+
+	pages := total / form.PageCount
+	if total%form.PageCount > 0 {
+		pages++
+	}
+	resp := map[string]interface{}{
+		"reports":      list,
+		"page_index":   form.PageIndex,
+		"page_total":   pages,
+		"total_number": total,
+	}
+	writeResponse(w, resp)
+}
+
+type reportAssignForm struct {
+	Id       string `json:"report_id" binding:"required"`
+	Assignee string `json:"assignee"`
+	Release  bool   `json:"release"`
+	Token    string `json:"access_token" binding:"required"`
+}
+
+// This function assigns the report to the moderator, the current moderator by default.
+// The report is put back to the queue if Release is true.
+func reportAssignHandler(w http.ResponseWriter, redis *models.RedisLogger, form reportAssignForm) {
+	uid := redis.OnlineUser(form.Token)
+	if len(uid) == 0 {
+		writeResponse(w, errors.NewError(errors.AccessError))
+		return
+	}
+
+	report := &models.Report{}
+	if find, err := report.FindById(form.Id); !find {
+		if err == nil {
+			err = errors.NewError(errors.NotExistsError)
+		}
+		writeResponse(w, err)
+		return
+	}
+
+	assignee := form.Assignee
+	if len(assignee) == 0 {
+		assignee = uid
+	}
+	if form.Release {
+		assignee = ""
+	}
+	if len(assignee) > 0 && assignee != uid && !isModerator(redis, assignee) {
+		writeResponse(w, errors.NewError(errors.JsonError, "assignee '"+assignee+"' is not a moderator"))
+		return
+	}
+	if err := report.Assign(assignee); err != nil {
+		writeResponse(w, err)
+		return
+	}
+	writeResponse(w, map[string]string{"assignee": assignee})
+}
+
+// the moderators are the users logged in the admin console
+func isModerator(redis *models.RedisLogger, userid string) bool {
+	for _, s := range redis.Sessions(userid) {
+		if s.Device == adminDevice {
+			return true
+		}
+	}
+	return false
+}
+
+type reportResolveForm struct {
+	Id       string `json:"report_id" binding:"required"`
+	Action   string `json:"action" binding:"required"`
+	Note     string `json:"note"`
+	Duration int64  `json:"duration"` // the ban duration in seconds, -1 is forever
+	Token    string `json:"access_token" binding:"required"`
+}
+
+// delete the reported content, or reset the profile of the reported user
+func deleteReported(redis *models.RedisLogger, report *models.Report) error {
+	switch report.Type {
+	case models.ReportArticle:
+		article := &models.Article{}
+		if find, err := article.FindById(report.Target); !find {
+			return err
+		}
+		if err := article.RemoveId(); err != nil {
+			return err
+		}
+		if !article.Draft {
+			redis.LogArticleTopics(article.Topics(), false)
+		}
+	case models.ReportComment:
+		comment := &models.Article{}
+		if find, err := comment.FindById(report.Target); !find {
+			return err
+		}
+		return comment.DeleteComment(comment.Author)
+	case models.ReportMessage:
+		if !bson.IsObjectIdHex(report.Target) {
+			return nil
+		}
+		msg := &models.Message{Id: bson.ObjectIdHex(report.Target)}
+		return msg.RemoveId()
+	case models.ReportUser:
+		user := &models.Account{Id: report.Target}
+		return user.ResetProfile()
+	}
+	return nil
+}
+
+// notify the user with the event
+func reportNotice(redis *models.RedisLogger, typ, id, to string, body []models.MsgBody) {
+	event := &models.Event{
+		Type: models.EventMsg,
+		Time: time.Now().Unix(),
+		Data: models.EventData{
+			Type: typ,
+			Id:   id,
+			To:   to,
+			Body: body,
+		},
+	}
+	redis.PubMsg(models.EventMsg, to, event.Bytes())
+	if err := event.Save(); err == nil {
+		redis.IncrEventCount(to, event.Data.Type, 1)
+	}
+}
+
+// This function resolves all the pending reports on the same target with the action,
+// then the owner is warned or banned if needed, and the reporters are notified.
+func reportResolveHandler(w http.ResponseWriter, redis *models.RedisLogger, form reportResolveForm) {
+	uid := redis.OnlineUser(form.Token)
+	if len(uid) == 0 {
+		writeResponse(w, errors.NewError(errors.AccessError))
+		return
+	}
+	if !models.ValidResolution(form.Action) {
+		writeResponse(w, errors.NewError(errors.JsonError, "invalid action '"+form.Action+"'"))
+		return
+	}
+	if (form.Action == models.ReportBan && form.Duration == 0) || form.Duration < -1 {
+		writeResponse(w, errors.NewError(errors.JsonError, "invalid duration"))
+		return
+	}
+
+	report := &models.Report{}
+	if find, err := report.FindById(form.Id); !find {
+		if err == nil {
+			err = errors.NewError(errors.NotExistsError)
+		}
+		writeResponse(w, err)
+		return
+	}
+	if report.Status == models.ReportResolved {
+		writeResponse(w, errors.NewError(errors.NotExistsError, "report '"+form.Id+"' is resolved"))
+		return
+	}
+
+	// claim the reports first, so the concurrent moderators don't apply the action twice
+	reports, err := report.Claim(uid)
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+
+	switch form.Action {
+	case models.ReportDelete:
+		err = deleteReported(redis, report)
+	case models.ReportBan:
+		user := &models.Account{Id: report.Owner}
+		banTime := int64(-1)
+		if form.Duration > 0 {
+			banTime = time.Now().Unix() + form.Duration
+		}
+		if err = user.UpdateBanTime(banTime); err == nil {
+			redis.RevokeSessions(user.Id, "")
+		}
+	}
+	if err != nil {
+		if err := models.UnclaimReports(reports); err != nil {
+			log.Println(err)
+		}
+		writeResponse(w, err)
+		return
+	}
+
+	if err := models.ResolveReports(reports, form.Action, form.Note); err != nil {
+		writeResponse(w, err)
+		return
+	}
+
+	if form.Action == models.ReportWarn {
+		reportNotice(redis, models.EventWarn, report.Id.Hex(), report.Owner, []models.MsgBody{
+			{Type: "report_type", Content: report.Type},
+			{Type: "text", Content: form.Note},
+		})
+	}
+	for i, _ := range reports {
+		reportNotice(redis, models.EventReport, reports[i].Id.Hex(), reports[i].Reporter, []models.MsgBody{
+			{Type: "report_type", Content: reports[i].Type},
+			{Type: "resolution", Content: form.Action},
+		})
+	}
+
+	writeResponse(w, map[string]interface{}{"resolved": len(reports)})
+}
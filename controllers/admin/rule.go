@@ -3,6 +3,8 @@ package admin
 
 import (
 	//"encoding/json"
+	"github.com/ginuerzh/sports/controllers"
+	"github.com/ginuerzh/sports/errors"
 	"github.com/ginuerzh/sports/models"
 	"github.com/martini-contrib/binding"
 	"gopkg.in/go-martini/martini.v1"
@@ -11,6 +13,8 @@ import (
 
 func BindRuleApi(m *martini.ClassicMartini) {
 	m.Post("/admin/rule/set", binding.Json(setRuleForm{}), adminErrorHandler, setRuleHandler)
+	m.Get("/admin/rule/challenge", binding.Form(challengeAwardsForm{}), adminErrorHandler, challengeAwardsHandler)
+	m.Post("/admin/rule/challenge", binding.Json(setChallengeAwardsForm{}), adminErrorHandler, setChallengeAwardsHandler)
 }
 
 // admin login parameter
@@ -33,3 +37,56 @@ func setRuleHandler(w http.ResponseWriter, redis *models.RedisLogger, form setRu
 
 	writeResponse(w, map[string]interface{}{})
 }
+
+type challengeAwardsForm struct {
+	Token string `form:"access_token" binding:"required"`
+}
+
+// the awards of the new challenges
+func challengeAwardsHandler(w http.ResponseWriter, redis *models.RedisLogger, form challengeAwardsForm) {
+	if valid, err := checkToken(redis, form.Token); !valid {
+		writeResponse(w, err)
+		return
+	}
+
+	awards, err := controllers.ChallengeAwards()
+	if err != nil {
+		writeResponse(w, err)
+		return
+	}
+	writeResponse(w, awards)
+}
+
+type setChallengeAwardsForm struct {
+	Winner   models.Props `json:"winner_awards"`
+	Finisher models.Props `json:"finisher_awards"`
+	Token    string       `json:"access_token" binding:"required"`
+}
+
+func validChallengeAwards(props models.Props) bool {
+	// no wealth, so the challenges can't be used to drain the coins
+	return props.Physical >= 0 && props.Literal >= 0 && props.Mental >= 0 && props.Score >= 0 &&
+		props.Wealth == 0 && props.Level == 0
+}
+
+// set the awards of the challenges created later, the running challenges keep their awards.
+func setChallengeAwardsHandler(w http.ResponseWriter, redis *models.RedisLogger, form setChallengeAwardsForm) {
+	if valid, err := checkToken(redis, form.Token); !valid {
+		writeResponse(w, err)
+		return
+	}
+	if !validChallengeAwards(form.Winner) || !validChallengeAwards(form.Finisher) {
+		writeResponse(w, errors.NewError(errors.JsonError, "invalid awards"))
+		return
+	}
+
+	awards := &models.ChallengeAwards{
+		Winner:   form.Winner,
+		Finisher: form.Finisher,
+	}
+	if err := awards.Save(); err != nil {
+		writeResponse(w, err)
+		return
+	}
+	writeResponse(w, awards)
+}
@@ -5,6 +5,7 @@ import (
 	//"bytes"
 	//"encoding/json"
 	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/fulltext"
 	"github.com/ginuerzh/sports/models"
 	"github.com/martini-contrib/binding"
 	"github.com/zhengying/apns"
@@ -14,8 +15,9 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	//"strings"
+	"strings"
 	"time"
+	"unicode"
 )
 
 func BindArticleApi(m *martini.ClassicMartini) {
@@ -25,6 +27,7 @@ func BindArticleApi(m *martini.ClassicMartini) {
 		checkTokenHandler,
 		loadUserHandler,
 		checkLimitHandler,
+		checkGuestHandler,
 		newArticleHandler)
 	m.Post("/1/article/delete",
 		binding.Json(deleteArticleForm{}, (*Parameter)(nil)),
@@ -55,6 +58,49 @@ func BindArticleApi(m *martini.ClassicMartini) {
 		binding.Json(articleCommentsForm{}),
 		ErrorHandler,
 		articleCommentsHandler)
+	m.Get("/1/article/mentions",
+		binding.Form(articleMentionsForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		articleMentionsHandler)
+	m.Post("/1/article/edit",
+		binding.Json(editArticleForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		loadUserHandler,
+		checkLimitHandler,
+		checkGuestHandler,
+		editArticleHandler)
+	m.Post("/1/article/visibility",
+		binding.Json(articleVisibilityForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		articleVisibilityHandler)
+	m.Post("/1/article/publish",
+		binding.Json(publishArticleForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		loadUserHandler,
+		checkLimitHandler,
+		checkGuestHandler,
+		publishArticleHandler)
+	m.Get("/1/article/drafts",
+		binding.Form(articleDraftsForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		articleDraftsHandler)
+	m.Get("/1/article/revisions",
+		binding.Form(articleRevisionsForm{}),
+		ErrorHandler,
+		articleRevisionsHandler)
+	m.Get("/1/article/search",
+		binding.Form(articleSearchForm{}),
+		ErrorHandler,
+		articleSearchHandler)
+	m.Post("/1/article/replies",
+		binding.Json(commentRepliesForm{}),
+		ErrorHandler,
+		commentRepliesHandler)
 }
 
 type articleJsonStruct struct {
@@ -70,6 +116,18 @@ type articleJsonStruct struct {
 	NewReviews int              `json:"new_sub_article_count"`
 	Contents   []models.Segment `json:"article_segments"`
 	Rewards    int64            `json:"reward_total"`
+	Edited     bool             `json:"edited"`
+	EditTime   int64            `json:"edit_time,omitempty"`
+	Draft      bool             `json:"draft,omitempty"`
+	Scheduled  bool             `json:"scheduled,omitempty"`
+	Highlight  string           `json:"highlight,omitempty"`
+
+	Root       string               `json:"root_comment_id,omitempty"`
+	ReplyTo    string               `json:"reply_comment_id,omitempty"`
+	ReplyUser  string               `json:"reply_author,omitempty"`
+	ReplyCount int                  `json:"reply_count,omitempty"`
+	Replies    []*articleJsonStruct `json:"replies,omitempty"`
+	Deleted    bool                 `json:"deleted,omitempty"`
 }
 
 func convertArticle(article *models.Article) *articleJsonStruct {
@@ -82,6 +140,23 @@ func convertArticle(article *models.Article) *articleJsonStruct {
 	jsonStruct.Thumbs = len(article.Thumbs)
 	jsonStruct.Reviews = len(article.Reviews)
 	jsonStruct.Rewards = article.TotalReward
+	if !article.EditTime.IsZero() {
+		jsonStruct.Edited = true
+		jsonStruct.EditTime = article.EditTime.Unix()
+	}
+	jsonStruct.Draft = article.Draft
+	jsonStruct.Scheduled = article.Scheduled
+
+	jsonStruct.Root = article.Root
+	jsonStruct.ReplyTo = article.ReplyTo
+	jsonStruct.ReplyUser = article.ReplyUser
+	jsonStruct.ReplyCount = article.ReplyCount
+	// placeholder of the deleted comment
+	if article.Deleted {
+		jsonStruct.Deleted = true
+		jsonStruct.Author = ""
+		jsonStruct.Contents = nil
+	}
 
 	jsonStruct.Title, jsonStruct.Image = article.Cover()
 
@@ -92,10 +167,69 @@ func convertArticle(article *models.Article) *articleJsonStruct {
 	return jsonStruct
 }
 
+// whether the article can be seen by the viewer, by the privacy of the author and the visibility of the article.
+func canViewArticle(redis *models.RedisLogger, article *models.Article, author *models.Account, viewer string) bool {
+	rel := relationTo(redis, article.Author, viewer)
+	return models.Visible(author.Privacy.Articles, rel) && models.Visible(article.Visibility, rel)
+}
+
+// load the article can be seen by the viewer, the drafts can be seen by the author only.
+func loadVisibleArticle(redis *models.RedisLogger, id, viewer string) (*models.Article, error) {
+	article := &models.Article{}
+	find, err := article.FindById(id)
+	if !find || (article.Draft && viewer != article.Author) {
+		if err == nil {
+			err = errors.NewError(errors.NotExistsError)
+		}
+		return nil, err
+	}
+	if viewer != article.Author {
+		author := &models.Account{}
+		author.FindByUserid(article.Author)
+		if !canViewArticle(redis, article, author, viewer) {
+			return nil, errors.NewError(errors.AccessError, "无权查看该文章")
+		}
+	}
+	return article, nil
+}
+
+// the articles can be seen by the viewer
+func visibleArticles(redis *models.RedisLogger, articles []models.Article, viewer string) []models.Article {
+	var ids []string
+	for i, _ := range articles {
+		if !containsString(ids, articles[i].Author) {
+			ids = append(ids, articles[i].Author)
+		}
+	}
+	authors := make(map[string]*models.Account)
+	if len(ids) > 0 {
+		users, _ := models.FindUsers(ids)
+		for i, _ := range users {
+			authors[users[i].Id] = &users[i]
+		}
+	}
+
+	list := []models.Article{}
+	for i, _ := range articles {
+		author, ok := authors[articles[i].Author]
+		if !ok {
+			author = &models.Account{Id: articles[i].Author}
+		}
+		if canViewArticle(redis, &articles[i], author, viewer) {
+			list = append(list, articles[i])
+		}
+	}
+	return list
+}
+
 type newArticleForm struct {
-	Parent   string           `json:"parent_article_id"`
-	Contents []models.Segment `json:"article_segments" binding:"required"`
-	Tags     []string         `json:"article_tag"`
+	Parent     string           `json:"parent_article_id"`
+	Contents   []models.Segment `json:"article_segments" binding:"required"`
+	Tags       []string         `json:"article_tag"`
+	Draft      bool             `json:"draft"`
+	PubTime    int64            `json:"pub_time"`
+	ReplyTo    string           `json:"reply_comment_id"`
+	Visibility string           `json:"visibility"`
 	parameter
 }
 
@@ -103,6 +237,11 @@ func newArticleHandler(request *http.Request, resp http.ResponseWriter,
 	client *apns.Client, redis *models.RedisLogger, user *models.Account, p Parameter) {
 	form := p.(newArticleForm)
 
+	if !models.ValidPrivacy(form.Visibility) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.JsonError, "无效的可见范围"))
+		return
+	}
+
 	article := &models.Article{
 		Author:   user.Id,
 		Contents: form.Contents,
@@ -110,9 +249,52 @@ func newArticleHandler(request *http.Request, resp http.ResponseWriter,
 		Parent:   form.Parent,
 		Tags:     form.Tags,
 	}
+	if len(form.Parent) == 0 {
+		article.Visibility = form.Visibility
+	}
 	if len(article.Tags) == 0 {
 		article.Tags = []string{"SPORT_LOG"}
 	}
+	if len(form.Parent) == 0 {
+		if form.PubTime > article.PubTime.Unix() {
+			article.PubTime = time.Unix(form.PubTime, 0)
+			article.Draft = true
+			article.Scheduled = true
+		}
+		if form.Draft {
+			article.Draft = true
+			article.Scheduled = false
+		}
+		article.Tags = append(article.Tags, article.Topics()...)
+	}
+	// the article commented must be seen by the user
+	if len(form.Parent) > 0 {
+		if _, err := loadVisibleArticle(redis, form.Parent, user.Id); err != nil {
+			writeResponse(request.RequestURI, resp, nil, err)
+			return
+		}
+	}
+	// reply to a comment
+	if len(form.Parent) > 0 && len(form.ReplyTo) > 0 {
+		comment := &models.Article{}
+		if find, err := comment.FindById(form.ReplyTo); !find || comment.Parent != form.Parent || comment.Deleted {
+			if err == nil {
+				err = errors.NewError(errors.NotExistsError)
+			}
+			writeResponse(request.RequestURI, resp, nil, err)
+			return
+		}
+		article.Root = comment.Root
+		if len(article.Root) == 0 {
+			article.Root = comment.Id.Hex()
+		}
+		article.ReplyTo = comment.Id.Hex()
+		article.ReplyUser = comment.Author
+	}
+	mentions := articleMentions(user.Id, form.Contents, redis)
+	for _, u := range mentions {
+		article.Mentions = append(article.Mentions, u.Id)
+	}
 
 	if err := article.Save(); err != nil {
 		log.Println(err)
@@ -122,9 +304,9 @@ func newArticleHandler(request *http.Request, resp http.ResponseWriter,
 
 	awards := Awards{}
 	// only new article
-	if len(form.Parent) == 0 {
-		awards = Awards{Literal: 10 + user.Props.Level, Wealth: 10 * models.Satoshi, Score: 10 + user.Props.Level}
-		if err := GiveAwards(user, awards, redis); err != nil {
+	if len(form.Parent) == 0 && !article.Draft {
+		var err error
+		if awards, err = articlePublished(client, redis, user, article); err != nil {
 			log.Println(err)
 			writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.DbError, err.Error()))
 			return
@@ -175,6 +357,14 @@ func newArticleHandler(request *http.Request, resp http.ResponseWriter,
 				}
 			}
 		}
+
+		if len(article.ReplyUser) > 0 && article.ReplyUser != user.Id && article.ReplyUser != parent.Author {
+			replyNotice(client, redis, user, parent, article)
+		}
+
+		for i, _ := range mentions {
+			mentionNotice(client, redis, user, &mentions[i], article)
+		}
 	}
 
 	respData := map[string]interface{}{
@@ -184,6 +374,125 @@ func newArticleHandler(request *http.Request, resp http.ResponseWriter,
 	writeResponse(request.RequestURI, resp, respData, nil)
 }
 
+// things to do when the article is visible to others
+func articlePublished(client *apns.Client, redis *models.RedisLogger,
+	user *models.Account, article *models.Article) (Awards, error) {
+
+	redis.LogArticleTopics(article.Topics(), true)
+	redis.FanOutArticle(user.Id, article)
+
+	for _, uid := range article.Mentions {
+		u := &models.Account{}
+		if find, _ := u.FindByUserid(uid); find {
+			mentionNotice(client, redis, user, u, article)
+		}
+	}
+
+	awards := Awards{Literal: 10 + user.Props.Level, Wealth: 10 * models.Satoshi, Score: 10 + user.Props.Level}
+	if err := GiveAwards(user, awards, redis); err != nil {
+		return Awards{}, err
+	}
+	return awards, nil
+}
+
+// find nicknames after '@' in text, a nickname ends with a space or punctuation
+func findMentions(text string) []string {
+	var mentions []string
+
+	for _, s := range strings.Split(text, "@")[1:] {
+		end := strings.IndexFunc(s, func(r rune) bool {
+			return unicode.IsSpace(r) || (unicode.IsPunct(r) && r != '_' && r != '-')
+		})
+		if end >= 0 {
+			s = s[:end]
+		}
+		if len(s) == 0 {
+			continue
+		}
+		dup := false
+		for _, m := range mentions {
+			if m == s {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			mentions = append(mentions, s)
+		}
+	}
+
+	return mentions
+}
+
+// resolve the mentioned users of the article contents, users who blacklisted the author are skipped.
+func articleMentions(author string, contents []models.Segment, redis *models.RedisLogger) []models.Account {
+	var users []models.Account
+
+	for _, seg := range contents {
+		if strings.ToUpper(seg.ContentType) != "TEXT" {
+			continue
+		}
+		for _, nickname := range findMentions(seg.ContentText) {
+			u := models.Account{}
+			if find, _ := u.FindByNickname(nickname); !find || u.Id == author {
+				continue
+			}
+			if redis.Relationship(u.Id, author) == models.RelBlacklist {
+				continue
+			}
+			dup := false
+			for _, user := range users {
+				if user.Id == u.Id {
+					dup = true
+					break
+				}
+			}
+			if !dup {
+				users = append(users, u)
+			}
+		}
+	}
+
+	return users
+}
+
+func mentionNotice(client *apns.Client, redis *models.RedisLogger,
+	user *models.Account, to *models.Account, article *models.Article) {
+
+	_, coverImage := article.Cover()
+	// ws push
+	event := &models.Event{
+		Type: models.EventArticle,
+		Time: time.Now().Unix(),
+		Data: models.EventData{
+			Type: models.EventMention,
+			Id:   article.Id.Hex(),
+			From: user.Id,
+			To:   to.Id,
+			Body: []models.MsgBody{
+				{Type: "nikename", Content: user.Nickname},
+				{Type: "image", Content: coverImage},
+			},
+		},
+	}
+	if len(article.Parent) > 0 {
+		event.Data.Body = append(event.Data.Body, models.MsgBody{Type: "parent", Content: article.Parent})
+	}
+	redis.PubMsg(models.EventArticle, to.Id, event.Bytes())
+	if err := event.Save(); err == nil {
+		redis.IncrEventCount(to.Id, event.Data.Type, 1)
+	}
+	// apple push
+	devs, enabled, _ := to.Devices()
+	if enabled {
+		for _, dev := range devs {
+			if err := sendApns(client, dev, user.Nickname+"提到了你!", 1, ""); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
 type deleteArticleForm struct {
 	Id string `json:"article_id" binding:"required"`
 	parameter
@@ -195,10 +504,20 @@ func deleteArticleHandler(request *http.Request, resp http.ResponseWriter,
 	form := p.(deleteArticleForm)
 
 	article := &models.Article{}
+	if find, _ := article.FindById(form.Id); find && len(article.Parent) > 0 {
+		err := article.DeleteComment(user.Id)
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	article = &models.Article{}
 	article.Author = user.Id
 	article.Id = bson.ObjectIdHex(form.Id)
 
 	err := article.Remove()
+	if err == nil && len(article.Parent) == 0 && !article.Draft {
+		redis.LogArticleTopics(article.Topics(), false)
+	}
 	writeResponse(request.RequestURI, resp, nil, err)
 }
 
@@ -213,7 +532,7 @@ func articleThumbHandler(request *http.Request, resp http.ResponseWriter,
 
 	form := p.(articleThumbForm)
 	article := &models.Article{}
-	if find, err := article.FindById(form.Id); !find {
+	if find, err := article.FindById(form.Id); !find || article.Deleted {
 		e := errors.NewError(errors.NotExistsError)
 		if err != nil {
 			e = errors.NewError(errors.DbError, err.Error())
@@ -262,10 +581,14 @@ func articleThumbHandler(request *http.Request, resp http.ResponseWriter,
 		if err := event.Save(); err == nil {
 			redis.IncrEventCount(article.Author, event.Data.Type, 1)
 		}
+		msg := user.Nickname + "赞了你的主题!"
+		if len(article.Parent) > 0 {
+			msg = user.Nickname + "赞了你的评论!"
+		}
 		devs, enabled, _ := u.Devices()
 		if enabled {
 			for _, dev := range devs {
-				if err := sendApns(client, dev, user.Nickname+"赞了你的主题!", 1, ""); err != nil {
+				if err := sendApns(client, dev, msg, 1, ""); err != nil {
 					log.Println(err)
 				}
 			}
@@ -304,6 +627,7 @@ func articleListHandler(request *http.Request, resp http.ResponseWriter, redis *
 		writeResponse(request.RequestURI, resp, nil, err)
 		return
 	}
+	articles = visibleArticles(redis, articles, redis.OnlineUser(form.Token))
 
 	jsonStructs := make([]*articleJsonStruct, len(articles))
 	for i, _ := range articles {
@@ -324,16 +648,14 @@ type articleInfoForm struct {
 }
 
 func articleInfoHandler(request *http.Request, resp http.ResponseWriter, redis *models.RedisLogger, form articleInfoForm) {
-	article := &models.Article{}
-	if find, err := article.FindById(form.Id); !find {
-		if err == nil {
-			err = errors.NewError(errors.NotExistsError)
-		}
+	uid := redis.OnlineUser(form.Token)
+	article, err := loadVisibleArticle(redis, form.Id, uid)
+	if err != nil {
 		writeResponse(request.RequestURI, resp, nil, err)
 		return
 	}
 
-	if uid := redis.OnlineUser(form.Token); uid == article.Author {
+	if len(uid) > 0 && uid == article.Author {
 		user := &models.Account{Id: uid}
 		count := user.ClearEvent(models.EventThumb, article.Id.Hex())
 		redis.IncrEventCount(user.Id, models.EventThumb, -count)
@@ -344,25 +666,37 @@ func articleInfoHandler(request *http.Request, resp http.ResponseWriter, redis *
 		count = user.ClearEvent(models.EventReward, article.Id.Hex())
 		redis.IncrEventCount(user.Id, models.EventReward, -count)
 	}
+	if len(uid) > 0 {
+		user := &models.Account{Id: uid}
+		count := user.ClearEvent(models.EventMention, article.Id.Hex())
+		redis.IncrEventCount(user.Id, models.EventMention, -count)
+	}
 
 	jsonStruct := convertArticle(article)
 	writeResponse(request.RequestURI, resp, jsonStruct, nil)
 }
 
 type articleCommentsForm struct {
-	Id string `json:"article_id"  binding:"required"`
+	Id    string `json:"article_id"  binding:"required"`
+	Sort  string `json:"sort"`
+	Token string `json:"access_token"`
 	models.Paging
 }
 
+// the comments of the article can be seen by the viewer
 func articleCommentsHandler(request *http.Request, resp http.ResponseWriter,
-	form articleCommentsForm) {
+	redis *models.RedisLogger, form articleCommentsForm) {
 
-	article := &models.Article{Id: bson.ObjectIdHex(form.Id)}
-	_, comments, err := article.Comments(&form.Paging)
+	article, err := loadVisibleArticle(redis, form.Id, redis.OnlineUser(form.Token))
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	_, comments, err := article.Comments(form.Sort, &form.Paging)
 
 	jsonStructs := make([]*articleJsonStruct, len(comments))
 	for i, _ := range comments {
-		jsonStructs[i] = convertArticle(&comments[i])
+		jsonStructs[i] = convertThread(&comments[i])
 	}
 
 	respData := make(map[string]interface{})
@@ -372,3 +706,317 @@ func articleCommentsHandler(request *http.Request, resp http.ResponseWriter,
 	respData["articles_without_content"] = jsonStructs
 	writeResponse(request.RequestURI, resp, respData, err)
 }
+
+type articleMentionsForm struct {
+	models.Paging
+	parameter
+}
+
+func articleMentionsHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(articleMentionsForm)
+	_, articles, err := models.MentionArticles(user.Id, &form.Paging)
+
+	jsonStructs := make([]*articleJsonStruct, len(articles))
+	for i, _ := range articles {
+		jsonStructs[i] = convertArticle(&articles[i])
+	}
+
+	respData := make(map[string]interface{})
+	respData["page_frist_id"] = form.Paging.First
+	respData["page_last_id"] = form.Paging.Last
+	respData["articles_without_content"] = jsonStructs
+	writeResponse(request.RequestURI, resp, respData, err)
+}
+
+type editArticleForm struct {
+	Id       string           `json:"article_id" binding:"required"`
+	Contents []models.Segment `json:"article_segments" binding:"required"`
+	Tags     []string         `json:"article_tag"`
+	parameter
+}
+
+func editArticleHandler(request *http.Request, resp http.ResponseWriter,
+	client *apns.Client, redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(editArticleForm)
+	article := &models.Article{}
+	if find, err := article.FindById(form.Id); !find {
+		if err == nil {
+			err = errors.NewError(errors.NotExistsError)
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	if article.Author != user.Id {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError))
+		return
+	}
+
+	old := article.Contents
+	oldTopics := article.Topics()
+	oldMentions := article.Mentions
+
+	// tags given by the user, the topics are parsed from the contents
+	var tags []string
+	for _, tag := range article.Tags {
+		if !containsString(oldTopics, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(form.Tags) > 0 {
+		tags = form.Tags
+	}
+	article.Contents = form.Contents
+	article.Tags = tags
+	topics := article.Topics()
+	if len(article.Parent) == 0 {
+		article.Tags = append(article.Tags, topics...)
+	}
+
+	mentions := articleMentions(user.Id, form.Contents, redis)
+	article.Mentions = nil
+	for _, u := range mentions {
+		article.Mentions = append(article.Mentions, u.Id)
+	}
+
+	if err := article.Edit(user.Id, old); err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	if !article.Draft {
+		if len(article.Parent) == 0 {
+			var removed, added []string
+			for _, topic := range oldTopics {
+				if !containsString(topics, topic) {
+					removed = append(removed, topic)
+				}
+			}
+			for _, topic := range topics {
+				if !containsString(oldTopics, topic) {
+					added = append(added, topic)
+				}
+			}
+			redis.LogArticleTopics(removed, false)
+			redis.LogArticleTopics(added, true)
+		}
+		for i, _ := range mentions {
+			if !containsString(oldMentions, mentions[i].Id) {
+				mentionNotice(client, redis, user, &mentions[i], article)
+			}
+		}
+	}
+
+	respData := map[string]interface{}{
+		"articles_without_content": convertArticle(article),
+	}
+	writeResponse(request.RequestURI, resp, respData, nil)
+}
+
+func containsString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+type publishArticleForm struct {
+	Id      string `json:"article_id" binding:"required"`
+	PubTime int64  `json:"pub_time"`
+	parameter
+}
+
+func publishArticleHandler(request *http.Request, resp http.ResponseWriter,
+	client *apns.Client, redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(publishArticleForm)
+	article := &models.Article{}
+	if find, err := article.FindById(form.Id); !find || article.Author != user.Id {
+		if err == nil {
+			err = errors.NewError(errors.NotExistsError)
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	if !article.Draft {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.InvalidMsgError, "article published"))
+		return
+	}
+
+	ok, err := article.Publish(time.Unix(form.PubTime, 0))
+	if !ok {
+		if err == nil {
+			err = errors.NewError(errors.InvalidMsgError, "article published")
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	awards := Awards{}
+	if !article.Draft {
+		if awards, err = articlePublished(client, redis, user, article); err != nil {
+			log.Println(err)
+			writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.DbError, err.Error()))
+			return
+		}
+	}
+
+	respData := map[string]interface{}{
+		"articles_without_content": convertArticle(article),
+		"ExpEffect":                awards,
+	}
+	writeResponse(request.RequestURI, resp, respData, nil)
+}
+
+type articleDraftsForm struct {
+	models.Paging
+	parameter
+}
+
+func articleDraftsHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(articleDraftsForm)
+	_, articles, err := models.DraftArticles(user.Id, &form.Paging)
+
+	jsonStructs := make([]*articleJsonStruct, len(articles))
+	for i, _ := range articles {
+		jsonStructs[i] = convertArticle(&articles[i])
+	}
+
+	respData := make(map[string]interface{})
+	respData["page_frist_id"] = form.Paging.First
+	respData["page_last_id"] = form.Paging.Last
+	respData["articles_without_content"] = jsonStructs
+	writeResponse(request.RequestURI, resp, respData, err)
+}
+
+type revisionJsonStruct struct {
+	Id      string           `json:"revision_id"`
+	Editor  string           `json:"editor"`
+	Time    int64            `json:"time"`
+	Removed []models.Segment `json:"removed_segments"`
+	Added   []models.Segment `json:"added_segments"`
+}
+
+type articleRevisionsForm struct {
+	Id    string `form:"article_id" binding:"required"`
+	Token string `form:"access_token"`
+	models.Paging
+}
+
+func articleRevisionsHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, form articleRevisionsForm) {
+
+	article := &models.Article{}
+	if find, err := article.FindById(form.Id); !find ||
+		(article.Draft && redis.OnlineUser(form.Token) != article.Author) {
+		if err == nil {
+			err = errors.NewError(errors.NotExistsError)
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	_, revisions, err := models.Revisions(form.Id, &form.Paging)
+
+	list := make([]*revisionJsonStruct, len(revisions))
+	for i, rev := range revisions {
+		list[i] = &revisionJsonStruct{
+			Id:      rev.Id.Hex(),
+			Editor:  rev.Editor,
+			Time:    rev.Time.Unix(),
+			Removed: rev.Removed,
+			Added:   rev.Added,
+		}
+		if list[i].Removed == nil {
+			list[i].Removed = []models.Segment{}
+		}
+		if list[i].Added == nil {
+			list[i].Added = []models.Segment{}
+		}
+	}
+
+	respData := make(map[string]interface{})
+	respData["page_frist_id"] = form.Paging.First
+	respData["page_last_id"] = form.Paging.Last
+	respData["revisions"] = list
+	writeResponse(request.RequestURI, resp, respData, err)
+}
+
+type articleSearchForm struct {
+	Keyword string `form:"keyword"`
+	Tag     string `form:"article_tag"`
+	Author  string `form:"author"`
+	Start   int64  `form:"start_time"`
+	End     int64  `form:"end_time"`
+	Token   string `form:"access_token"`
+	models.Paging
+}
+
+func articleSearchHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, form articleSearchForm) {
+
+	query := fulltext.Query{
+		Keyword: form.Keyword,
+		Tag:     form.Tag,
+		Author:  form.Author,
+	}
+	if form.Start > 0 {
+		query.Start = time.Unix(form.Start, 0)
+	}
+	if form.End > 0 {
+		query.End = time.Unix(form.End, 0)
+	}
+	_, articles, highlights, err := models.SearchArticle(query, &form.Paging)
+	articles = visibleArticles(redis, articles, redis.OnlineUser(form.Token))
+
+	jsonStructs := make([]*articleJsonStruct, len(articles))
+	for i, _ := range articles {
+		jsonStructs[i] = convertArticle(&articles[i])
+		jsonStructs[i].Highlight = highlights[jsonStructs[i].Id]
+	}
+
+	respData := make(map[string]interface{})
+	respData["page_frist_id"] = form.Paging.First
+	respData["page_last_id"] = form.Paging.Last
+	respData["articles_without_content"] = jsonStructs
+	writeResponse(request.RequestURI, resp, respData, err)
+}
+
+type articleVisibilityForm struct {
+	Id         string `json:"article_id" binding:"required"`
+	Visibility string `json:"visibility"`
+	parameter
+}
+
+// change who can see the article, by the author only.
+func articleVisibilityHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(articleVisibilityForm)
+	if !models.ValidPrivacy(form.Visibility) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.JsonError, "无效的可见范围"))
+		return
+	}
+
+	article := &models.Article{}
+	if find, err := article.FindById(form.Id); !find {
+		if err == nil {
+			err = errors.NewError(errors.NotExistsError)
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	if article.Author != user.Id || len(article.Parent) > 0 {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError))
+		return
+	}
+
+	err := article.SetVisibility(form.Visibility)
+	writeResponse(request.RequestURI, resp, nil, err)
+}
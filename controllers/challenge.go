@@ -0,0 +1,495 @@
+// challenge
+package controllers
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/models"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The awards of the challenges are decided by the admins, not by the creators, these are the defaults.
+// No wealth is awarded, so the challenges can't be used to drain the coins.
+var (
+	ChallengeWinnerAwards = models.Props{ // for the contributing members of the winner group
+		Physical: 20,
+		Literal:  20,
+		Mental:   20,
+		Score:    20,
+	}
+	ChallengeFinisherAwards = models.Props{ // for the contributing members of the groups reached the target
+		Physical: 10,
+		Literal:  10,
+		Mental:   10,
+		Score:    10,
+	}
+	// the min target of each metric, the groups reached a smaller target are not awarded
+	ChallengeMinTargets = map[string]int64{
+		models.ChallengeDistance: 10000, // 10km
+		models.ChallengeDuration: 3600,  // 1h
+		models.ChallengeRecords:  5,
+	}
+)
+
+const (
+	ChallengeLBSize     = 50 // the members in the challenge leaderboard
+	ChallengeMaxRunning = 3  // the max running challenges created by a group
+)
+
+// the awards of the new challenges set by the admins, or the defaults if not set
+func ChallengeAwards() (*models.ChallengeAwards, error) {
+	awards := &models.ChallengeAwards{}
+	find, err := awards.Find()
+	if err != nil {
+		return nil, err
+	}
+	if !find {
+		awards.Winner = ChallengeWinnerAwards
+		awards.Finisher = ChallengeFinisherAwards
+	}
+	return awards, nil
+}
+
+func propsAwards(props models.Props) Awards {
+	return Awards{
+		Physical: props.Physical,
+		Literal:  props.Literal,
+		Mental:   props.Mental,
+		Wealth:   props.Wealth,
+		Score:    props.Score,
+	}
+}
+
+type challengeJsonStruct struct {
+	Id             string                   `json:"challenge_id"`
+	Gid            string                   `json:"group_id"`
+	Creator        string                   `json:"creator_id"`
+	Title          string                   `json:"title"`
+	Desc           string                   `json:"desc"`
+	Metric         string                   `json:"metric"`
+	Target         int64                    `json:"target"`
+	Start          int64                    `json:"start_time"`
+	End            int64                    `json:"end_time"`
+	Groups         []string                 `json:"group_ids"`
+	Invited        []string                 `json:"invited_ids"`
+	WinnerAwards   Awards                   `json:"winner_awards"`
+	FinisherAwards Awards                   `json:"finisher_awards"`
+	Finished       bool                     `json:"finished"`
+	Results        []models.ChallengeResult `json:"results,omitempty"`
+}
+
+func convertChallenge(challenge *models.Challenge) *challengeJsonStruct {
+	return &challengeJsonStruct{
+		Id:             challenge.Id.Hex(),
+		Gid:            challenge.Gid,
+		Creator:        challenge.Creator,
+		Title:          challenge.Title,
+		Desc:           challenge.Desc,
+		Metric:         challenge.Metric,
+		Target:         challenge.Target,
+		Start:          challenge.Start.Unix(),
+		End:            challenge.End.Unix(),
+		Groups:         challenge.Groups,
+		Invited:        challenge.Invited,
+		WinnerAwards:   propsAwards(challenge.WinnerAwards),
+		FinisherAwards: propsAwards(challenge.FinisherAwards),
+		Finished:       challenge.Finished,
+		Results:        challenge.Results,
+	}
+}
+
+type newChallengeForm struct {
+	Gid    string   `json:"group_id" binding:"required"`
+	Title  string   `json:"title" binding:"required"`
+	Desc   string   `json:"desc"`
+	Metric string   `json:"metric" binding:"required"`
+	Target int64    `json:"target"`
+	Start  int64    `json:"start_time" binding:"required"`
+	End    int64    `json:"end_time" binding:"required"`
+	Groups []string `json:"opponent_ids"`
+	parameter
+}
+
+// create the challenge by the admin of the group, the opposing groups are invited.
+func newChallengeHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(newChallengeForm)
+
+	group, err := loadGroup(form.Gid, user.Id, true)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	if !models.ValidChallengeMetric(form.Metric) || form.Target < 0 ||
+		(form.Target > 0 && form.Target < ChallengeMinTargets[form.Metric]) ||
+		form.End <= form.Start || form.End <= time.Now().Unix() {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.JsonError, "无效的挑战参数"))
+		return
+	}
+	if len(redis.GroupChallenges(group.Gid)) >= ChallengeMaxRunning {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError, "进行中的挑战过多"))
+		return
+	}
+
+	awards, err := ChallengeAwards()
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	challenge := &models.Challenge{
+		Gid:            group.Gid,
+		Creator:        user.Id,
+		Title:          form.Title,
+		Desc:           form.Desc,
+		Metric:         form.Metric,
+		Target:         form.Target,
+		Groups:         []string{group.Gid},
+		Start:          time.Unix(form.Start, 0),
+		End:            time.Unix(form.End, 0),
+		WinnerAwards:   awards.Winner,
+		FinisherAwards: awards.Finisher,
+	}
+	for _, gid := range form.Groups {
+		if containsString(challenge.Groups, gid) || containsString(challenge.Invited, gid) {
+			continue
+		}
+		if _, err := loadGroup(gid, user.Id, false); err != nil {
+			writeResponse(request.RequestURI, resp, nil, err)
+			return
+		}
+		challenge.Invited = append(challenge.Invited, gid)
+	}
+
+	if err := challenge.Save(); err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	redis.AddChallenge(challenge.Id.Hex(), challenge.Groups)
+
+	pubChallengeEvent(redis, challenge, group.Gid, user.Id, []models.MsgBody{
+		{Type: "status", Content: "start"},
+		{Type: "title", Content: challenge.Title},
+	})
+	for _, gid := range challenge.Invited {
+		pubChallengeEvent(redis, challenge, gid, user.Id, []models.MsgBody{
+			{Type: "status", Content: "invite"},
+			{Type: "title", Content: challenge.Title},
+		})
+	}
+
+	writeResponse(request.RequestURI, resp, convertChallenge(challenge), nil)
+}
+
+type acceptChallengeForm struct {
+	Id     string `json:"challenge_id" binding:"required"`
+	Gid    string `json:"group_id" binding:"required"`
+	Reject bool   `json:"reject"`
+	parameter
+}
+
+// the admin of the invited group accepts or rejects the challenge
+func acceptChallengeHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(acceptChallengeForm)
+
+	if _, err := loadGroup(form.Gid, user.Id, true); err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	challenge := &models.Challenge{}
+	if find, err := challenge.FindById(form.Id); !find {
+		if err == nil {
+			err = errors.NewError(errors.NotFoundError, "挑战不存在")
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	if !form.Reject && len(redis.GroupChallenges(form.Gid)) >= ChallengeMaxRunning {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError, "进行中的挑战过多"))
+		return
+	}
+
+	if err := challenge.Accept(form.Gid, !form.Reject); err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	status := "reject"
+	if !form.Reject {
+		status = "accept"
+		redis.AddChallenge(challenge.Id.Hex(), []string{form.Gid})
+		pubChallengeEvent(redis, challenge, form.Gid, user.Id, []models.MsgBody{
+			{Type: "status", Content: "start"},
+			{Type: "title", Content: challenge.Title},
+		})
+	}
+	// notify the group created the challenge
+	pubChallengeEvent(redis, challenge, challenge.Gid, user.Id, []models.MsgBody{
+		{Type: "status", Content: status},
+		{Type: "title", Content: challenge.Title},
+		{Type: "group_id", Content: form.Gid},
+	})
+
+	writeResponse(request.RequestURI, resp, convertChallenge(challenge), nil)
+}
+
+// push the event of the challenge to the group channel
+func pubChallengeEvent(redis *models.RedisLogger, challenge *models.Challenge, gid, from string, body []models.MsgBody) {
+	event := &models.Event{
+		Type: models.EventMsg,
+		Time: time.Now().Unix(),
+		Data: models.EventData{
+			Type: models.EventChallenge,
+			Id:   challenge.Id.Hex(),
+			From: from,
+			To:   gid,
+			Body: body,
+		},
+	}
+	redis.PubMsg(models.EventGChat, gid, event.Bytes())
+}
+
+// count the record in the running challenges of the user's groups, and push the progress to the groups.
+func updateChallenges(redis *models.RedisLogger, user *models.Account, record *models.Record) {
+	groups := redis.Groups(user.Id)
+	var counted []string
+
+	for _, gid := range groups {
+		for _, cid := range redis.GroupChallenges(gid) {
+			if containsString(counted, cid) {
+				continue
+			}
+			counted = append(counted, cid)
+
+			challenge := &models.Challenge{}
+			if find, err := challenge.FindById(cid); !find {
+				if err != nil {
+					log.Println(err)
+				}
+				continue
+			}
+			value := challenge.RecordValue(record)
+			if value == 0 {
+				continue
+			}
+
+			// the user is counted for each of the user's groups in the challenge
+			var cgroups []string
+			for _, g := range challenge.Groups {
+				if containsString(groups, g) {
+					cgroups = append(cgroups, g)
+				}
+			}
+			scores := redis.IncrChallengeScore(cid, user.Id, cgroups, value)
+			for i, g := range cgroups {
+				if i >= len(scores) {
+					break
+				}
+				pubChallengeEvent(redis, challenge, g, user.Id, []models.MsgBody{
+					{Type: "status", Content: "progress"},
+					{Type: "nikename", Content: user.Nickname},
+					{Type: "value", Content: strconv.FormatInt(value, 10)},
+					{Type: "score", Content: strconv.FormatInt(scores[i], 10)},
+					{Type: "target", Content: strconv.FormatInt(challenge.Target, 10)},
+				})
+			}
+		}
+	}
+}
+
+// rank the groups, award the members and notify the groups when the challenge ends.
+// The challenge is finished first to stop counting the records, then the members are awarded one by one,
+// and it's settled at last. The settlement is resumed if it's interrupted, the awarded members are skipped.
+func finishChallenge(redis *models.RedisLogger, challenge *models.Challenge) {
+	cid := challenge.Id.Hex()
+
+	if !challenge.Finished {
+		var results []models.ChallengeResult
+		for _, kv := range redis.ChallengeGroupLB(cid) {
+			if !containsString(challenge.Groups, kv.K) {
+				continue
+			}
+			result := models.ChallengeResult{
+				Gid:     kv.K,
+				Score:   kv.V,
+				Rank:    len(results) + 1,
+				Reached: challenge.Target > 0 && kv.V >= challenge.Target,
+			}
+			// the same score, the same rank
+			if len(results) > 0 && kv.V == results[len(results)-1].Score {
+				result.Rank = results[len(results)-1].Rank
+			}
+			results = append(results, result)
+		}
+		if ok, err := challenge.Finish(results); !ok {
+			if err != nil {
+				log.Println(err)
+			}
+			return
+		}
+	}
+	redis.EndChallenge(cid, challenge.Groups)
+
+	// the members of the winner and the reached groups, there is no winner without the opposing groups
+	var winners, finishers []string
+	for _, result := range challenge.Results {
+		if result.Score == 0 || (result.Rank > 1 && !result.Reached) {
+			continue
+		}
+		group := &models.Group{}
+		if err := group.FindById(result.Gid); err != nil {
+			continue
+		}
+		if result.Rank == 1 && len(challenge.Results) > 1 {
+			winners = append(winners, group.Members...)
+		}
+		if result.Reached {
+			finishers = append(finishers, group.Members...)
+		}
+	}
+
+	// the contributing members only
+	for _, kv := range redis.ChallengeUserLB(cid, 0, -1) {
+		if kv.V <= 0 || containsString(challenge.Awarded, kv.K) {
+			continue
+		}
+		awards := Awards{}
+		if containsString(winners, kv.K) {
+			awards = addAwards(awards, propsAwards(challenge.WinnerAwards))
+		}
+		if containsString(finishers, kv.K) {
+			awards = addAwards(awards, propsAwards(challenge.FinisherAwards))
+		}
+		if awards == (Awards{}) {
+			continue
+		}
+
+		user := &models.Account{}
+		if find, _ := user.FindByUserid(kv.K); !find {
+			continue
+		}
+		if ok, err := challenge.SetAwarded(user.Id); !ok {
+			if err != nil {
+				// try again later
+				log.Println(err)
+				return
+			}
+			continue
+		}
+		awards.Level = int64(models.Score2Level(user.Props.Score+awards.Score)) - (user.Props.Level + 1)
+		if err := GiveAwards(user, awards, redis); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if err := challenge.Settle(); err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, result := range challenge.Results {
+		pubChallengeEvent(redis, challenge, result.Gid, challenge.Creator, []models.MsgBody{
+			{Type: "status", Content: "end"},
+			{Type: "title", Content: challenge.Title},
+			{Type: "rank", Content: strconv.Itoa(result.Rank)},
+			{Type: "score", Content: strconv.FormatInt(result.Score, 10)},
+		})
+	}
+}
+
+func addAwards(a, b Awards) Awards {
+	return Awards{
+		Physical: a.Physical + b.Physical,
+		Literal:  a.Literal + b.Literal,
+		Mental:   a.Mental + b.Mental,
+		Wealth:   a.Wealth + b.Wealth,
+		Score:    a.Score + b.Score,
+	}
+}
+
+type groupChallengesForm struct {
+	Gid string `form:"group_id" binding:"required"`
+	models.Paging
+	parameter
+}
+
+func groupChallengesHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(groupChallengesForm)
+
+	challenges, err := models.GroupChallenges(form.Gid, &form.Paging)
+	list := make([]*challengeJsonStruct, len(challenges))
+	for i, _ := range challenges {
+		list[i] = convertChallenge(&challenges[i])
+	}
+	respData := map[string]interface{}{
+		"challenges":    list,
+		"page_frist_id": form.Paging.First,
+		"page_last_id":  form.Paging.Last,
+	}
+	writeResponse(request.RequestURI, resp, respData, err)
+}
+
+type challengeInfoForm struct {
+	Id string `form:"challenge_id" binding:"required"`
+	parameter
+}
+
+type challengeLBResp struct {
+	Userid   string `json:"userid"`
+	Nickname string `json:"nikename"`
+	Profile  string `json:"user_profile_image"`
+	Rank     int    `json:"index"`
+	Score    int64  `json:"score"`
+}
+
+// the challenge with the leaderboards of the groups and the members
+func challengeInfoHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(challengeInfoForm)
+
+	challenge := &models.Challenge{}
+	if find, err := challenge.FindById(form.Id); !find {
+		if err == nil {
+			err = errors.NewError(errors.NotFoundError, "挑战不存在")
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	groups := redis.ChallengeGroupLB(form.Id)
+	kvs := redis.ChallengeUserLB(form.Id, 0, ChallengeLBSize-1)
+	ids := make([]string, len(kvs))
+	for i, kv := range kvs {
+		ids[i] = kv.K
+	}
+	users, _ := models.FindUsers(ids)
+
+	lb := make([]challengeLBResp, len(kvs))
+	for i, kv := range kvs {
+		lb[i].Userid = kv.K
+		lb[i].Score = kv.V
+		lb[i].Rank = i + 1
+		for j, _ := range users {
+			if users[j].Id == kv.K {
+				lb[i].Nickname = users[j].Nickname
+				lb[i].Profile = users[j].Profile
+				break
+			}
+		}
+	}
+
+	respData := map[string]interface{}{
+		"challenge":     convertChallenge(challenge),
+		"groups_scores": groups,
+		"members_list":  lb,
+	}
+	writeResponse(request.RequestURI, resp, respData, nil)
+}
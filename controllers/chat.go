@@ -25,6 +25,7 @@ func BindChatApi(m *martini.ClassicMartini) {
 		checkTokenHandler,
 		loadUserHandler,
 		checkLimitHandler,
+		checkGuestHandler,
 		sendMsgHandler)
 	m.Get("/1/chat/get_list",
 		binding.Form(msgListForm{}, (*Parameter)(nil)),
@@ -52,9 +53,10 @@ func contactsHandler(request *http.Request, resp http.ResponseWriter,
 }
 
 type sendMsgForm struct {
-	To      string `json:"to_id" binding:"required"`
-	Type    string `json:"type" binding:"required"`
-	Content string `json:"content"`
+	To       string `json:"to_id" binding:"required"`
+	Type     string `json:"type" binding:"required"`
+	Content  string `json:"content"`
+	ChatType string `json:"chat_type"` // chat or groupchat, to_id is the group id of the groupchat
 	parameter
 }
 
@@ -62,6 +64,17 @@ func sendMsgHandler(request *http.Request, resp http.ResponseWriter,
 	client *apns.Client, redis *models.RedisLogger, user *models.Account, p Parameter) {
 
 	form := p.(sendMsgForm)
+	if form.ChatType == models.EventGChat {
+		body := []models.MsgBody{models.MsgBody{Type: form.Type, Content: form.Content}}
+		msg, err := sendGroupMsg(redis, user, form.To, body)
+		if err != nil {
+			writeResponse(request.RequestURI, resp, nil, err)
+			return
+		}
+		writeResponse(request.RequestURI, resp, map[string]string{"message_id": msg.Id.Hex()}, nil)
+		return
+	}
+
 	if redis.Relationship(user.Id, form.To) == models.RelBlacklist ||
 		redis.Relationship(form.To, user.Id) == models.RelBlacklist {
 		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError))
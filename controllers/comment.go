@@ -0,0 +1,100 @@
+// comment
+package controllers
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/models"
+	"github.com/zhengying/apns"
+	"log"
+	"net/http"
+	"time"
+)
+
+// the thread with the first replies
+func convertThread(comment *models.Article) *articleJsonStruct {
+	jsonStruct := convertArticle(comment)
+	if comment.ReplyCount == 0 {
+		return jsonStruct
+	}
+
+	paging := &models.Paging{Count: models.ThreadReplyCount}
+	_, replies, err := comment.Replies(paging)
+	if err != nil {
+		log.Println(err)
+	}
+	for i, _ := range replies {
+		jsonStruct.Replies = append(jsonStruct.Replies, convertArticle(&replies[i]))
+	}
+	return jsonStruct
+}
+
+func replyNotice(client *apns.Client, redis *models.RedisLogger,
+	user *models.Account, parent *models.Article, reply *models.Article) {
+
+	u := &models.Account{Id: reply.ReplyUser}
+	_, coverImage := parent.Cover()
+	// ws push
+	event := &models.Event{
+		Type: models.EventArticle,
+		Time: time.Now().Unix(),
+		Data: models.EventData{
+			Type: models.EventComment,
+			Id:   parent.Id.Hex(),
+			From: user.Id,
+			To:   u.Id,
+			Body: []models.MsgBody{
+				{Type: "reply", Content: reply.ReplyTo},
+				{Type: "image", Content: coverImage},
+			},
+		},
+	}
+	redis.PubMsg(models.EventArticle, u.Id, event.Bytes())
+	if err := event.Save(); err == nil {
+		redis.IncrEventCount(u.Id, event.Data.Type, 1)
+	}
+	// apple push
+	devs, enabled, _ := u.Devices()
+	if enabled {
+		for _, dev := range devs {
+			if err := sendApns(client, dev, user.Nickname+"回复了你的评论!", 1, ""); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+type commentRepliesForm struct {
+	Id    string `json:"comment_id" binding:"required"`
+	Token string `json:"access_token"`
+	models.Paging
+}
+
+// the replies of the comment, the commented article must be seen by the viewer
+func commentRepliesHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, form commentRepliesForm) {
+
+	comment := &models.Article{}
+	if find, err := comment.FindById(form.Id); !find || len(comment.Parent) == 0 {
+		if err == nil {
+			err = errors.NewError(errors.NotExistsError)
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	if _, err := loadVisibleArticle(redis, comment.Parent, redis.OnlineUser(form.Token)); err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	_, replies, err := comment.Replies(&form.Paging)
+
+	jsonStructs := make([]*articleJsonStruct, len(replies))
+	for i, _ := range replies {
+		jsonStructs[i] = convertArticle(&replies[i])
+	}
+
+	respData := make(map[string]interface{})
+	respData["page_frist_id"] = form.Paging.First
+	respData["page_last_id"] = form.Paging.Last
+	respData["articles_without_content"] = jsonStructs
+	writeResponse(request.RequestURI, resp, respData, err)
+}
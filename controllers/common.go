@@ -119,10 +119,26 @@ func checkTokenHandler(c martini.Context, p Parameter, redis *models.RedisLogger
 	uid := redis.OnlineUser(p.TokenId())
 	if len(uid) == 0 {
 		writeResponse(r.RequestURI, w, nil, errors.NewError(errors.AccessError))
+		return
 	}
+	redis.TouchSession(p.TokenId(), ClientIp(r))
 	c.Map(&models.Account{Id: uid})
 }
 
+// the client address, the proxy headers are trusted.
+func ClientIp(r *http.Request) string {
+	if ip := r.Header.Get("X-Real-IP"); len(ip) > 0 {
+		return ip
+	}
+	if ips := r.Header.Get("X-Forwarded-For"); len(ips) > 0 {
+		return strings.TrimSpace(strings.Split(ips, ",")[0])
+	}
+	if i := strings.LastIndex(r.RemoteAddr, ":"); i > 0 {
+		return r.RemoteAddr[:i]
+	}
+	return r.RemoteAddr
+}
+
 func loadUserHandler(c martini.Context, user *models.Account, redis *models.RedisLogger, r *http.Request, w http.ResponseWriter) {
 	if find, err := user.FindByUserid(user.Id); !find {
 		if err == nil {
@@ -139,6 +155,13 @@ func checkLimitHandler(user *models.Account, r *http.Request, w http.ResponseWri
 	}
 }
 
+// guests must register before posting, chatting, creating groups and sending coins
+func checkGuestHandler(user *models.Account, r *http.Request, w http.ResponseWriter) {
+	if user.IsGuest() {
+		writeResponse(r.RequestURI, w, nil, errors.NewError(errors.AccessError, "请先注册"))
+	}
+}
+
 func userActor(actor string) string {
 	/*
 		switch actor {
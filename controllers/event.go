@@ -49,6 +49,7 @@ func eventNewsHandler(request *http.Request, resp http.ResponseWriter,
 		"new_thumb_count":     counts[2],
 		"new_reward_count":    counts[3] + counts[5],
 		"new_attention_count": counts[4],
+		"new_mention_count":   counts[6],
 	}
 
 	writeResponse(request.RequestURI, resp, respData, nil)
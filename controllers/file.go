@@ -2,12 +2,14 @@
 package controllers
 
 import (
+	"bytes"
 	"github.com/ginuerzh/sports/errors"
 	"github.com/ginuerzh/sports/models"
+	"github.com/ginuerzh/sports/storage"
 	"github.com/martini-contrib/binding"
-	weedo "gopkg.in/ginuerzh/weedo.v0"
 	"gopkg.in/go-martini/martini.v1"
-	//"io"
+	"io"
+	"io/ioutil"
 	"time"
 	//"labix.org/v2/mgo/bson"
 	"log"
@@ -20,17 +22,23 @@ const (
 	FileDeleteV1Uri    = "/1/file/del"
 )
 
-var (
-	Weedfs *weedo.Client
-	//weedfs = weedo.NewClient("localhost:9334")
-)
-
 func BindFileApi(m *martini.ClassicMartini) {
 	m.Post("/1/file/upload",
 		binding.Form(fileUploadForm{}, (*Parameter)(nil)),
 		ErrorHandler,
 		checkTokenHandler,
+		loadUserHandler,
 		fileUploadHandler)
+	m.Get("/1/file/usage",
+		binding.Form(fileUsageForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		loadUserHandler,
+		fileUsageHandler)
+	m.Get("/1/file/get",
+		binding.Form(fileDownloadForm{}),
+		ErrorHandler,
+		fileDownloadHandler)
 	//m.Post("/1/file/upload", binding.MultipartForm(fileUploadForm2{}), ErrorHandler, fileUploadHandler2)
 	//m.Get(ImageDownloadV1Uri, binding.Form(imageDownloadForm{}), ErrorHandler, imageDownloadHandler)
 	//m.Post(FileDeleteV1Uri, binding.Json(fileDeleteForm{}), ErrorHandler, fileDeleteHandler)
@@ -62,34 +70,194 @@ func fileUploadHandler(request *http.Request, resp http.ResponseWriter,
 		return
 	}
 
-	fid, length, err := Weedfs.Master().Submit(header.Filename, header.Header.Get("Content-Type"), filedata)
+	if redis.IncrUploads(user.Id) > user.UploadsPerHour() {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.UploadLimitError))
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(filedata, MaxImageSize+1))
 	if err != nil {
 		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.FileUploadError))
 		return
 	}
-	log.Println(fid, length, header.Filename, header.Header.Get("Content-Type"))
+	original, err := sanitizeImage(data)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
 
-	filedata.Seek(0, 0)
+	// the same file has been uploaded, reuse it.
+	md5 := FileMd5(bytes.NewReader(original.Data))
+	file := &models.File{}
+	if find, _ := file.FindByMd5(md5); find {
+		if err := file.Touch(); err != nil {
+			writeResponse(request.RequestURI, resp, nil, err)
+			return
+		}
+		writeResponse(request.RequestURI, resp, fileResponse(file), nil)
+		return
+	}
+
+	images, err := resizeImage(original)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	var size int64
+	for _, img := range images {
+		if !img.Shared {
+			size += int64(len(img.Data))
+		}
+	}
+	if user.StorageUsed+size > user.StorageQuota() {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.QuotaExceededError))
+		return
+	}
 
-	var file models.File
-	file.Fid = fid
 	file.Name = header.Filename
-	file.ContentType = header.Header.Get("Content-Type")
-	file.Length = length
-	file.Md5 = FileMd5(filedata)
+	file.Md5 = md5
 	file.Owner = user.Id
 	file.UploadDate = time.Now()
+	file.Variants = make(map[string]models.ImageVariant)
+
+	var fids []string
+	for _, img := range images {
+		fid := file.Fid
+		length := int64(len(img.Data))
+		if !img.Shared {
+			fid, length, err = models.Storage.Put(header.Filename, img.ContentType, bytes.NewReader(img.Data))
+			if err != nil {
+				log.Println(err)
+				for _, v := range fids {
+					models.Storage.Delete(v)
+				}
+				writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.FileUploadError))
+				return
+			}
+			fids = append(fids, fid)
+		}
+		url, _ := models.Storage.URL(fid)
+
+		if img.Name == ImageOriginal {
+			file.Fid = fid
+			file.ContentType = img.ContentType
+			file.Length = length
+			file.Width = img.Width
+			file.Height = img.Height
+		}
+		file.Variants[img.Name] = models.ImageVariant{
+			Fid:         fid,
+			Url:         url,
+			Width:       img.Width,
+			Height:      img.Height,
+			Length:      length,
+			ContentType: img.ContentType,
+		}
+	}
+	log.Println(file.Fid, file.Length, header.Filename, file.ContentType)
+
 	if err := file.Save(); err != nil {
 		writeResponse(request.RequestURI, resp, nil, err)
 		return
 	}
 
-	url, _, _ := Weedfs.GetUrl(fid)
-	respData := map[string]interface{}{"fileid": fid, "fileurl": url}
+	writeResponse(request.RequestURI, resp, fileResponse(file), nil)
+}
 
+func fileResponse(file *models.File) map[string]interface{} {
+	url, _ := models.Storage.URL(file.Fid)
+	variants := make(map[string]interface{})
+	for name, v := range file.Variants {
+		variants[name] = map[string]interface{}{
+			"fileid":  v.Fid,
+			"fileurl": v.Url,
+			"width":   v.Width,
+			"height":  v.Height,
+		}
+	}
+
+	return map[string]interface{}{
+		"fileid":   file.Fid,
+		"fileurl":  url,
+		"width":    file.Width,
+		"height":   file.Height,
+		"variants": variants,
+	}
+}
+
+type fileUsageForm struct {
+	parameter
+}
+
+func fileUsageHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account) {
+	files, err := user.FileCount()
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	respData := map[string]interface{}{
+		"used_bytes":          user.StorageUsed,
+		"quota_bytes":         user.StorageQuota(),
+		"file_count":          files,
+		"hourly_uploads":      redis.Uploads(user.Id),
+		"hourly_upload_limit": user.UploadsPerHour(),
+	}
 	writeResponse(request.RequestURI, resp, respData, nil)
 }
 
+type fileDownloadForm struct {
+	Fid string `form:"fileid" binding:"required"`
+}
+
+// the blobs are immutable, so they can be cached forever.
+func fileDownloadHandler(request *http.Request, resp http.ResponseWriter, form fileDownloadForm) {
+	file := &models.File{}
+	if find, err := file.FindByBlob(form.Fid); !find {
+		if err == nil {
+			err = errors.NewError(errors.FileNotFoundError)
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	r, err := models.Storage.Get(form.Fid)
+	if err != nil {
+		if err != storage.ErrNotFound {
+			log.Println(err)
+		}
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.FileNotFoundError))
+		return
+	}
+	defer r.Close()
+
+	contentType := file.ContentType
+	for _, v := range file.Variants {
+		if v.Fid == form.Fid {
+			contentType = v.ContentType
+			break
+		}
+	}
+	if len(contentType) > 0 {
+		resp.Header().Set("Content-Type", contentType)
+	}
+	resp.Header().Set("Cache-Control", "public, max-age=31536000")
+	resp.Header().Set("Etag", `"`+form.Fid+`"`)
+
+	if rs, ok := r.(io.ReadSeeker); ok {
+		// range and conditional requests
+		http.ServeContent(resp, request, file.Name, file.UploadDate, rs)
+		return
+	}
+
+	if request.Header.Get("If-None-Match") == `"`+form.Fid+`"` {
+		resp.WriteHeader(http.StatusNotModified)
+		return
+	}
+	io.Copy(resp, r)
+}
+
 /*
 type imageDownloadForm struct {
 	ImageId   string `form:"image_id" binding:"required"`
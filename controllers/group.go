@@ -2,7 +2,7 @@
 package controllers
 
 import (
-	//"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/errors"
 	"github.com/ginuerzh/sports/models"
 	"github.com/martini-contrib/binding"
 	"gopkg.in/go-martini/martini.v1"
@@ -10,6 +10,11 @@ import (
 	"time"
 )
 
+const (
+	GroupInviteExpire    = 7 * 24 * 60 * 60  // 1w
+	GroupInviteMaxExpire = 30 * 24 * 60 * 60 // 1mon
+)
+
 func BindGroupApi(m *martini.ClassicMartini) {
 	m.Post("/1/user/joinGroup",
 		binding.Json(joinGroupForm{}, (*Parameter)(nil)),
@@ -20,6 +25,8 @@ func BindGroupApi(m *martini.ClassicMartini) {
 		binding.Json(setGroupForm{}, (*Parameter)(nil)),
 		ErrorHandler,
 		checkTokenHandler,
+		loadUserHandler,
+		checkGuestHandler,
 		setGroupHandler)
 	m.Get("/1/user/getGroupInfo",
 		binding.Form(groupInfoForm{}),
@@ -30,36 +37,173 @@ func BindGroupApi(m *martini.ClassicMartini) {
 		ErrorHandler,
 		checkTokenHandler,
 		delGroupHandler)
+	m.Post("/1/group/invite",
+		binding.Json(groupInviteForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		groupInviteHandler)
+	m.Get("/1/group/requests",
+		binding.Form(groupRequestsForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		groupRequestsHandler)
+	m.Post("/1/group/approve",
+		binding.Json(groupApproveForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		groupApproveHandler)
+	m.Post("/1/group/kick",
+		binding.Json(groupKickForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		groupKickHandler)
+	m.Post("/1/group/unban",
+		binding.Json(groupMemberForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		groupUnbanHandler)
+	m.Post("/1/group/setAdmin",
+		binding.Json(groupAdminForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		groupAdminHandler)
+	m.Post("/1/group/transfer",
+		binding.Json(groupMemberForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		groupTransferHandler)
+	m.Get("/1/group/messages",
+		binding.Form(groupMsgsForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		groupMsgsHandler)
+	m.Post("/1/group/mute",
+		binding.Json(groupMuteForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		groupMuteHandler)
+	m.Post("/1/group/muteAll",
+		binding.Json(groupMuteAllForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		groupMuteAllHandler)
+	m.Post("/1/group/pin",
+		binding.Json(groupPinForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		groupPinHandler)
+	m.Get("/1/group/pinned",
+		binding.Form(groupPinnedForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		groupPinnedHandler)
+	m.Post("/1/group/challenge/new",
+		binding.Json(newChallengeForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		newChallengeHandler)
+	m.Post("/1/group/challenge/accept",
+		binding.Json(acceptChallengeForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		acceptChallengeHandler)
+	m.Get("/1/group/challenges",
+		binding.Form(groupChallengesForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		groupChallengesHandler)
+	m.Get("/1/group/challenge",
+		binding.Form(challengeInfoForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		challengeInfoHandler)
+}
+
+// join or leave the group in redis, the websocket connections of the user subscribe or unsubscribe the group.
+func subscribeGroup(redis *models.RedisLogger, userid, gid string, join bool) {
+	redis.JoinGroup(userid, gid, join)
+
+	event := &models.Event{
+		Type: "message",
+		Data: models.EventData{
+			From: userid,
+			To:   gid,
+		},
+	}
+	if join {
+		event.Data.Type = models.EventSub
+	} else {
+		event.Data.Type = models.EventUnsub
+	}
+	redis.PubMsg(event.Data.Type, userid, event.Bytes())
+}
+
+// load the group, the user must be the owner or an admin of the group if admin is true.
+func loadGroup(gid, userid string, admin bool) (*models.Group, error) {
+	group := &models.Group{}
+	if err := group.FindById(gid); err != nil {
+		return nil, err
+	}
+	if admin && !group.IsAdmin(userid) {
+		return nil, errors.NewError(errors.AccessError, "没有群组管理权限")
+	}
+	return group, nil
 }
 
 type joinGroupForm struct {
-	Gid   string `json:"group_id" binding:"required"`
-	Leave bool   `json:"leave"`
+	Gid     string `json:"group_id" binding:"required"`
+	Leave   bool   `json:"leave"`
+	Code    string `json:"invite_code"`
+	Message string `json:"message"`
 	parameter
 }
 
+// join the public group, request to join the group needs approval, or join by the invitation code.
 func joinGroupHandler(request *http.Request, resp http.ResponseWriter,
 	redis *models.RedisLogger, user *models.Account, p Parameter) {
 
 	form := p.(joinGroupForm)
 
-	redis.JoinGroup(user.Id, form.Gid, !form.Leave)
-	writeResponse(request.RequestURI, resp, nil, nil)
+	group, err := loadGroup(form.Gid, user.Id, false)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
 
-	event := &models.Event{
-		Type: "message",
-		Data: models.EventData{
-			From: user.Id,
-			To:   form.Gid,
-		},
+	if form.Leave {
+		if err := group.RemoveMember(user.Id, false); err != nil {
+			writeResponse(request.RequestURI, resp, nil, err)
+			return
+		}
+		subscribeGroup(redis, user.Id, group.Gid, false)
+		writeResponse(request.RequestURI, resp, nil, nil)
+		return
 	}
-	if !form.Leave {
-		event.Data.Type = "subscribe"
-	} else {
-		event.Data.Type = "unsubscribe"
+
+	if group.IsBanned(user.Id) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError, "已被禁止加入"))
+		return
+	}
+
+	invited := len(form.Code) > 0 && redis.GroupInvite(form.Code) == group.Gid
+	if len(group.Role(user.Id)) == 0 && !invited {
+		switch group.Access {
+		case models.GroupInvite:
+			writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.InviteCodeError, "需要邀请才能加入"))
+			return
+		case models.GroupApproval:
+			err := group.AddRequest(user.Id, form.Message)
+			writeResponse(request.RequestURI, resp, map[string]string{"status": "pending"}, err)
+			return
+		}
 	}
 
-	redis.PubMsg(event.Data.Type, user.Id, event.Bytes())
+	if err := group.AddMember(user.Id); err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	subscribeGroup(redis, user.Id, group.Gid, true)
+	writeResponse(request.RequestURI, resp, map[string]string{"status": "joined"}, nil)
 }
 
 type Group struct {
@@ -71,6 +215,8 @@ type Group struct {
 	Time        int64    `json:"create_time"`
 	MemberCount int      `json:"members_count"`
 	Members     []string `json:"member_ids"`
+	Admins      []string `json:"admin_ids"`
+	Access      string   `json:"group_access"`
 	Level       int      `json:"group_level"`
 	models.Address
 	models.Location
@@ -81,11 +227,25 @@ type setGroupForm struct {
 	parameter
 }
 
+func validGroupAccess(access string) bool {
+	switch access {
+	case "", models.GroupPublic, models.GroupApproval, models.GroupInvite:
+		return true
+	}
+	return false
+}
+
+// create the group, or update the group by the owner or the admins.
 func setGroupHandler(request *http.Request, resp http.ResponseWriter,
 	redis *models.RedisLogger, user *models.Account, p Parameter) {
 
 	form := p.(setGroupForm)
 
+	if !validGroupAccess(form.Access) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.JsonError, "无效的群组类型"))
+		return
+	}
+
 	group := &models.Group{
 		Gid:     form.Id,
 		Name:    form.Name,
@@ -93,22 +253,34 @@ func setGroupHandler(request *http.Request, resp http.ResponseWriter,
 		Desc:    form.Desc,
 		Creator: user.Id,
 		Time:    time.Now(),
+		Access:  form.Access,
 	}
 
+	if form.Lat != 0 || form.Lng != 0 {
+		loc := form.Location
+		group.Loc = &loc
+	}
 	if form.Address.String() != "" {
 		group.Addr = &form.Address
-		loc := models.Addr2Loc(form.Address)
-		group.Loc = &loc
+		if loc := models.Addr2Loc(form.Address); group.Loc == nil && (loc.Lat != 0 || loc.Lng != 0) {
+			group.Loc = &loc
+		}
+	} else if group.Loc != nil {
+		if addr := models.Loc2Addr(*group.Loc); addr.String() != "" {
+			group.Addr = &addr
+		}
 	}
 
 	var err error
 	if len(form.Id) == 0 {
 		err = group.Save()
 		if err == nil {
-			redis.JoinGroup(user.Id, group.Gid, true)
+			subscribeGroup(redis, user.Id, group.Gid, true)
 		}
 	} else {
-		err = group.Update()
+		if _, err = loadGroup(form.Id, user.Id, true); err == nil {
+			err = group.Update()
+		}
 	}
 
 	writeResponse(request.RequestURI, resp, map[string]string{"group_id": group.Gid}, err)
@@ -122,7 +294,10 @@ type groupInfoForm struct {
 func groupInfoHandler(request *http.Request, resp http.ResponseWriter, form groupInfoForm) {
 
 	group := &models.Group{}
-	err := group.FindById(form.Gid)
+	if err := group.FindById(form.Gid); err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
 
 	grp := &Group{
 		Id:          group.Gid,
@@ -133,12 +308,21 @@ func groupInfoHandler(request *http.Request, resp http.ResponseWriter, form grou
 		Time:        group.Time.Unix(),
 		MemberCount: len(group.Members),
 		Members:     group.Members,
+		Admins:      group.Admins,
+		Access:      group.Access,
 		Level:       group.Level,
-		Address:     *group.Addr,
-		Location:    *group.Loc,
+	}
+	if len(grp.Access) == 0 {
+		grp.Access = models.GroupPublic
+	}
+	if group.Addr != nil {
+		grp.Address = *group.Addr
+	}
+	if group.Loc != nil {
+		grp.Location = *group.Loc
 	}
 
-	writeResponse(request.RequestURI, resp, grp, err)
+	writeResponse(request.RequestURI, resp, grp, nil)
 }
 
 type groupDelForm struct {
@@ -146,13 +330,230 @@ type groupDelForm struct {
 	parameter
 }
 
+// the group can only be deleted by the owner
 func delGroupHandler(request *http.Request, resp http.ResponseWriter,
 	redis *models.RedisLogger, user *models.Account, p Parameter) {
 
 	form := p.(groupDelForm)
 
-	group := &models.Group{Gid: form.Gid}
-	group.Remove(user.Id)
+	group, err := loadGroup(form.Gid, user.Id, false)
+	if err == nil {
+		err = group.Remove(user.Id)
+	}
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	for _, member := range redis.GroupMembers(group.Gid) {
+		subscribeGroup(redis, member, group.Gid, false)
+	}
+
+	writeResponse(request.RequestURI, resp, nil, nil)
+}
+
+type groupInviteForm struct {
+	Gid    string `json:"group_id" binding:"required"`
+	Expire int    `json:"expire"` // in seconds
+	parameter
+}
+
+// create the invitation code of the group, anyone with the code can join the group before it expires.
+func groupInviteHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(groupInviteForm)
+
+	group, err := loadGroup(form.Gid, user.Id, true)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	expire := form.Expire
+	if expire <= 0 {
+		expire = GroupInviteExpire
+	}
+	if expire > GroupInviteMaxExpire {
+		expire = GroupInviteMaxExpire
+	}
+	code := Uuid()
+	redis.SetGroupInvite(code, group.Gid, expire)
+
+	respData := map[string]interface{}{
+		"invite_code": code,
+		"expire_time": time.Now().Unix() + int64(expire),
+	}
+	writeResponse(request.RequestURI, resp, respData, nil)
+}
+
+type groupRequestsForm struct {
+	Gid string `form:"group_id" binding:"required"`
+	parameter
+}
+
+type groupRequestJsonStruct struct {
+	Userid   string `json:"userid"`
+	Nickname string `json:"nikename"`
+	Profile  string `json:"user_profile_image"`
+	Message  string `json:"message"`
+	Time     int64  `json:"time"`
+}
+
+func groupRequestsHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(groupRequestsForm)
+
+	group, err := loadGroup(form.Gid, user.Id, true)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	ids := make([]string, len(group.Requests))
+	for i, req := range group.Requests {
+		ids[i] = req.Userid
+	}
+	users, _ := models.FindUsers(ids)
+
+	list := make([]groupRequestJsonStruct, len(group.Requests))
+	for i, req := range group.Requests {
+		list[i] = groupRequestJsonStruct{
+			Userid:  req.Userid,
+			Message: req.Message,
+			Time:    req.Time.Unix(),
+		}
+		for j, _ := range users {
+			if users[j].Id == req.Userid {
+				list[i].Nickname = users[j].Nickname
+				list[i].Profile = users[j].Profile
+				break
+			}
+		}
+	}
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"requests": list}, nil)
+}
+
+type groupApproveForm struct {
+	Gid    string `json:"group_id" binding:"required"`
+	Userid string `json:"userid" binding:"required"`
+	Reject bool   `json:"reject"`
+	parameter
+}
+
+func groupApproveHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(groupApproveForm)
 
+	group, err := loadGroup(form.Gid, user.Id, true)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	if group.Request(form.Userid) == nil {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.NotExistsError, "申请不存在"))
+		return
+	}
+
+	if form.Reject {
+		err = group.RemoveRequest(form.Userid)
+	} else if err = group.AddMember(form.Userid); err == nil {
+		subscribeGroup(redis, form.Userid, group.Gid, true)
+	}
+	writeResponse(request.RequestURI, resp, nil, err)
+}
+
+type groupKickForm struct {
+	Gid    string `json:"group_id" binding:"required"`
+	Userid string `json:"userid" binding:"required"`
+	Ban    bool   `json:"ban"`
+	parameter
+}
+
+// remove the member from the group, the admins can only be removed by the owner.
+func groupKickHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(groupKickForm)
+
+	group, err := loadGroup(form.Gid, user.Id, true)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	switch group.Role(form.Userid) {
+	case models.GroupOwner:
+		err = errors.NewError(errors.AccessError)
+	case models.GroupAdmin:
+		if group.Role(user.Id) != models.GroupOwner {
+			err = errors.NewError(errors.AccessError)
+		}
+	}
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	if err := group.RemoveMember(form.Userid, form.Ban); err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	subscribeGroup(redis, form.Userid, group.Gid, false)
 	writeResponse(request.RequestURI, resp, nil, nil)
 }
+
+type groupMemberForm struct {
+	Gid    string `json:"group_id" binding:"required"`
+	Userid string `json:"userid" binding:"required"`
+	parameter
+}
+
+func groupUnbanHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(groupMemberForm)
+
+	group, err := loadGroup(form.Gid, user.Id, true)
+	if err == nil {
+		err = group.Unban(form.Userid)
+	}
+	writeResponse(request.RequestURI, resp, nil, err)
+}
+
+type groupAdminForm struct {
+	Gid    string `json:"group_id" binding:"required"`
+	Userid string `json:"userid" binding:"required"`
+	Admin  bool   `json:"admin"`
+	parameter
+}
+
+// set or unset the admin by the owner
+func groupAdminHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(groupAdminForm)
+
+	group, err := loadGroup(form.Gid, user.Id, false)
+	if err == nil && group.Role(user.Id) != models.GroupOwner {
+		err = errors.NewError(errors.AccessError)
+	}
+	if err == nil && form.Userid != user.Id {
+		err = group.SetAdmin(form.Userid, form.Admin)
+	}
+	writeResponse(request.RequestURI, resp, nil, err)
+}
+
+// transfer the ownership of the group to the member
+func groupTransferHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(groupMemberForm)
+
+	group, err := loadGroup(form.Gid, user.Id, false)
+	if err == nil {
+		err = group.Transfer(user.Id, form.Userid)
+	}
+	writeResponse(request.RequestURI, resp, nil, err)
+}
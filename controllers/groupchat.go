@@ -0,0 +1,187 @@
+// groupchat
+package controllers
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/models"
+	"net/http"
+	"time"
+)
+
+// save the message of the group and publish it to the members.
+func sendGroupMsg(redis *models.RedisLogger, user *models.Account, gid string, body []models.MsgBody) (*models.Message, error) {
+	group, err := loadGroup(gid, user.Id, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := group.CanSend(user.Id, body); err != nil {
+		return nil, err
+	}
+
+	msg := &models.Message{
+		From: user.Id,
+		To:   group.Gid,
+		Body: body,
+		Type: models.EventGChat,
+		Time: time.Now(),
+	}
+	if err := msg.Save(); err != nil {
+		return nil, err
+	}
+
+	// ws push
+	event := &models.Event{
+		Type: models.EventMsg,
+		Time: msg.Time.Unix(),
+		Data: models.EventData{
+			Type: models.EventGChat,
+			Id:   msg.Id.Hex(),
+			From: user.Id,
+			To:   group.Gid,
+			Body: body,
+		},
+	}
+	redis.PubMsg(models.EventGChat, group.Gid, event.Bytes())
+
+	return msg, nil
+}
+
+type groupMsgsForm struct {
+	Gid string `form:"group_id" binding:"required"`
+	models.Paging
+	parameter
+}
+
+// the message history of the group, for the members only.
+func groupMsgsHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(groupMsgsForm)
+
+	group, err := loadGroup(form.Gid, user.Id, false)
+	if err == nil && len(group.Role(user.Id)) == 0 {
+		err = errors.NewError(errors.AccessError, "不是群组成员")
+	}
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	_, msgs, err := group.Messages(&form.Paging)
+	jsonStructs := make([]*msgJsonStruct, len(msgs))
+	for i, _ := range msgs {
+		jsonStructs[i] = convertMsg(&msgs[i])
+	}
+
+	respData := make(map[string]interface{})
+	respData["page_frist_id"] = form.Paging.First
+	respData["page_last_id"] = form.Paging.Last
+	respData["messages"] = jsonStructs
+	writeResponse(request.RequestURI, resp, respData, err)
+}
+
+type groupMuteForm struct {
+	Gid      string `json:"group_id" binding:"required"`
+	Userid   string `json:"userid" binding:"required"`
+	Duration int64  `json:"duration"` // in seconds, 0 to unmute
+	parameter
+}
+
+// mute the member for the duration, the owner and the admins can't be muted.
+func groupMuteHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(groupMuteForm)
+
+	group, err := loadGroup(form.Gid, user.Id, true)
+	if err == nil && group.Role(form.Userid) != models.GroupMember {
+		err = errors.NewError(errors.AccessError)
+	}
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	var until time.Time
+	if form.Duration > 0 {
+		until = time.Now().Add(time.Duration(form.Duration) * time.Second)
+	}
+	if err := group.Mute(form.Userid, until); err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	respData := map[string]interface{}{}
+	if !until.IsZero() {
+		respData["mute_until"] = until.Unix()
+	}
+	writeResponse(request.RequestURI, resp, respData, nil)
+}
+
+type groupMuteAllForm struct {
+	Gid  string `json:"group_id" binding:"required"`
+	Mute bool   `json:"mute"`
+	parameter
+}
+
+func groupMuteAllHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(groupMuteAllForm)
+
+	group, err := loadGroup(form.Gid, user.Id, true)
+	if err == nil {
+		err = group.SetMuteAll(form.Mute)
+	}
+	writeResponse(request.RequestURI, resp, nil, err)
+}
+
+type groupPinForm struct {
+	Gid   string `json:"group_id" binding:"required"`
+	Msgid string `json:"message_id" binding:"required"`
+	Unpin bool   `json:"unpin"`
+	parameter
+}
+
+// pin the message of the group as the announcement
+func groupPinHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(groupPinForm)
+
+	group, err := loadGroup(form.Gid, user.Id, true)
+	if err == nil && !form.Unpin {
+		_, err = group.Message(form.Msgid)
+	}
+	if err == nil {
+		err = group.Pin(form.Msgid, !form.Unpin)
+	}
+	writeResponse(request.RequestURI, resp, nil, err)
+}
+
+type groupPinnedForm struct {
+	Gid string `form:"group_id" binding:"required"`
+	parameter
+}
+
+func groupPinnedHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+
+	form := p.(groupPinnedForm)
+
+	group, err := loadGroup(form.Gid, user.Id, false)
+	if err == nil && len(group.Role(user.Id)) == 0 {
+		err = errors.NewError(errors.AccessError, "不是群组成员")
+	}
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	msgs, err := group.PinnedMessages()
+	jsonStructs := make([]*msgJsonStruct, len(msgs))
+	for i, _ := range msgs {
+		jsonStructs[i] = convertMsg(&msgs[i])
+	}
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"messages": jsonStructs}, err)
+}
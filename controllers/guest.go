@@ -0,0 +1,157 @@
+// guest
+package controllers
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/models"
+	"labix.org/v2/mgo/bson"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	GuestLoginsPerHour = 5 // the max guests created from an ip in an hour
+)
+
+// the guest account is saved, so the records and tasks of the guest are kept until it is upgraded or expired.
+func guestLogin(ip string, redis *models.RedisLogger) (bool, *models.Account, error) {
+	if redis.IncrGuestLogins(ip) > GuestLoginsPerHour {
+		return false, nil, errors.NewError(errors.GuestLimitError)
+	}
+
+	user := &models.Account{Nickname: "游客"}
+	dbw, err := getNewWallet()
+	if err != nil {
+		return true, nil, errors.NewError(errors.DbError, "wallet: "+err.Error())
+	}
+	user.Wallet = *dbw
+	if err := user.SaveGuest(); err != nil {
+		return true, nil, err
+	}
+	return true, user, nil
+}
+
+type upgradeForm struct {
+	Type     string `json:"account_type"` // weibo, weixin or qq, empty for email or phone
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Code     string `json:"verifycode"` // the sms code of the phone or the token of the third-party account
+	Uid      string `json:"userid"`
+	Nickname string `json:"nikename"`
+	parameter
+}
+
+// upgrade the guest to the registered account, the data of the guest is kept.
+func upgradeHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+	form := p.(upgradeForm)
+
+	if !user.IsGuest() {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError, "非游客账号"))
+		return
+	}
+
+	change := bson.M{}
+	role := "usrpass"
+	var identity *models.Identity
+
+	switch form.Type {
+	case "weibo", "weixin", "qq":
+		provider, uid, err := verifyOAuth(form.Type, form.Uid, form.Code)
+		if err != nil {
+			writeResponse(request.RequestURI, resp, nil, err)
+			return
+		}
+		identity = &models.Identity{}
+		// the identity kept for the imported friend is handed over when it's saved
+		if find, _ := identity.FindByUid(form.Type, uid); find {
+			if registered, err := identity.Registered(); registered || err != nil {
+				if err == nil {
+					err = errors.NewError(errors.UserExistError)
+				}
+				writeResponse(request.RequestURI, resp, nil, err)
+				return
+			}
+		}
+		profile, err := provider.Profile(uid, form.Code)
+		if err != nil {
+			writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.HttpError, err.Error()))
+			return
+		}
+		u := &models.Account{}
+		setOAuthProfile(u, profile)
+		change["nickname"] = u.Nickname
+		change["gender"] = u.Gender
+		change["url"] = u.Url
+		change["about"] = u.About
+		if len(u.Profile) > 0 && len(user.Profile) == 0 {
+			change["profile"] = u.Profile
+		}
+		role = form.Type
+		identity.Provider = form.Type
+		identity.Uid = uid
+		identity.Token = form.Code
+	default:
+		if len(form.Email) == 0 || len(form.Password) < MinPasswordLength {
+			writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.PasswordError))
+			return
+		}
+		u := &models.Account{}
+		t := ""
+		if phone, _ := strconv.ParseUint(form.Email, 10, 64); phone > 0 {
+			u.Phone = form.Email
+			t = "phone"
+		} else {
+			u.Email = strings.ToLower(form.Email)
+			t = "email"
+		}
+		if exists, _ := u.Exists(t); exists {
+			writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.UserExistError))
+			return
+		}
+		if t == "phone" {
+			if !redis.CheckVerifyCode(VerifyRegister, u.Phone, form.Code) {
+				writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.VerifyCodeError))
+				return
+			}
+			change["phone"] = u.Phone
+		} else {
+			change["email"] = u.Email
+		}
+
+		password, err := models.HashPassword(form.Password)
+		if err != nil {
+			writeResponse(request.RequestURI, resp, nil, err)
+			return
+		}
+		change["password"] = password
+	}
+	if len(form.Nickname) > 0 {
+		change["nickname"] = form.Nickname
+	}
+
+	// link the identity first, the upgraded account can't login without it
+	if identity != nil {
+		identity.Userid = user.Id
+		if err := identity.Save(); err != nil {
+			writeResponse(request.RequestURI, resp, nil, err)
+			return
+		}
+	}
+	if err := user.Upgrade(role, change); err != nil {
+		if identity != nil {
+			if err := models.RemoveIdentity(user.Id, identity.Provider); err != nil {
+				log.Println(err)
+			}
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	redis.LogRegister(user.Id)
+	// ws push
+	regNotice(user.Id, redis)
+
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"userid": user.Id, "register": true}, nil)
+}
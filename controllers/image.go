@@ -0,0 +1,434 @@
+// image
+package controllers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/ginuerzh/sports/errors"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	MaxImageSize      = 10 << 20 // 10M
+	MaxImageDimension = 8192
+	MaxImagePixels    = 32 << 20
+
+	ImageThumb    = "thumb"
+	ImageMedium   = "medium"
+	ImageOriginal = "original"
+
+	imageQuality = 85
+)
+
+var imageVariantSizes = []struct {
+	Name string
+	Size int
+}{
+	{ImageThumb, 240},
+	{ImageMedium, 1080},
+}
+
+type imageVariant struct {
+	Name        string
+	Shared      bool // same data as the original
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// validate the uploaded image and strip the metadata, the original is returned.
+func sanitizeImage(data []byte) (*imageVariant, error) {
+	if len(data) > MaxImageSize {
+		return nil, errors.NewError(errors.FileTooLargeError)
+	}
+
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return nil, errors.NewError(errors.InvalidFileError, "unsupported image type")
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.NewError(errors.InvalidFileError, err.Error())
+	}
+	if config.Width > MaxImageDimension || config.Height > MaxImageDimension ||
+		config.Width*config.Height > MaxImagePixels {
+		return nil, errors.NewError(errors.FileTooLargeError, "image dimension too large")
+	}
+
+	orientation := 1
+	switch contentType {
+	case "image/jpeg":
+		data, orientation = stripJpeg(data)
+	case "image/png":
+		data = stripPng(data)
+	case "image/webp":
+		data = stripWebp(data)
+	case "image/gif":
+		data = stripGif(data)
+	}
+
+	original := &imageVariant{
+		Name:        ImageOriginal,
+		Data:        data,
+		ContentType: contentType,
+		Width:       config.Width,
+		Height:      config.Height,
+	}
+	// the orientation is lost with the exif, so apply it to the pixels.
+	if orientation > 1 {
+		src, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.NewError(errors.InvalidFileError, err.Error())
+		}
+		src = orient(src, orientation)
+		if original.Data, err = encodeImage(src, contentType); err != nil {
+			return nil, err
+		}
+		original.Width, original.Height = src.Bounds().Dx(), src.Bounds().Dy()
+	}
+
+	return original, nil
+}
+
+// make the resized variants of the sanitized original.
+// The variants share the data of the original if the original is small enough.
+func resizeImage(original *imageVariant) ([]imageVariant, error) {
+	src, _, err := image.Decode(bytes.NewReader(original.Data))
+	if err != nil {
+		return nil, errors.NewError(errors.InvalidFileError, err.Error())
+	}
+	contentType := original.ContentType
+
+	variants := []imageVariant{*original}
+	for _, vs := range imageVariantSizes {
+		w, h := original.Width, original.Height
+		if w <= vs.Size && h <= vs.Size {
+			v := *original
+			v.Name = vs.Name
+			v.Shared = true
+			variants = append(variants, v)
+			continue
+		}
+		if w > h {
+			w, h = vs.Size, h*vs.Size/w
+		} else {
+			w, h = w*vs.Size/h, vs.Size
+		}
+		if w == 0 {
+			w = 1
+		}
+		if h == 0 {
+			h = 1
+		}
+
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+		b, err := encodeImage(dst, contentType)
+		if err != nil {
+			return nil, err
+		}
+		ct := "image/jpeg"
+		if contentType == "image/png" || contentType == "image/gif" {
+			ct = "image/png"
+		}
+		variants = append(variants, imageVariant{
+			Name:        vs.Name,
+			Data:        b,
+			ContentType: ct,
+			Width:       w,
+			Height:      h,
+		})
+	}
+
+	return variants, nil
+}
+
+// png keeps the transparency, others are encoded as jpeg.
+func encodeImage(img image.Image, contentType string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	var err error
+	if contentType == "image/png" || contentType == "image/gif" {
+		err = png.Encode(buf, img)
+	} else {
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: imageQuality})
+	}
+	if err != nil {
+		return nil, errors.NewError(errors.FileUploadError, err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+// remove the APP1 (exif, xmp) and APP13 (iptc) segments, and return the exif orientation.
+func stripJpeg(data []byte) ([]byte, int) {
+	orientation := 1
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data, orientation
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(data[:2])
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return data, 1
+		}
+		marker := data[i+1]
+		// start of scan, the rest is image data
+		if marker == 0xDA {
+			break
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0xFF {
+			buf.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			return data, 1
+		}
+		segment := data[i : i+2+n]
+		switch marker {
+		case 0xE1:
+			if o := exifOrientation(segment[4:]); o > 0 {
+				orientation = o
+			}
+		case 0xED:
+		default:
+			buf.Write(segment)
+		}
+		i += 2 + n
+	}
+	buf.Write(data[i:])
+
+	return buf.Bytes(), orientation
+}
+
+func exifOrientation(b []byte) int {
+	if len(b) < 14 || string(b[:6]) != "Exif\x00\x00" {
+		return 0
+	}
+	tiff := b[6:]
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 0
+			}
+			return o
+		}
+	}
+	return 0
+}
+
+// transform the image according to the exif orientation
+func orient(img image.Image, orientation int) image.Image {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// remove the text, time and exif chunks
+func stripPng(data []byte) []byte {
+	if len(data) < 8 {
+		return data
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(data[:8])
+	i := 8
+	for i+12 <= len(data) {
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		if n < 0 || i+12+n > len(data) {
+			return data
+		}
+		switch string(data[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			buf.Write(data[i : i+12+n])
+		}
+		i += 12 + n
+	}
+
+	return buf.Bytes()
+}
+
+// remove the EXIF and XMP chunks
+func stripWebp(data []byte) []byte {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return data
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(data[:12])
+	i := 12
+	for i+8 <= len(data) {
+		n := int(binary.LittleEndian.Uint32(data[i+4:]))
+		size := 8 + n + n%2
+		if n < 0 || i+size > len(data) {
+			return data
+		}
+		chunk := data[i : i+size]
+		switch string(chunk[:4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			c := make([]byte, len(chunk))
+			copy(c, chunk)
+			if len(c) > 8 {
+				c[8] &^= 0x08 | 0x04
+			}
+			buf.Write(c)
+		default:
+			buf.Write(chunk)
+		}
+		i += size
+	}
+
+	b := buf.Bytes()
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)-8))
+	return b
+}
+
+// the length of the data sub-blocks at the beginning of b, including the block terminator
+func gifSubBlocks(b []byte) int {
+	i := 0
+	for i < len(b) {
+		n := int(b[i])
+		if n == 0 {
+			return i + 1
+		}
+		i += 1 + n
+	}
+	return -1
+}
+
+// remove the comment extensions and the application extensions except the animation loop (XMP etc.)
+func stripGif(data []byte) []byte {
+	if len(data) < 13 {
+		return data
+	}
+
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (uint(flags&0x07) + 1)
+	}
+	if i > len(data) {
+		return data
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(data[:i])
+	for i < len(data) {
+		switch data[i] {
+		case 0x2C: // image descriptor
+			start := i
+			if i+10 > len(data) {
+				return data
+			}
+			if flags := data[i+9]; flags&0x80 != 0 {
+				i += 3 << (uint(flags&0x07) + 1)
+			}
+			i += 10 + 1 // the lzw minimum code size
+			if i > len(data) {
+				return data
+			}
+			n := gifSubBlocks(data[i:])
+			if n < 0 {
+				return data
+			}
+			i += n
+			buf.Write(data[start:i])
+		case 0x21: // extension
+			if i+2 > len(data) {
+				return data
+			}
+			label := data[i+1]
+			n := gifSubBlocks(data[i+2:])
+			if n < 0 {
+				return data
+			}
+			block := data[i : i+2+n]
+			keep := label != 0xFE
+			if label == 0xFF {
+				app := block[2:]
+				keep = len(app) >= 12 && app[0] == 11 &&
+					(string(app[1:12]) == "NETSCAPE2.0" || string(app[1:12]) == "ANIMEXTS1.0")
+			}
+			if keep {
+				buf.Write(block)
+			}
+			i += 2 + n
+		case 0x3B: // trailer
+			buf.WriteByte(0x3B)
+			return buf.Bytes()
+		default:
+			return data
+		}
+	}
+
+	return buf.Bytes()
+}
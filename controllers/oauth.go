@@ -0,0 +1,181 @@
+// oauth
+package controllers
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/models"
+	"github.com/ginuerzh/sports/oauth"
+	"log"
+	"net/http"
+	"time"
+)
+
+// verify the token of the provider, it returns the verified uid.
+func verifyOAuth(provider, uid, token string) (oauth.Provider, string, error) {
+	p, err := oauth.Get(provider)
+	if err != nil {
+		return nil, "", errors.NewError(errors.UnimplementedError)
+	}
+	verified, err := p.Verify(uid, token)
+	if err != nil {
+		log.Println(err)
+		return nil, "", errors.NewError(errors.AuthError, "第三方账号验证失败")
+	}
+	return p, verified, nil
+}
+
+func setOAuthProfile(user *models.Account, profile *oauth.Profile) {
+	user.Nickname = profile.Nickname
+	user.Gender = profile.Gender
+	user.Url = profile.Url
+	user.Profile = profile.Avatar
+	if len(profile.Location) > 0 {
+		user.Addr = &models.Address{Desc: profile.Location}
+	}
+	user.About = profile.About
+}
+
+// login with the third-party account, the account is registered at the first login.
+func oauthLogin(provider, uid, token string, redis *models.RedisLogger) (bool, *models.Account, error) {
+	p, uid, err := verifyOAuth(provider, uid, token)
+	if err != nil {
+		return false, nil, err
+	}
+
+	user := &models.Account{}
+	identity := &models.Identity{}
+	find, err := identity.FindByUid(provider, uid)
+	if err != nil {
+		return false, nil, err
+	}
+	if find {
+		if found, err := user.FindByUserid(identity.Userid); !found {
+			if err == nil {
+				err = errors.NewError(errors.NotExistsError)
+			}
+			return false, nil, err
+		}
+	}
+
+	// imported friends are not registered
+	registered := find && user.RegTime.Unix() > 0
+	if !registered {
+		profile, err := p.Profile(uid, token)
+		if err != nil {
+			log.Println(err)
+			return false, nil, errors.NewError(errors.HttpError, err.Error())
+		}
+		setOAuthProfile(user, profile)
+		user.Role = provider
+		user.RegTime = time.Now()
+
+		dbw, err := getNewWallet()
+		if err != nil {
+			return true, nil, errors.NewError(errors.DbError, "wallet: "+err.Error())
+		}
+		user.Wallet = *dbw
+
+		if !find {
+			err = user.Save()
+		} else {
+			err = user.Update()
+		}
+		if err != nil {
+			return true, nil, err
+		}
+		redis.LogRegister(user.Id)
+
+		// ws push
+		regNotice(user.Id, redis)
+	}
+
+	identity.Provider = provider
+	identity.Uid = uid
+	identity.Userid = user.Id
+	identity.Token = token
+	if err := identity.Save(); err != nil {
+		return !registered, nil, err
+	}
+
+	return !registered, user, nil
+}
+
+type identityJsonStruct struct {
+	Type string `json:"account_type"`
+	Uid  string `json:"userid"`
+	Time int64  `json:"link_time"`
+}
+
+type identitiesForm struct {
+	parameter
+}
+
+func identitiesHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account) {
+	ids, err := models.Identities(user.Id)
+	list := make([]identityJsonStruct, len(ids))
+	for i, id := range ids {
+		list[i] = identityJsonStruct{Type: id.Provider, Uid: id.Uid, Time: id.Time.Unix()}
+	}
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"accounts": list}, err)
+}
+
+type linkForm struct {
+	Type  string `json:"account_type" binding:"required"`
+	Uid   string `json:"userid"`
+	Token string `json:"verfiycode" binding:"required"`
+	parameter
+}
+
+func linkHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+	form := p.(linkForm)
+
+	_, uid, err := verifyOAuth(form.Type, form.Uid, form.Token)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	linked := &models.Identity{}
+	if find, _ := linked.FindByUser(form.Type, user.Id); find && linked.Uid != uid {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.UserExistError, "已绑定其他账号"))
+		return
+	}
+
+	identity := &models.Identity{
+		Provider: form.Type,
+		Uid:      uid,
+		Userid:   user.Id,
+		Token:    form.Token,
+	}
+	if err := identity.Save(); err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	writeResponse(request.RequestURI, resp, identityJsonStruct{Type: identity.Provider, Uid: identity.Uid, Time: identity.Time.Unix()}, nil)
+}
+
+type unlinkForm struct {
+	Type string `json:"account_type" binding:"required"`
+	parameter
+}
+
+// the last identity can't be unlinked if the user can't login by password or phone.
+func unlinkHandler(request *http.Request, resp http.ResponseWriter,
+	user *models.Account, p Parameter) {
+	form := p.(unlinkForm)
+
+	ids, err := models.Identities(user.Id)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	if len(ids) <= 1 && len(user.Phone) == 0 && (len(user.Password) == 0 || len(user.Email) == 0) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError, "请先绑定手机或设置密码"))
+		return
+	}
+
+	err = models.RemoveIdentity(user.Id, form.Type)
+	writeResponse(request.RequestURI, resp, nil, err)
+}
@@ -0,0 +1,136 @@
+// password
+package controllers
+
+import (
+	"fmt"
+	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/mail"
+	"github.com/ginuerzh/sports/models"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	VerifyReset = "reset"
+
+	MinPasswordLength = 6
+)
+
+var (
+	// it's set by the -mail flag, the console sender is for development only
+	MailSender mail.Sender
+)
+
+type forgotPasswordForm struct {
+	Userid string `json:"userid" binding:"required"`
+}
+
+// send the reset code by sms for phone, or the reset token by email.
+// The response is the same for the unknown users, so it can not be used to probe the accounts.
+func forgotPasswordHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, form forgotPasswordForm) {
+	userid := strings.ToLower(form.Userid)
+	if !redis.VerifyCodeAllowed(userid, ClientIp(request)) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.VerifyCodeLimitError))
+		return
+	}
+
+	byPhone := validPhone(userid)
+	code := verifyCode()
+	if !byPhone {
+		code = strings.Replace(Uuid(), "-", "", -1)
+	}
+	if !redis.SetVerifyCode(VerifyReset, userid, code) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.VerifyCodeLimitError))
+		return
+	}
+
+	user := &models.Account{}
+	if find, err := user.FindByLogin(userid); !find {
+		if err != nil {
+			log.Println(err)
+		}
+		writeResponse(request.RequestURI, resp, map[string]interface{}{"expire": models.VerifyCodeExpire}, nil)
+		return
+	}
+
+	var err error
+	if byPhone {
+		err = SmsSender.Send(userid, fmt.Sprintf("您正在重置密码，验证码是%s，%d分钟内有效。", code, models.VerifyCodeExpire/60))
+	} else {
+		err = MailSender.Send(userid, "重置密码",
+			fmt.Sprintf("您正在重置密码，重置令牌是%s，%d分钟内有效。", code, models.VerifyCodeExpire/60))
+	}
+	if err != nil {
+		log.Println(err)
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.HttpError, "发送失败"))
+		return
+	}
+
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"expire": models.VerifyCodeExpire}, nil)
+}
+
+type resetPasswordForm struct {
+	Userid   string `json:"userid" binding:"required"`
+	Code     string `json:"verifycode" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+func resetPasswordHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, form resetPasswordForm) {
+	if len(form.Password) < MinPasswordLength {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.PasswordError))
+		return
+	}
+
+	userid := strings.ToLower(form.Userid)
+	if !redis.CheckVerifyCode(VerifyReset, userid, form.Code) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.VerifyCodeError))
+		return
+	}
+
+	user := &models.Account{}
+	if find, err := user.FindByLogin(userid); !find {
+		if err == nil {
+			err = errors.NewError(errors.NotExistsError)
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	if err := user.ChangePassword(form.Password); err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	redis.RevokeSessions(user.Id, "")
+	writeResponse(request.RequestURI, resp, nil, nil)
+}
+
+type changePasswordForm struct {
+	Old      string `json:"old_password" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	parameter
+}
+
+func changePasswordHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+	form := p.(changePasswordForm)
+
+	if !user.CheckPassword(form.Old) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AuthError, "原密码错误"))
+		return
+	}
+	if len(form.Password) < MinPasswordLength {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.PasswordError))
+		return
+	}
+
+	if err := user.ChangePassword(form.Password); err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	// keep the current session only
+	redis.RevokeSessions(user.Id, redis.TokenSession(form.Token))
+	writeResponse(request.RequestURI, resp, nil, nil)
+}
@@ -61,7 +61,14 @@ func wsPushHandler(request *http.Request, resp http.ResponseWriter, redisLogger
 		return
 	}
 
-	user := &models.Account{Id: uid}
+	user := &models.Account{}
+	if find, _ := user.FindByUserid(uid); !find {
+		return
+	}
+	sid := redisLogger.TokenSession(auth.Token)
+	if len(sid) == 0 {
+		return
+	}
 
 	redisLogger.SetOnline(user.Id)
 	redisLogger.LogVisitor(user.Id)
@@ -90,7 +97,16 @@ func wsPushHandler(request *http.Request, resp http.ResponseWriter, redisLogger
 					Body: event.Data.Body,
 					Time: time.Now(),
 				}
-				if event.Data.Type == models.EventChat || event.Data.Type == models.EventGChat {
+				if user.IsGuest() { // guests can't chat
+					break
+				}
+				if event.Data.Type == models.EventGChat {
+					if _, err := sendGroupMsg(redisLogger, user, event.Data.To, event.Data.Body); err != nil {
+						log.Println(err)
+					}
+					break
+				}
+				if event.Data.Type == models.EventChat {
 					m.Type = event.Data.Type
 					m.Save()
 					event.Data.Id = m.Id.Hex()
@@ -137,6 +153,15 @@ func wsPushHandler(request *http.Request, resp http.ResponseWriter, redisLogger
 				continue
 			}
 
+			// the session is revoked
+			if event.Type == models.EventRevoke {
+				if event.Data.Id == sid {
+					conn.WriteMessage(websocket.TextMessage, v.Data)
+					return
+				}
+				continue
+			}
+
 			// subscribe group
 			if event.Data.Type == models.EventSub && event.Data.From == user.Id {
 				if err := redisLogger.Subscribe(psc, event.Data.To); err != nil {
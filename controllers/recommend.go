@@ -0,0 +1,150 @@
+// recommend
+package controllers
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"github.com/ginuerzh/sports/models"
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	RecommendMax    = 50    // the recommendations kept for a user
+	RecommendRadius = 50000 // the nearby users are within 50km
+	RecommendHour   = 3     // the recommendations are precomputed at 3am
+)
+
+type suggestion struct {
+	score  float64
+	reason string
+	weight float64 // the score of the reason
+}
+
+type suggestions map[string]*suggestion
+
+// add the score to the user, the reason of the highest score is kept.
+func (s suggestions) add(userid string, score float64, reason string) {
+	sg, ok := s[userid]
+	if !ok {
+		sg = &suggestion{}
+		s[userid] = sg
+	}
+	sg.score += score
+	if score > sg.weight {
+		sg.weight = score
+		sg.reason = reason
+	}
+}
+
+type rankedUsers struct {
+	ids []string
+	s   suggestions
+}
+
+func (r rankedUsers) Len() int           { return len(r.ids) }
+func (r rankedUsers) Less(i, j int) bool { return r.s[r.ids[i]].score > r.s[r.ids[j]].score }
+func (r rankedUsers) Swap(i, j int)      { r.ids[i], r.ids[j] = r.ids[j], r.ids[i] }
+
+// Rank the users the user may know, by the imported weibo friends, the follows of the follows, the shared groups,
+// the nearby users and the users running alike. The followed, blacklisted and dismissed users are excluded.
+func recommendUsers(redis *models.RedisLogger, user *models.Account) ([]string, map[string]string) {
+	excludes := append(redis.Friends(models.RelFollowing, user.Id), user.Id)
+	excludes = append(excludes, redis.Friends(models.RelBlacklist, user.Id)...)
+	excludes = append(excludes, redis.Dismissed(user.Id)...)
+
+	s := suggestions{}
+	for _, id := range redis.Friends("weibo", user.Id) {
+		s.add(id, 10, "微博好友")
+	}
+	for _, kv := range redis.FollowsOfFollows(user.Id, RecommendMax*2) {
+		s.add(kv.K, float64(3*kv.V), fmt.Sprintf("%d位你关注的人也关注了TA", kv.V))
+	}
+	for _, kv := range redis.GroupMates(user.Id, RecommendMax*2) {
+		s.add(kv.K, float64(2*kv.V), fmt.Sprintf("与你同在%d个群组", kv.V))
+	}
+	nearby, _ := models.NearbyUsers(user.Loc, RecommendRadius, excludes, RecommendMax)
+	for i, _ := range nearby {
+		score := 1.
+		if nearby[i].Distance < 5000 {
+			score = 2
+		}
+		s.add(nearby[i].Id, score, "距离"+models.DistanceBucket(nearby[i].Distance))
+	}
+	for _, id := range redis.SimilarRunners(user.Id, RecommendMax) {
+		s.add(id, 1, "运动量和你相近")
+	}
+
+	var ids []string
+	for id, _ := range s {
+		if !containsString(excludes, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	users, err := models.FindUsers(ids)
+	if err != nil {
+		log.Println(err)
+		return nil, nil
+	}
+
+	// the unregistered weibo friends, the guests and the banned users are not recommended
+	now := time.Now().Unix()
+	ids = nil
+	for i, _ := range users {
+		u := &users[i]
+		if u.RegTime.Unix() <= 0 || u.IsGuest() || u.TimeLimit < 0 || u.TimeLimit > now {
+			continue
+		}
+		if redis.Relationship(u.Id, user.Id) == models.RelBlacklist {
+			continue
+		}
+		ids = append(ids, u.Id)
+	}
+	sort.Sort(rankedUsers{ids, s})
+	if len(ids) > RecommendMax {
+		ids = ids[:RecommendMax]
+	}
+
+	reasons := make(map[string]string)
+	for _, id := range ids {
+		reasons[id] = s[id].reason
+	}
+	return ids, reasons
+}
+
+func precomputeRecommends(logger *models.RedisLogger) {
+	users, err := models.ActiveUsers(time.Now().AddDate(0, -1, 0))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for i, _ := range users {
+		ids, reasons := recommendUsers(logger, &users[i])
+		logger.SetRecommends(users[i].Id, ids, reasons)
+	}
+	log.Println("precompute recommendations:", len(users))
+}
+
+// precompute the recommendations of the users active in the last month nightly, it should be run in a goroutine.
+func PrecomputeRecommends(pool *redis.Pool) {
+	now := time.Now()
+	next := time.Date(now.Year(), now.Month(), now.Day(), RecommendHour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	time.Sleep(next.Sub(now))
+
+	logger := models.NewRedisLogger(pool, pool.Get())
+	precomputeRecommends(logger)
+	logger.Close()
+
+	for _ = range time.Tick(24 * time.Hour) {
+		logger := models.NewRedisLogger(pool, pool.Get())
+		precomputeRecommends(logger)
+		logger.Close()
+	}
+}
@@ -90,6 +90,7 @@ func newRecordHandler(request *http.Request, resp http.ResponseWriter,
 		writeResponse(request.RequestURI, resp, nil, err)
 		return
 	}
+	updateChallenges(redis, user, rec)
 
 	rank := redis.LBDisRank(user.Id)
 	maxDis := redis.MaxDisRecord(user.Id)
@@ -119,7 +120,18 @@ type recTimelineForm struct {
 }
 
 func recTimelineHandler(request *http.Request, resp http.ResponseWriter, redis *models.RedisLogger, form recTimelineForm) {
-	user := &models.Account{Id: form.Userid}
+	user := &models.Account{}
+	if find, err := user.FindByUserid(form.Userid); !find {
+		if err == nil {
+			err = errors.NewError(errors.NotExistsError)
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	if !models.Visible(user.Privacy.Records, relationTo(redis, user.Id, redis.OnlineUser(form.Token))) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError, "无权查看该用户的运动记录"))
+		return
+	}
 	_, records, err := user.Records(&form.Paging)
 
 	recs := make([]record, len(records))
@@ -158,6 +170,10 @@ type leaderboardResp struct {
 	Addr     string `json:"locaddr"`
 	Distance int    `json:"total_distance"`
 	Status   string `json:"status"`
+	Reason   string `json:"reason,omitempty"` // why the user is recommended
+
+	Nearby      int    `json:"distance,omitempty"`       // the distance in meters to the fuzzed location of the nearby user
+	NearbyRange string `json:"distance_range,omitempty"` // the distance from the nearby user, such as "<1km"
 }
 
 type leaderboardForm struct {
@@ -220,7 +236,7 @@ func leaderboardHandler(request *http.Request, resp http.ResponseWriter,
 			lb[i].Gender = friends[i].Gender
 			lb[i].LastLog = friends[i].LastLogin.Unix()
 			lb[i].Birth = friends[i].Birth
-			lb[i].Location = friends[i].Loc
+			lb[i].Location, lb[i].Addr = friends[i].VisibleLoc(models.RelFriend)
 
 		}
 
@@ -324,6 +340,10 @@ func userRecStatHandler(request *http.Request, resp http.ResponseWriter, redis *
 		writeResponse(request.RequestURI, resp, nil, e)
 		return
 	}
+	if !models.Visible(user.Privacy.Records, relationTo(redis, user.Id, redis.OnlineUser(form.Token))) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError, "无权查看该用户的运动记录"))
+		return
+	}
 
 	stats.RecCount, _ = models.TotalRecords(form.Userid)
 	stats.TotalDistance, stats.TotalDuration = redis.RecStats(form.Userid)
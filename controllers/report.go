@@ -0,0 +1,126 @@
+// report
+package controllers
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/models"
+	"github.com/martini-contrib/binding"
+	"gopkg.in/go-martini/martini.v1"
+	"net/http"
+	"unicode/utf8"
+)
+
+const (
+	ReportEvidenceMax = 9   // the max evidence of a report
+	ReportReasonMax   = 500 // the max length of the reason in characters
+)
+
+func BindReportApi(m *martini.ClassicMartini) {
+	m.Post("/1/report",
+		binding.Json(reportForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		loadUserHandler,
+		checkGuestHandler,
+		reportHandler)
+}
+
+type reportForm struct {
+	Type     string   `json:"type" binding:"required"`
+	Id       string   `json:"id" binding:"required"`
+	Reason   string   `json:"reason" binding:"required"`
+	Evidence []string `json:"evidence"`
+	parameter
+}
+
+// the owner and the snapshot of the reported target,
+// the owner is empty if the target does not exist or can not be reported by the user.
+func reportTarget(typ, id string, user *models.Account) (string, []models.Segment) {
+	switch typ {
+	case models.ReportArticle, models.ReportComment:
+		article := &models.Article{}
+		if find, _ := article.FindById(id); !find || article.Deleted {
+			return "", nil
+		}
+		if (typ == models.ReportComment) != (len(article.Parent) > 0) {
+			return "", nil
+		}
+		return article.Author, article.Contents
+	case models.ReportMessage:
+		msg := &models.Message{}
+		// only the received messages can be reported
+		if find, _ := msg.FindById(id); !find || msg.To != user.Id {
+			return "", nil
+		}
+		contents := make([]models.Segment, len(msg.Body))
+		for i, body := range msg.Body {
+			contents[i] = models.Segment{ContentType: body.Type, ContentText: body.Content}
+		}
+		return msg.From, contents
+	case models.ReportUser:
+		u := &models.Account{}
+		if find, _ := u.FindByUserid(id); !find {
+			return "", nil
+		}
+		contents := []models.Segment{
+			{ContentType: "TEXT", ContentText: u.Nickname},
+			{ContentType: "TEXT", ContentText: u.About},
+		}
+		for _, pic := range append([]string{u.Profile}, u.Photos...) {
+			if len(pic) > 0 {
+				contents = append(contents, models.Segment{ContentType: "IMAGE", ContentText: pic})
+			}
+		}
+		return u.Id, contents
+	}
+	return "", nil
+}
+
+func reportHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(reportForm)
+
+	if !models.ValidReportType(form.Type) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.JsonError, "无效的举报类型"))
+		return
+	}
+	if utf8.RuneCountInString(form.Reason) > ReportReasonMax || len(form.Evidence) > ReportEvidenceMax {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.JsonError, "举报内容过长"))
+		return
+	}
+
+	owner, contents := reportTarget(form.Type, form.Id, user)
+	if len(owner) == 0 {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.NotExistsError))
+		return
+	}
+	if owner == user.Id {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError, "不能举报自己"))
+		return
+	}
+
+	report := &models.Report{
+		Type:     form.Type,
+		Target:   form.Id,
+		Owner:    owner,
+		Reporter: user.Id,
+		Reason:   form.Reason,
+		Evidence: form.Evidence,
+		Contents: contents,
+	}
+	saved, err := report.Save()
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	// the user has reported the target already
+	respData := map[string]interface{}{
+		"reported": !saved,
+	}
+	if saved {
+		respData["report_id"] = report.Id.Hex()
+	}
+	writeResponse(request.RequestURI, resp, respData, nil)
+}
@@ -0,0 +1,150 @@
+// schedule
+package controllers
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"github.com/ginuerzh/sports/models"
+	"github.com/zhengying/apns"
+	"log"
+	"time"
+)
+
+// publish the scheduled articles when it's time, it should be run in a goroutine.
+func PublishScheduled(pool *redis.Pool, client *apns.Client) {
+	for _ = range time.Tick(time.Minute) {
+		articles, err := models.DueArticles()
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if len(articles) == 0 {
+			continue
+		}
+
+		logger := models.NewRedisLogger(pool, pool.Get())
+		for i, _ := range articles {
+			article := &articles[i]
+			if ok, err := article.Publish(article.PubTime); !ok {
+				if err != nil {
+					log.Println(err)
+				}
+				continue
+			}
+
+			user := &models.Account{}
+			if find, _ := user.FindByUserid(article.Author); !find {
+				continue
+			}
+			if _, err := articlePublished(client, logger, user, article); err != nil {
+				log.Println(err)
+			}
+		}
+		logger.Close()
+	}
+}
+
+// delete the unreferenced files periodically, it should be run in a goroutine.
+func CollectFiles() {
+	for _ = range time.Tick(time.Hour) {
+		n, err := models.CollectFiles(models.FileGCGrace)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if n > 0 {
+			log.Println("collect files:", n)
+		}
+	}
+}
+
+// remove the guests inactive for GuestExpire daily, it should be run in a goroutine.
+func CleanGuests(pool *redis.Pool) {
+	for _ = range time.Tick(24 * time.Hour) {
+		guests, err := models.ExpiredGuests(time.Now().Add(-models.GuestExpire))
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		logger := models.NewRedisLogger(pool, pool.Get())
+		n := 0
+		for i, _ := range guests {
+			guest := &guests[i]
+			// the guest is still active with the refresh token
+			if len(logger.Sessions(guest.Id)) > 0 {
+				continue
+			}
+			if err := guest.RemoveGuest(); err != nil {
+				log.Println(err)
+				continue
+			}
+			logger.ClearUser(guest.Id)
+			n++
+		}
+		logger.Close()
+		if n > 0 {
+			log.Println("clean guests:", n)
+		}
+	}
+}
+
+// make the group members in redis the same as in the database
+func reconcileGroups(logger *models.RedisLogger) {
+	groups, err := models.AllGroups()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for i, _ := range groups {
+		group := &groups[i]
+		// the members of the groups created before were only kept in redis
+		if len(group.Members) == 0 {
+			if err := group.SetMembers(logger.GroupMembers(group.Gid)); err != nil {
+				log.Println(err)
+				continue
+			}
+		}
+		gid := group.Gid
+		added, removed, err := logger.SetGroupMembers(gid, func() ([]string, error) {
+			return models.GroupMembers(gid)
+		})
+		if err != nil {
+			log.Println(err)
+		} else if added+removed > 0 {
+			log.Println("reconcile group", gid, "added:", added, "removed:", removed)
+		}
+	}
+}
+
+// reconcile the group members at startup and hourly, it should be run in a goroutine.
+func ReconcileGroups(pool *redis.Pool) {
+	logger := models.NewRedisLogger(pool, pool.Get())
+	reconcileGroups(logger)
+	logger.Close()
+
+	for _ = range time.Tick(time.Hour) {
+		logger := models.NewRedisLogger(pool, pool.Get())
+		reconcileGroups(logger)
+		logger.Close()
+	}
+}
+
+// finish the ended challenges, it should be run in a goroutine.
+func FinishChallenges(pool *redis.Pool) {
+	for _ = range time.Tick(time.Minute) {
+		challenges, err := models.DueChallenges()
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if len(challenges) == 0 {
+			continue
+		}
+
+		logger := models.NewRedisLogger(pool, pool.Get())
+		for i, _ := range challenges {
+			finishChallenge(logger, &challenges[i])
+		}
+		logger.Close()
+	}
+}
@@ -0,0 +1,86 @@
+// session
+package controllers
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/models"
+	"net/http"
+)
+
+type refreshTokenForm struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+func refreshTokenHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, form refreshTokenForm) {
+	session, err := redis.RefreshSession(form.RefreshToken, ClientIp(request))
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	respData := map[string]interface{}{
+		"access_token":  session.AccessToken,
+		"refresh_token": session.RefreshToken,
+		"expires_in":    models.AccessTokenExpire,
+		"userid":        session.Userid,
+		"session_id":    session.Id,
+	}
+	writeResponse(request.RequestURI, resp, respData, nil)
+}
+
+type sessionJsonStruct struct {
+	Id        string `json:"session_id"`
+	Device    string `json:"device"`
+	Ip        string `json:"ip"`
+	LoginTime int64  `json:"login_time"`
+	LastSeen  int64  `json:"last_seen"`
+	Current   bool   `json:"current"`
+}
+
+type sessionsForm struct {
+	parameter
+}
+
+func sessionsHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+	current := redis.TokenSession(p.TokenId())
+
+	sessions := redis.Sessions(user.Id)
+	list := make([]sessionJsonStruct, len(sessions))
+	for i, s := range sessions {
+		list[i] = sessionJsonStruct{
+			Id:        s.Id,
+			Device:    s.Device,
+			Ip:        s.Ip,
+			LoginTime: s.LoginTime,
+			LastSeen:  s.LastSeen,
+			Current:   s.Id == current,
+		}
+	}
+
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"sessions": list}, nil)
+}
+
+type revokeSessionForm struct {
+	Id  string `json:"session_id"`
+	All bool   `json:"all"` // revoke all the other sessions
+	parameter
+}
+
+func revokeSessionHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+	form := p.(revokeSessionForm)
+
+	if form.All {
+		n := redis.RevokeSessions(user.Id, redis.TokenSession(form.Token))
+		writeResponse(request.RequestURI, resp, map[string]interface{}{"count": n}, nil)
+		return
+	}
+
+	if !redis.RevokeSession(user.Id, form.Id) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.NotFoundError))
+		return
+	}
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"count": 1}, nil)
+}
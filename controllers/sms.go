@@ -0,0 +1,167 @@
+// sms
+package controllers
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/models"
+	"github.com/ginuerzh/sports/sms"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+const (
+	VerifyRegister = "register"
+	VerifyLogin    = "login"
+	VerifyBind     = "bind"
+)
+
+var (
+	// it's set by the -sms flag, the console sender is for development only
+	SmsSender sms.Sender
+)
+
+func validPhone(phone string) bool {
+	if len(phone) < 6 || len(phone) > 15 {
+		return false
+	}
+	for _, c := range phone {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func verifyCode() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		n = big.NewInt(random.Int63n(1000000))
+	}
+	return fmt.Sprintf("%06d", n.Int64())
+}
+
+type sendCodeForm struct {
+	Phone   string `json:"phone_number" binding:"required"`
+	Purpose string `json:"purpose"`
+	Token   string `json:"access_token"`
+}
+
+func sendCodeHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, form sendCodeForm) {
+	if !validPhone(form.Phone) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.InvalidMsgError, "手机号码无效"))
+		return
+	}
+
+	user := &models.Account{Phone: form.Phone}
+	exists, err := user.Exists("phone")
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	switch form.Purpose {
+	case VerifyRegister:
+		if exists {
+			writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.UserExistError))
+			return
+		}
+	case VerifyBind:
+		if len(redis.OnlineUser(form.Token)) == 0 {
+			writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.AccessError))
+			return
+		}
+		if exists {
+			writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.UserExistError, "手机号码已被绑定"))
+			return
+		}
+	case VerifyLogin, "":
+		form.Purpose = VerifyLogin
+	default:
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.InvalidMsgError))
+		return
+	}
+
+	if !redis.VerifyCodeAllowed(form.Phone, ClientIp(request)) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.VerifyCodeLimitError))
+		return
+	}
+	code := verifyCode()
+	if !redis.SetVerifyCode(form.Purpose, form.Phone, code) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.VerifyCodeLimitError))
+		return
+	}
+	if err := SmsSender.Send(form.Phone, fmt.Sprintf("您的验证码是%s，%d分钟内有效。", code, models.VerifyCodeExpire/60)); err != nil {
+		log.Println(err)
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.HttpError, "短信发送失败"))
+		return
+	}
+
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"expire": models.VerifyCodeExpire}, nil)
+}
+
+// login with the verification code, the account is registered for the new phone.
+func phoneLogin(phone, code string, redis *models.RedisLogger) (bool, *models.Account, error) {
+	if !redis.CheckVerifyCode(VerifyLogin, phone, code) {
+		return false, nil, errors.NewError(errors.VerifyCodeError)
+	}
+
+	user := &models.Account{Phone: phone}
+	exists, err := user.Exists("phone")
+	if err != nil {
+		return false, nil, err
+	}
+	if exists {
+		return false, user, nil
+	}
+
+	user.Role = "phone"
+	user.RegTime = time.Now()
+	dbw, err := getNewWallet()
+	if err != nil {
+		return true, nil, errors.NewError(errors.DbError, "wallet: "+err.Error())
+	}
+	user.Wallet = *dbw
+	if err := user.Save(); err != nil {
+		return true, nil, err
+	}
+	redis.LogRegister(user.Id)
+
+	// ws push
+	regNotice(user.Id, redis)
+
+	return true, user, nil
+}
+
+type bindPhoneForm struct {
+	Phone string `json:"phone_number" binding:"required"`
+	Code  string `json:"verifycode" binding:"required"`
+	parameter
+}
+
+// bind or rebind the phone of the account
+func bindPhoneHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+	form := p.(bindPhoneForm)
+
+	if !redis.CheckVerifyCode(VerifyBind, form.Phone, form.Code) {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.VerifyCodeError))
+		return
+	}
+
+	other := &models.Account{Phone: form.Phone}
+	if exists, err := other.Exists("phone"); exists || err != nil {
+		if err == nil {
+			err = errors.NewError(errors.UserExistError, "手机号码已被绑定")
+		}
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	err := user.SetPhone(form.Phone)
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"phone_number": form.Phone}, err)
+}
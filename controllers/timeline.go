@@ -0,0 +1,180 @@
+// timeline
+package controllers
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/models"
+	"github.com/martini-contrib/binding"
+	"gopkg.in/go-martini/martini.v1"
+	"log"
+	"net/http"
+	"sort"
+)
+
+func BindTimelineApi(m *martini.ClassicMartini) {
+	m.Get("/1/article/home",
+		binding.Form(homeTimelineForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		homeTimelineHandler)
+}
+
+// backfill recent articles of the followed peers into the user's home timeline, or remove them when unfollowed.
+func updateTimeline(redis *models.RedisLogger, userid string, peers []string, follow bool) {
+	for _, peer := range peers {
+		if peer == userid {
+			continue
+		}
+		count := models.DefaultPageSize
+		if !follow {
+			count = models.TimelineMaxLength
+		}
+		articles, err := models.AuthorArticles([]string{peer}, "", "", count)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		if follow {
+			redis.AddTimeline(userid, articles...)
+			continue
+		}
+		ids := make([]string, len(articles))
+		for i, _ := range articles {
+			ids[i] = articles[i].Id.Hex()
+		}
+		redis.RemoveTimeline(userid, ids...)
+	}
+}
+
+type homeTimelineForm struct {
+	models.Paging
+	parameter
+}
+
+func homeTimelineHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(homeTimelineForm)
+	count := form.Paging.Count
+	if count <= 0 || count > models.DefaultPageSize {
+		count = models.DefaultPageSize
+	}
+
+	// the articles at the edges of the current page
+	var first, last *models.Article
+	for _, cursor := range []struct {
+		id      string
+		article **models.Article
+	}{{form.Paging.First, &first}, {form.Paging.Last, &last}} {
+		if len(cursor.id) == 0 {
+			continue
+		}
+		article := &models.Article{}
+		if find, err := article.FindById(cursor.id); !find {
+			if err == nil {
+				err = errors.NewError(errors.NotFoundError)
+			}
+			writeResponse(request.RequestURI, resp, nil, err)
+			return
+		}
+		*cursor.article = article
+	}
+
+	ids := redis.Timeline(user.Id, first, last, count)
+	timeline := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		timeline[id] = true
+	}
+	// fan out on read
+	if authors := redis.PopularFollowing(user.Id); len(authors) > 0 {
+		articles, err := models.AuthorArticles(authors, form.Paging.First, form.Paging.Last, count)
+		if err != nil {
+			writeResponse(request.RequestURI, resp, nil, err)
+			return
+		}
+		for i, _ := range articles {
+			ids = append(ids, articles[i].Id.Hex())
+		}
+	}
+
+	articles, err := models.FindArticles(ids...)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	m := make(map[string]bool, len(articles))
+	var rescored []models.Article
+	for i, _ := range articles {
+		m[articles[i].Id.Hex()] = true
+		if timeline[articles[i].Id.Hex()] {
+			rescored = append(rescored, articles[i])
+		}
+	}
+	var stales []string
+	for id, _ := range timeline {
+		if !m[id] {
+			stales = append(stales, id)
+		}
+	}
+	// the articles added before the timelines were scored by the publish time are rescored when read
+	redis.AddTimeline(user.Id, rescored...)
+
+	sort.Sort(byPubTime(articles))
+	if len(form.Paging.First) > 0 && len(articles) > count {
+		articles = articles[len(articles)-count:]
+	}
+	if len(articles) > count {
+		articles = articles[:count]
+	}
+
+	visible := make(map[string]bool)
+	for _, article := range visibleArticles(redis, articles, user.Id) {
+		visible[article.Id.Hex()] = true
+	}
+
+	blocked := make(map[string]bool)
+	jsonStructs := []*articleJsonStruct{}
+	for i, _ := range articles {
+		article := &articles[i]
+		b, ok := blocked[article.Author]
+		if !ok {
+			b = redis.Relationship(user.Id, article.Author) == models.RelBlacklist ||
+				redis.Relationship(article.Author, user.Id) == models.RelBlacklist
+			blocked[article.Author] = b
+		}
+		if b {
+			stales = append(stales, article.Id.Hex())
+			continue
+		}
+		// kept in the timeline, it may be visible later
+		if !visible[article.Id.Hex()] {
+			continue
+		}
+		jsonStructs = append(jsonStructs, convertArticle(article))
+	}
+	// removed articles
+	redis.RemoveTimeline(user.Id, stales...)
+
+	respData := make(map[string]interface{})
+	respData["page_frist_id"] = ""
+	respData["page_last_id"] = ""
+	if len(articles) > 0 {
+		respData["page_frist_id"] = articles[0].Id.Hex()
+		respData["page_last_id"] = articles[len(articles)-1].Id.Hex()
+	}
+	respData["articles_without_content"] = jsonStructs
+	writeResponse(request.RequestURI, resp, respData, nil)
+}
+
+// the articles ordered by the publish time, newest first
+type byPubTime []models.Article
+
+func (a byPubTime) Len() int      { return len(a) }
+func (a byPubTime) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byPubTime) Less(i, j int) bool {
+	if a[i].PubTime.Equal(a[j].PubTime) {
+		return a[i].Id.Hex() > a[j].Id.Hex()
+	}
+	return a[i].PubTime.After(a[j].PubTime)
+}
@@ -0,0 +1,149 @@
+// topic
+package controllers
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/models"
+	"github.com/martini-contrib/binding"
+	"gopkg.in/go-martini/martini.v1"
+	"net/http"
+)
+
+func BindTopicApi(m *martini.ClassicMartini) {
+	m.Get("/1/topic/trending",
+		binding.Form(trendingTopicsForm{}),
+		ErrorHandler,
+		trendingTopicsHandler)
+	m.Get("/1/topic/articles",
+		binding.Form(topicArticlesForm{}),
+		ErrorHandler,
+		topicArticlesHandler)
+	m.Post("/1/topic/follow",
+		binding.Json(followTopicForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		followTopicHandler)
+	m.Get("/1/topic/followed",
+		binding.Form(followedTopicsForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		followedTopicsHandler)
+}
+
+type topicJsonStruct struct {
+	Topic     string `json:"topic"`
+	Articles  int64  `json:"article_count"`
+	Score     int64  `json:"trending_score,omitempty"`
+	Followers int    `json:"follower_count"`
+	Followed  bool   `json:"followed"`
+}
+
+func convertTopic(redis *models.RedisLogger, userid string, topic string) *topicJsonStruct {
+	t := &topicJsonStruct{
+		Topic:     topic,
+		Articles:  redis.TopicCount(topic),
+		Followers: redis.TopicFollowerCount(topic),
+	}
+	if len(userid) > 0 {
+		t.Followed = redis.TopicFollowed(userid, topic)
+	}
+	return t
+}
+
+type trendingTopicsForm struct {
+	Token string `form:"access_token"`
+	Days  int    `form:"days"`
+	Count int    `form:"count"`
+}
+
+func trendingTopicsHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, form trendingTopicsForm) {
+
+	if form.Days <= 0 {
+		form.Days = 7
+	}
+	if form.Count <= 0 || form.Count > models.DefaultPageSize {
+		form.Count = 10
+	}
+
+	uid := redis.OnlineUser(form.Token)
+	tops := redis.TrendingTopics(form.Days, form.Count)
+	topics := make([]*topicJsonStruct, len(tops))
+	for i, _ := range tops {
+		topics[i] = convertTopic(redis, uid, tops[i].K)
+		topics[i].Score = tops[i].V
+	}
+
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"topics": topics}, nil)
+}
+
+type topicArticlesForm struct {
+	Token string `form:"access_token"`
+	Topic string `form:"topic" binding:"required"`
+	models.Paging
+}
+
+func topicArticlesHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, form topicArticlesForm) {
+
+	topic := models.NormalizeTopic(form.Topic)
+	if len(topic) == 0 {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.InvalidMsgError))
+		return
+	}
+
+	_, articles, err := models.GetArticles(topic, &form.Paging)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+	articles = visibleArticles(redis, articles, redis.OnlineUser(form.Token))
+
+	jsonStructs := make([]*articleJsonStruct, len(articles))
+	for i, _ := range articles {
+		jsonStructs[i] = convertArticle(&articles[i])
+	}
+
+	respData := make(map[string]interface{})
+	respData["topic"] = convertTopic(redis, redis.OnlineUser(form.Token), topic)
+	respData["page_frist_id"] = form.Paging.First
+	respData["page_last_id"] = form.Paging.Last
+	respData["articles_without_content"] = jsonStructs
+	writeResponse(request.RequestURI, resp, respData, nil)
+}
+
+type followTopicForm struct {
+	Topic  string `json:"topic" binding:"required"`
+	Follow bool   `json:"follow"`
+	parameter
+}
+
+func followTopicHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(followTopicForm)
+	topic := models.NormalizeTopic(form.Topic)
+	if len(topic) == 0 {
+		writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.InvalidMsgError))
+		return
+	}
+
+	redis.FollowTopic(user.Id, topic, form.Follow)
+	writeResponse(request.RequestURI, resp, convertTopic(redis, user.Id, topic), nil)
+}
+
+type followedTopicsForm struct {
+	parameter
+}
+
+func followedTopicsHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account) {
+
+	followed := redis.Topics(user.Id)
+	topics := make([]*topicJsonStruct, len(followed))
+	for i, topic := range followed {
+		topics[i] = convertTopic(redis, user.Id, topic)
+	}
+
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"topics": topics}, nil)
+}
@@ -3,7 +3,7 @@ package controllers
 
 import (
 	//"encoding/json"
-	//"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/errors"
 	"github.com/ginuerzh/sports/models"
 	"github.com/martini-contrib/binding"
 	"gopkg.in/go-martini/martini.v1"
@@ -28,6 +28,22 @@ func BindUserApi(m *martini.ClassicMartini) {
 		ErrorHandler,
 		checkTokenHandler,
 		setPushHandler)
+	m.Post("/1/user/set_discoverable",
+		binding.Json(setDiscoverableForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		setDiscoverableHandler)
+	m.Get("/1/user/privacy",
+		binding.Form(privacyForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		loadUserHandler,
+		privacyHandler)
+	m.Post("/1/user/set_privacy",
+		binding.Json(setPrivacyForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		setPrivacyHandler)
 	m.Get("/1/user/is_push_enabled",
 		binding.Form(pushStatusForm{}, (*Parameter)(nil)),
 		ErrorHandler,
@@ -39,6 +55,17 @@ func BindUserApi(m *martini.ClassicMartini) {
 		checkTokenHandler,
 		loadUserHandler,
 		followHandler)
+	m.Get("/1/user/follow/requests",
+		binding.Form(followRequestsForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		followRequestsHandler)
+	m.Post("/1/user/follow/respond",
+		binding.Json(followRespondForm{}, (*Parameter)(nil)),
+		ErrorHandler,
+		checkTokenHandler,
+		loadUserHandler,
+		followRespondHandler)
 	m.Post("/1/user/enableDefriend",
 		binding.Json(relationshipForm{}, (*Parameter)(nil)),
 		ErrorHandler,
@@ -92,6 +119,56 @@ func setPushHandler(request *http.Request, resp http.ResponseWriter,
 	writeResponse(request.RequestURI, resp, nil, err)
 }
 
+type setDiscoverableForm struct {
+	Discoverable bool `json:"is_discoverable"`
+	parameter
+}
+
+func setDiscoverableHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(setDiscoverableForm)
+	err := user.SetDiscoverable(form.Discoverable)
+	writeResponse(request.RequestURI, resp, nil, err)
+}
+
+// the relationship of the owner to the viewer, the viewer may be anonymous.
+func relationTo(redis *models.RedisLogger, owner, viewer string) string {
+	if len(viewer) > 0 && owner == viewer {
+		return models.RelSelf
+	}
+	return redis.Relationship(owner, viewer)
+}
+
+type privacyForm struct {
+	parameter
+}
+
+func privacyHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account) {
+
+	writeResponse(request.RequestURI, resp, user.Privacy, nil)
+}
+
+type setPrivacyForm struct {
+	models.Privacy
+	parameter
+}
+
+func setPrivacyHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(setPrivacyForm)
+	for _, v := range []string{form.Profile, form.Records, form.Articles, form.Location} {
+		if !models.ValidPrivacy(v) {
+			writeResponse(request.RequestURI, resp, nil, errors.NewError(errors.JsonError, "无效的隐私设置"))
+			return
+		}
+	}
+	err := user.SetPrivacy(form.Privacy)
+	writeResponse(request.RequestURI, resp, nil, err)
+}
+
 type pushStatusForm struct {
 	parameter
 }
@@ -115,36 +192,152 @@ func followHandler(request *http.Request, resp http.ResponseWriter,
 
 	form := p.(relationshipForm)
 
-	redis.SetRelationship(user.Id, form.Userids, models.RelFollowing, form.Follow)
-
-	for _, userid := range form.Userids {
-		u := &models.Account{Id: userid}
-		if form.Follow {
-			event := &models.Event{
-				Type: models.EventMsg,
-				Time: time.Now().Unix(),
-				Data: models.EventData{
-					Type: models.EventSub,
-					Id:   user.Id,
-					From: user.Id,
-					To:   u.Id,
-					Body: []models.MsgBody{
-						{Type: "nikename", Content: user.Nickname},
-						{Type: "image", Content: user.Profile},
-					},
-				},
+	// following the private accounts needs the approval
+	peers := form.Userids
+	var requested []string
+	if form.Follow {
+		peers = nil
+		for _, userid := range form.Userids {
+			u := &models.Account{}
+			if find, _ := u.FindByUserid(userid); !find || u.Id == user.Id {
+				continue
+			}
+			rel := redis.Relationship(user.Id, u.Id)
+			if !u.Privacy.Private || rel == models.RelFollowing || rel == models.RelFriend {
+				peers = append(peers, u.Id)
+				continue
+			}
+			if redis.Relationship(u.Id, user.Id) == models.RelBlacklist {
+				continue
 			}
-			redis.PubMsg(models.EventMsg, u.Id, event.Bytes())
-			if err := event.Save(); err == nil {
-				redis.IncrEventCount(u.Id, event.Data.Type, 1)
+			if redis.AddFollowRequest(user.Id, u.Id) {
+				followNotice(redis, models.EventFollowRequest, user, u.Id)
+			}
+			requested = append(requested, u.Id)
+		}
+	} else {
+		for _, userid := range form.Userids {
+			if redis.RemoveFollowRequest(user.Id, userid) {
+				u := &models.Account{Id: userid}
+				count := u.ClearEvent(models.EventFollowRequest, user.Id)
+				redis.IncrEventCount(u.Id, models.EventFollowRequest, -count)
 			}
+		}
+	}
+
+	redis.SetRelationship(user.Id, peers, models.RelFollowing, form.Follow)
+	updateTimeline(redis, user.Id, peers, form.Follow)
+
+	for _, userid := range peers {
+		if form.Follow {
+			followNotice(redis, models.EventSub, user, userid)
 		} else {
+			u := &models.Account{Id: userid}
 			count := u.ClearEvent(models.EventSub, user.Id)
 			redis.IncrEventCount(u.Id, models.EventSub, -count)
 		}
 	}
 
-	writeResponse(request.RequestURI, resp, map[string]interface{}{"ExpEffect": Awards{}}, nil)
+	respData := map[string]interface{}{
+		"ExpEffect": Awards{},
+		"requested": requested,
+	}
+	writeResponse(request.RequestURI, resp, respData, nil)
+}
+
+// notify the peer that the user followed, requested to follow or accepted the request
+func followNotice(redis *models.RedisLogger, typ string, user *models.Account, peer string) {
+	event := &models.Event{
+		Type: models.EventMsg,
+		Time: time.Now().Unix(),
+		Data: models.EventData{
+			Type: typ,
+			Id:   user.Id,
+			From: user.Id,
+			To:   peer,
+			Body: []models.MsgBody{
+				{Type: "nikename", Content: user.Nickname},
+				{Type: "image", Content: user.Profile},
+			},
+		},
+	}
+	redis.PubMsg(models.EventMsg, peer, event.Bytes())
+	if err := event.Save(); err == nil {
+		redis.IncrEventCount(peer, event.Data.Type, 1)
+	}
+}
+
+type followRequestsForm struct {
+	parameter
+}
+
+// the users requested to follow the user, the latest first
+func followRequestsHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account) {
+
+	ids := redis.FollowRequests(user.Id)
+	users, err := models.FindUsers(ids)
+	if err != nil {
+		writeResponse(request.RequestURI, resp, nil, err)
+		return
+	}
+
+	lb := []leaderboardResp{}
+	for _, id := range ids {
+		for i, _ := range users {
+			if users[i].Id != id {
+				continue
+			}
+			lb = append(lb, leaderboardResp{
+				Userid:   users[i].Id,
+				Score:    users[i].Props.Score,
+				Level:    users[i].Props.Level + 1,
+				Profile:  users[i].Profile,
+				Nickname: users[i].Nickname,
+				Gender:   users[i].Gender,
+				LastLog:  users[i].LastLogin.Unix(),
+				Birth:    users[i].Birth,
+			})
+			break
+		}
+	}
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"members_list": lb}, nil)
+}
+
+type followRespondForm struct {
+	Userids []string `json:"userids" binding:"required"`
+	Accept  bool     `json:"accept"`
+	parameter
+}
+
+// accept or reject the follow requests
+func followRespondHandler(request *http.Request, resp http.ResponseWriter,
+	redis *models.RedisLogger, user *models.Account, p Parameter) {
+
+	form := p.(followRespondForm)
+
+	var accepted []string
+	for _, userid := range form.Userids {
+		ok := false
+		if form.Accept {
+			ok = redis.AcceptFollowRequest(userid, user.Id)
+		} else {
+			ok = redis.RemoveFollowRequest(userid, user.Id)
+		}
+		if !ok {
+			continue
+		}
+
+		count := user.ClearEvent(models.EventFollowRequest, userid)
+		redis.IncrEventCount(user.Id, models.EventFollowRequest, -count)
+		if form.Accept {
+			updateTimeline(redis, userid, []string{user.Id}, true)
+			followNotice(redis, models.EventFollowAccept, user, userid)
+			accepted = append(accepted, userid)
+		}
+	}
+
+	writeResponse(request.RequestURI, resp, map[string]interface{}{"accepted": accepted}, nil)
 }
 
 func blacklistHandler(request *http.Request, resp http.ResponseWriter,
@@ -152,6 +345,15 @@ func blacklistHandler(request *http.Request, resp http.ResponseWriter,
 	form := p.(relationshipForm)
 
 	redis.SetRelationship(user.Id, form.Userids, models.RelBlacklist, form.Blacklist)
+	if form.Blacklist {
+		updateTimeline(redis, user.Id, form.Userids, false)
+		for _, peer := range form.Userids {
+			updateTimeline(redis, peer, []string{user.Id}, false)
+			// the follow request of the peer is removed with the relationship
+			count := user.ClearEvent(models.EventFollowRequest, peer)
+			redis.IncrEventCount(user.Id, models.EventFollowRequest, -count)
+		}
+	}
 
 	writeResponse(request.RequestURI, resp, map[string]interface{}{"ExpEffect": Awards{}}, nil)
 }
@@ -218,7 +420,7 @@ func socialListHandler(request *http.Request, resp http.ResponseWriter,
 		lb[i].Gender = users[i].Gender
 		lb[i].LastLog = users[i].LastLogin.Unix()
 		lb[i].Birth = users[i].Birth
-		lb[i].Location = users[i].Loc
+		lb[i].Location, lb[i].Addr = users[i].VisibleLoc(relationTo(redis, users[i].Id, user.Id))
 	}
 
 	respData := map[string]interface{}{
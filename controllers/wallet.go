@@ -50,6 +50,7 @@ func BindWalletApi(m *martini.ClassicMartini) {
 		checkTokenHandler,
 		loadUserHandler,
 		checkLimitHandler,
+		checkGuestHandler,
 		txHandler)
 	m.Get("/1/wallet/txs",
 		binding.Form(addrTxsForm{}),
@@ -28,29 +28,41 @@ const (
 	FileTooLargeError
 	FileUploadError
 	UnimplementedError
+	QuotaExceededError
+	UploadLimitError
+	VerifyCodeError
+	VerifyCodeLimitError
+	PasswordExpiredError
+	GuestLimitError
 )
 
 var errMap map[int]string = map[int]string{
-	NoError:             "success",
-	AuthError:           "用户名或密码错误",
-	UserExistError:      "用户已注册",
-	AccessError:         "无效的访问请求",
-	DbError:             "database error",
-	JsonError:           "json data error",
-	NotFoundError:       "not found",
-	PasswordError:       "password invalid",
-	InvalidFileError:    "file invalid",
-	HttpError:           "http error",
-	FileNotFoundError:   "file not found",
-	NotExistsError:      "用户不存在",
-	InvalidAddrError:    "address invalid",
-	InvalidMsgError:     "message invalid",
-	DeviceTokenError:    "device token invalid",
-	ReviewNotFoundError: "review not found",
-	InviteCodeError:     "invite code invalid",
-	FileTooLargeError:   "file too large",
-	FileUploadError:     "file upload error",
-	UnimplementedError:  "unimplemented",
+	NoError:              "success",
+	AuthError:            "用户名或密码错误",
+	UserExistError:       "用户已注册",
+	AccessError:          "无效的访问请求",
+	DbError:              "database error",
+	JsonError:            "json data error",
+	NotFoundError:        "not found",
+	PasswordError:        "password invalid",
+	InvalidFileError:     "file invalid",
+	HttpError:            "http error",
+	FileNotFoundError:    "file not found",
+	NotExistsError:       "用户不存在",
+	InvalidAddrError:     "address invalid",
+	InvalidMsgError:      "message invalid",
+	DeviceTokenError:     "device token invalid",
+	ReviewNotFoundError:  "review not found",
+	InviteCodeError:      "invite code invalid",
+	FileTooLargeError:    "file too large",
+	FileUploadError:      "file upload error",
+	UnimplementedError:   "unimplemented",
+	QuotaExceededError:   "存储空间不足",
+	UploadLimitError:     "上传过于频繁",
+	VerifyCodeError:      "验证码错误或已过期",
+	VerifyCodeLimitError: "验证码发送过于频繁",
+	PasswordExpiredError: "密码已失效，请重置密码",
+	GuestLimitError:      "游客登录过于频繁",
 }
 
 type Error struct {
@@ -0,0 +1,92 @@
+// highlight
+package fulltext
+
+import (
+	"bytes"
+	"html"
+	"unicode"
+)
+
+const (
+	HighlightPre  = "<em>"
+	HighlightPost = "</em>"
+
+	snippetBefore = 20
+	snippetLength = 80
+)
+
+// Highlight returns a snippet of the text around the first match of the terms,
+// the matches are wrapped in HighlightPre and HighlightPost, the text is HTML-escaped.
+func Highlight(text string, terms []string) string {
+	src := []rune(text)
+	lower := make([]rune, len(src))
+	for i, r := range src {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	marks := make([]bool, len(src))
+	found := false
+	for _, term := range terms {
+		t := []rune(term)
+		if len(t) == 0 {
+			continue
+		}
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if runesEqual(lower[i:i+len(t)], t) {
+				for j := i; j < i+len(t); j++ {
+					marks[j] = true
+				}
+				found = true
+			}
+		}
+	}
+
+	start := 0
+	if found {
+		for i, m := range marks {
+			if m {
+				start = i
+				break
+			}
+		}
+		start -= snippetBefore
+		if start < 0 {
+			start = 0
+		}
+	}
+	end := start + snippetLength
+	if end > len(src) {
+		end = len(src)
+	}
+
+	buf := &bytes.Buffer{}
+	if start > 0 {
+		buf.WriteString("...")
+	}
+	for i := start; i < end; i++ {
+		if marks[i] && (i == start || !marks[i-1]) {
+			buf.WriteString(HighlightPre)
+		}
+		buf.WriteString(html.EscapeString(string(src[i])))
+		if marks[i] && (i == end-1 || !marks[i+1]) {
+			buf.WriteString(HighlightPost)
+		}
+	}
+	if end < len(src) {
+		buf.WriteString("...")
+	}
+
+	return buf.String()
+}
+
+func runesEqual(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
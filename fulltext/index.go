@@ -0,0 +1,291 @@
+// index
+package fulltext
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type Document struct {
+	Id     string
+	Text   string
+	Author string
+	Tags   []string
+	Time   time.Time
+}
+
+type Query struct {
+	Keyword string
+	Author  string
+	Tag     string
+	Start   time.Time
+	End     time.Time
+}
+
+type Hit struct {
+	Id    string
+	Score float64
+}
+
+type entry struct {
+	doc    Document
+	length int
+}
+
+// Index is an in-memory inverted index, it's safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]*entry
+	postings map[string]map[string]int // term -> doc id -> term frequency
+	totalLen int
+	changes  map[string]*Document // the changes since BeginLoad, nil is removed
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[string]*entry),
+		postings: make(map[string]map[string]int),
+	}
+}
+
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.docs)
+}
+
+// Add indexes the document, the document with the same id is replaced.
+func (idx *Index) Add(doc Document) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(doc.Id)
+	idx.add(doc)
+	if idx.changes != nil {
+		idx.changes[doc.Id] = &doc
+	}
+}
+
+func (idx *Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+	if idx.changes != nil {
+		idx.changes[id] = nil
+	}
+}
+
+// BeginLoad records the changes from now on, they are applied again after the documents loaded by Load,
+// so the changes made while the documents are read are not lost.
+func (idx *Index) BeginLoad() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.changes = make(map[string]*Document)
+}
+
+// CancelLoad stops recording the changes if the documents can not be loaded.
+func (idx *Index) CancelLoad() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.changes = nil
+}
+
+// Load replaces all the documents of the index, the changes since BeginLoad are kept.
+func (idx *Index) Load(docs []Document) {
+	other := NewIndex()
+	for _, doc := range docs {
+		other.remove(doc.Id)
+		other.add(doc)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for id, doc := range idx.changes {
+		other.remove(id)
+		if doc != nil {
+			other.add(*doc)
+		}
+	}
+	idx.changes = nil
+
+	idx.docs = other.docs
+	idx.postings = other.postings
+	idx.totalLen = other.totalLen
+}
+
+func (idx *Index) add(doc Document) {
+	terms := Tokenize(doc.Text)
+	idx.docs[doc.Id] = &entry{doc: doc, length: len(terms)}
+	idx.totalLen += len(terms)
+
+	for _, term := range terms {
+		p, ok := idx.postings[term]
+		if !ok {
+			p = make(map[string]int)
+			idx.postings[term] = p
+		}
+		p[doc.Id]++
+	}
+}
+
+func (idx *Index) remove(id string) {
+	e, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+
+	for _, term := range Tokenize(e.doc.Text) {
+		if p, ok := idx.postings[term]; ok {
+			delete(p, id)
+			if len(p) == 0 {
+				delete(idx.postings, term)
+			}
+		}
+	}
+	idx.totalLen -= e.length
+	delete(idx.docs, id)
+}
+
+// postings of the query term, a word also matches the words it prefixes.
+func (idx *Index) match(term string) map[string]int {
+	if !isWord([]rune(term)[0]) {
+		return idx.postings[term]
+	}
+
+	m := make(map[string]int)
+	for t, p := range idx.postings {
+		if !strings.HasPrefix(t, term) {
+			continue
+		}
+		for id, tf := range p {
+			m[id] += tf
+		}
+	}
+	return m
+}
+
+func (idx *Index) filter(e *entry, q *Query) bool {
+	if len(q.Author) > 0 && e.doc.Author != q.Author {
+		return false
+	}
+	if !q.Start.IsZero() && e.doc.Time.Before(q.Start) {
+		return false
+	}
+	if !q.End.IsZero() && e.doc.Time.After(q.End) {
+		return false
+	}
+	if len(q.Tag) > 0 {
+		for _, tag := range e.doc.Tags {
+			if tag == q.Tag {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Search returns all the documents containing every term of the keyword, ranked by BM25.
+// The documents are sorted by time if the keyword is empty.
+func (idx *Index) Search(q Query) []Hit {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	terms := QueryTokens(q.Keyword)
+	if len(terms) == 0 && len(strings.TrimSpace(q.Keyword)) > 0 {
+		return nil
+	}
+
+	scores := make(map[string]float64)
+	if len(terms) == 0 {
+		for id, e := range idx.docs {
+			if idx.filter(e, &q) {
+				scores[id] = 0
+			}
+		}
+	} else {
+		n := float64(len(idx.docs))
+		avgLen := float64(idx.totalLen) / math.Max(n, 1)
+
+		for i, term := range terms {
+			p := idx.match(term)
+			idf := math.Log(1 + (n-float64(len(p))+0.5)/(float64(len(p))+0.5))
+
+			next := make(map[string]float64)
+			for id, tf := range p {
+				score, ok := scores[id]
+				if i > 0 && !ok {
+					continue
+				}
+				e := idx.docs[id]
+				if i == 0 && !idx.filter(e, &q) {
+					continue
+				}
+				f := float64(tf)
+				norm := 1 - bm25B + bm25B*float64(e.length)/math.Max(avgLen, 1)
+				next[id] = score + idf*f*(bm25K1+1)/(f+bm25K1*norm)
+			}
+			scores = next
+			if len(scores) == 0 {
+				return nil
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{Id: id, Score: score})
+	}
+	sort.Sort(byScore{hits, idx.docs})
+
+	return hits
+}
+
+// Snippet returns the highlighted snippet of the document for the keyword.
+func (idx *Index) Snippet(id string, keyword string) string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	e, ok := idx.docs[id]
+	if !ok {
+		return ""
+	}
+	return Highlight(e.doc.Text, QueryTokens(keyword))
+}
+
+type byScore struct {
+	hits []Hit
+	docs map[string]*entry
+}
+
+func (s byScore) Len() int {
+	return len(s.hits)
+}
+
+func (s byScore) Swap(i, j int) {
+	s.hits[i], s.hits[j] = s.hits[j], s.hits[i]
+}
+
+func (s byScore) Less(i, j int) bool {
+	if s.hits[i].Score != s.hits[j].Score {
+		return s.hits[i].Score > s.hits[j].Score
+	}
+	ti, tj := s.docs[s.hits[i].Id].doc.Time, s.docs[s.hits[j].Id].doc.Time
+	if !ti.Equal(tj) {
+		return ti.After(tj)
+	}
+	return s.hits[i].Id > s.hits[j].Id
+}
@@ -0,0 +1,103 @@
+// tokenizer
+package fulltext
+
+import (
+	"unicode"
+)
+
+// Han, Kana and Hangul characters are not separated by spaces.
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
+
+func isWord(r rune) bool {
+	return !isCJK(r) && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// split the text into lower case words and runs of CJK characters.
+func split(text string) (words []string, runs [][]rune) {
+	var word, run []rune
+
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+		if len(run) > 0 {
+			runs = append(runs, run)
+			run = nil
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = nil
+			}
+			run = append(run, r)
+		case isWord(r):
+			if len(run) > 0 {
+				runs = append(runs, run)
+				run = nil
+			}
+			word = append(word, unicode.ToLower(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return
+}
+
+// Tokenize returns the terms of the text to be indexed,
+// a run of CJK characters is indexed as unigrams and bigrams.
+func Tokenize(text string) []string {
+	words, runs := split(text)
+
+	terms := words
+	for _, run := range runs {
+		for i := range run {
+			terms = append(terms, string(run[i]))
+			if i+1 < len(run) {
+				terms = append(terms, string(run[i:i+2]))
+			}
+		}
+	}
+	return terms
+}
+
+// QueryTokens returns the terms of the query,
+// a run of CJK characters is searched by bigrams, or unigram for a single character.
+func QueryTokens(text string) []string {
+	words, runs := split(text)
+
+	var terms []string
+	add := func(term string) {
+		for _, t := range terms {
+			if t == term {
+				return
+			}
+		}
+		terms = append(terms, term)
+	}
+
+	for _, word := range words {
+		add(word)
+	}
+	for _, run := range runs {
+		if len(run) == 1 {
+			add(string(run))
+			continue
+		}
+		for i := 0; i+1 < len(run); i++ {
+			add(string(run[i : i+2]))
+		}
+	}
+	return terms
+}
@@ -0,0 +1,67 @@
+// mail
+package mail
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+)
+
+// Sender sends the email to the address.
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// ConsoleSender writes the emails to the log instead of sending them, for development.
+type ConsoleSender struct{}
+
+func (ConsoleSender) Send(to, subject, body string) error {
+	log.Println("mail to", to+":", subject, body)
+	return nil
+}
+
+// SMTPSender sends the emails by the smtp server with the plain auth.
+type SMTPSender struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+func (s SMTPSender) Send(to, subject, body string) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if len(s.Username) > 0 {
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	msg := "From: " + s.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + mime.BEncoding.Encode("utf-8", subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(body))
+	return smtp.SendMail(s.Addr, auth, s.From, []string{to}, []byte(msg))
+}
+
+// New returns the sender of the kind, "smtp" or "console".
+func New(kind, addr, username, password, from string) (Sender, error) {
+	switch kind {
+	case "smtp":
+		if len(addr) == 0 || len(from) == 0 {
+			return nil, errors.New("mail: smtp address and sender are required")
+		}
+		return SMTPSender{Addr: addr, Username: username, Password: password, From: from}, nil
+	case "console":
+		return ConsoleSender{}, nil
+	}
+	return nil, fmt.Errorf("mail: unknown sender '%s'", kind)
+}
@@ -7,10 +7,13 @@ import (
 	"github.com/ginuerzh/sports/controllers"
 	"github.com/ginuerzh/sports/controllers/admin"
 	//"github.com/ginuerzh/sports/controllers/jsgen"
-	//"github.com/ginuerzh/sports/models"
+	"github.com/ginuerzh/sports/mail"
+	"github.com/ginuerzh/sports/models"
+	"github.com/ginuerzh/sports/oauth"
+	"github.com/ginuerzh/sports/sms"
+	"github.com/ginuerzh/sports/storage"
 	"github.com/zhengying/apns"
 	//"github.com/martini-contrib/gzip"
-	"gopkg.in/ginuerzh/weedo.v0"
 	"gopkg.in/go-martini/martini.v1"
 	"log"
 	"net/http"
@@ -24,7 +27,19 @@ var (
 	staticDir  string
 	listenAddr string
 	redisAddr  string
-	weedfsAddr string
+	blobConfig storage.Config
+
+	smsKind  string
+	mailKind string
+	smtpAddr string
+	smtpUser string
+	smtpFrom string
+
+	weiboAppKey string
+	qqAppId     string
+	oauthApiUrl string
+
+	gazetteerFile string
 )
 
 func init() {
@@ -35,13 +50,67 @@ func init() {
 	flag.StringVar(&redisAddr, "redis", "localhost:6379", "redis server")
 	//flag.StringVar(&models.MongoAddr, "mongo", "localhost:27017", "mongodb server")
 	flag.StringVar(&controllers.CoinAddr, "cs", "localhost:8087", "coin server")
-	flag.StringVar(&weedfsAddr, "weed", "localhost:9334", "weed-fs server")
+	flag.StringVar(&blobConfig.Kind, "storage", storage.KindWeedfs, "file storage: weedfs, local or s3")
+	flag.StringVar(&blobConfig.WeedfsAddr, "weed", "localhost:9334", "weed-fs server")
+	flag.StringVar(&blobConfig.Dir, "storage-dir", "files", "local storage directory")
+	flag.StringVar(&blobConfig.BaseUrl, "storage-url", "http://localhost:8080", "url of this server for the local storage")
+	flag.StringVar(&blobConfig.Endpoint, "s3-endpoint", "", "s3 endpoint")
+	flag.StringVar(&blobConfig.Region, "s3-region", "", "s3 region")
+	flag.StringVar(&blobConfig.Bucket, "s3-bucket", "", "s3 bucket")
+	flag.StringVar(&blobConfig.PublicUrl, "s3-url", "", "public url of the s3 bucket")
+	flag.StringVar(&smsKind, "sms", "console", "sms sender: yunpian (the api key is read from SMS_API_KEY) or console (the codes are logged)")
+	flag.StringVar(&mailKind, "mail", "console", "mail sender: smtp (the password is read from SMTP_PASSWORD) or console (the mails are logged)")
+	flag.StringVar(&smtpAddr, "smtp-addr", "", "smtp server address, host:port")
+	flag.StringVar(&smtpUser, "smtp-user", "", "smtp username")
+	flag.StringVar(&smtpFrom, "smtp-from", "", "sender address of the mails")
+	flag.StringVar(&weiboAppKey, "weibo-appkey", "", "weibo app key")
+	flag.StringVar(&qqAppId, "qq-appid", "", "qq app id")
+	flag.StringVar(&oauthApiUrl, "oauth-api", "", "api url of the oauth providers, for testing only")
+	flag.StringVar(&gazetteerFile, "gazetteer", "", "gazetteer file with all the counties, the built-in one is used if empty")
+	flag.IntVar(&models.LocationPrecision, "loc-precision", models.LocationPrecision, "geohash length of the stored user locations")
+	flag.IntVar(&models.LocationFuzz, "loc-fuzz", models.LocationFuzz, "geohash length of the user locations shown to the others")
+	flag.DurationVar(&models.LocationExpire, "loc-expire", models.LocationExpire, "user locations older than this are ignored")
 	flag.Parse()
 
+	blobConfig.AccessKey = os.Getenv("S3_ACCESS_KEY")
+	blobConfig.SecretKey = os.Getenv("S3_SECRET_KEY")
+
 	if !strings.HasPrefix(controllers.CoinAddr, "http") {
 		controllers.CoinAddr = "http://" + controllers.CoinAddr
 	}
-	controllers.Weedfs = weedo.NewClient(weedfsAddr)
+
+	// the weibo and qq logins are disabled without the app keys, the tokens can't be verified
+	weibo, weixin, qq := oauth.NewWeibo(weiboAppKey), oauth.NewWeixin(), oauth.NewQQ(qqAppId)
+	if len(oauthApiUrl) > 0 {
+		weibo.ApiUrl, weixin.ApiUrl, qq.ApiUrl = oauthApiUrl, oauthApiUrl, oauthApiUrl
+	}
+	if len(weiboAppKey) > 0 {
+		oauth.Register(weibo)
+	} else {
+		log.Println("weibo-appkey is not set, the weibo login is disabled")
+	}
+	oauth.Register(weixin)
+	if len(qqAppId) > 0 {
+		oauth.Register(qq)
+	} else {
+		log.Println("qq-appid is not set, the qq login is disabled")
+	}
+
+	var err error
+	if models.Storage, err = storage.New(blobConfig); err != nil {
+		log.Fatal(err)
+	}
+	if len(gazetteerFile) > 0 {
+		if err := models.LoadGazetteer(gazetteerFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if controllers.SmsSender, err = sms.New(smsKind, os.Getenv("SMS_API_KEY")); err != nil {
+		log.Fatal(err)
+	}
+	if controllers.MailSender, err = mail.New(mailKind, smtpAddr, smtpUser, os.Getenv("SMTP_PASSWORD"), smtpFrom); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func classic() *martini.ClassicMartini {
@@ -59,8 +128,10 @@ func classic() *martini.ClassicMartini {
 func main() {
 	m := classic()
 	m.Map(log.New(os.Stdout, "[sports] ", log.LstdFlags))
-	m.Map(redisPool())
-	m.Map(apnsClient())
+	pool := redisPool()
+	client := apnsClient()
+	m.Map(pool)
+	m.Map(client)
 
 	controllers.BindAccountApi(m)
 	controllers.BindUserApi(m)
@@ -74,6 +145,10 @@ func main() {
 	controllers.BindGroupApi(m)
 	controllers.BindWalletApi(m)
 	controllers.BindTaskApi(m)
+	controllers.BindTopicApi(m)
+	controllers.BindTimelineApi(m)
+	controllers.BindActivityApi(m)
+	controllers.BindReportApi(m)
 
 	//admin apis
 	admin.BindArticleApi(m)
@@ -81,6 +156,7 @@ func main() {
 	admin.BindStatApi(m)
 	admin.BindAccountApi(m)
 	admin.BindRecordsApi(m)
+	admin.BindReportApi(m)
 
 	admin.BindRuleApi(m)
 
@@ -88,6 +164,21 @@ func main() {
 	//jsgen.BindConfigApi(m)
 	//jsgen.BindAccountApi(m)
 	//jsgen.BindArticleApi(m)
+	if err := models.Migrate(); err != nil {
+		log.Fatal(err)
+	}
+	go controllers.PublishScheduled(pool, client)
+	go controllers.CollectFiles()
+	go controllers.CleanGuests(pool)
+	go controllers.ReconcileGroups(pool)
+	go controllers.FinishChallenges(pool)
+	go controllers.PrecomputeRecommends(pool)
+	go func() {
+		if err := models.RebuildSearchIndex(); err != nil {
+			log.Println(err)
+		}
+	}()
+
 	log.Fatal(http.ListenAndServe(listenAddr, m))
 }
 
@@ -27,7 +27,7 @@ func init() {
 	ensureIndex(accountColl, "nickname")
 	ensureIndex(accountColl, "-reg_time")
 	ensureIndex(accountColl, "-lastlogin")
-	ensureIndex2D(accountColl, "loc")
+	ensureIndex(accountColl, "geohash")
 }
 
 type UserInfo struct {
@@ -102,6 +102,10 @@ type Account struct {
 	Addr      *Address  `bson:",omitempty" json:"addr,omitempty"`
 	Loc       Location  `bson:",omitempty" json:"-"`
 	LocAddr   string    `bson:"locaddr" json:"-"`
+	LocTime   time.Time `bson:"loc_time" json:"-"`
+	Geohash   string    `bson:",omitempty" json:"-"`
+	HideLoc   bool      `bson:"hide_loc,omitempty" json:"-"` // not discoverable by the nearby search
+	Privacy   Privacy   `json:"-"`
 	Photos    []string  `json:"-"`
 	Setinfo   bool      `json:"setinfo,omitempty"`
 	Wallet    DbWallet  `json:"-"`
@@ -119,6 +123,11 @@ type Account struct {
 
 	TimeLimit int64 `bson:"timelimit" json:"timelimit"`
 	Privilege int   `json:"-"`
+
+	PasswordExpired bool `bson:"password_expired,omitempty" json:"-"`
+
+	Quota       int64 `bson:",omitempty" json:"-"` // storage quota in bytes set by admin
+	StorageUsed int64 `bson:"storage_used" json:"-"`
 }
 
 func (this *Account) Exists(t string) (bool, error) {
@@ -143,6 +152,21 @@ func FindUsers(ids []string) ([]Account, error) {
 	return users, nil
 }
 
+// the registered users logged in since the time, only the ids and the locations are loaded.
+func ActiveUsers(since time.Time) ([]Account, error) {
+	var users []Account
+	query := bson.M{
+		"lastlogin": bson.M{"$gt": since},
+		"reg_time":  bson.M{"$gt": time.Unix(0, 0)},
+		"role":      bson.M{"$ne": GuestRole},
+	}
+	selector := bson.M{"_id": 1, "loc": 1}
+	if err := search(accountColl, query, selector, 0, 0, nil, nil, &users); err != nil {
+		return nil, errors.NewError(errors.DbError, err.Error())
+	}
+	return users, nil
+}
+
 func (this *Account) findOne(query interface{}) (bool, error) {
 	var users []Account
 
@@ -170,6 +194,8 @@ func (this *Account) FindByNickname(nickname string) (bool, error) {
 	return this.findOne(bson.M{"nickname": nickname})
 }
 
+// find the user by email or phone and the plain password,
+// the legacy password hash is upgraded if the password is correct.
 func (this *Account) FindByUserPass(userid, password string) (bool, error) {
 	if len(userid) == 0 || len(password) == 0 {
 		return false, nil
@@ -179,7 +205,30 @@ func (this *Account) FindByUserPass(userid, password string) (bool, error) {
 			{"email": userid},
 			{"phone": userid},
 		},
-		"password": password,
+	}
+	var users []Account
+	if err := search(accountColl, query, nil, 0, 0, nil, nil, &users); err != nil {
+		return false, err
+	}
+	for i, _ := range users {
+		if users[i].verifyPassword(password) {
+			*this = users[i]
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// find the user by email or phone
+func (this *Account) FindByLogin(userid string) (bool, error) {
+	if len(userid) == 0 {
+		return false, nil
+	}
+	query := bson.M{
+		"$or": []bson.M{
+			{"email": userid},
+			{"phone": userid},
+		},
 	}
 	return this.findOne(query)
 }
@@ -205,7 +254,11 @@ func (this *Account) Save() error {
 
 	this.Id = fmt.Sprintf("%d%03d", now.Unix(), now.Nanosecond()%1000)
 	this.Push = true
-	return save(accountColl, this, true)
+	if err := save(accountColl, this, true); err != nil {
+		return err
+	}
+	indexUser(this)
+	return nil
 	/*
 			f := func(c *mgo.Collection) error {
 				runner := txn.NewRunner(c)
@@ -245,9 +298,29 @@ func (this *Account) Update() error {
 		"$set": Struct2Map(this),
 	}
 
+	old := &Account{}
+	if _, err := apply(accountColl, bson.M{"_id": this.Id}, mgo.Change{Update: change}, old); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	reindexUser(this.Id)
+	// the empty profile is not changed
+	if len(this.Profile) > 0 && old.Profile != this.Profile {
+		changeFileRefs([]string{old.Profile}, []string{this.Profile})
+	}
+	return nil
+}
+
+// bind the verified phone to the account
+func (this *Account) SetPhone(phone string) error {
+	change := bson.M{
+		"$set": bson.M{
+			"phone": phone,
+		},
+	}
 	if err := updateId(accountColl, this.Id, change, true); err != nil {
 		return errors.NewError(errors.DbError, err.Error())
 	}
+	this.Phone = phone
 	return nil
 }
 
@@ -264,6 +337,36 @@ func (this *Account) UpdateBanTime(banTime int64) error {
 	return nil
 }
 
+// reset the nickname, the profile image, the photos and the about of the abusive user, the files are released.
+func (this *Account) ResetProfile() error {
+	nickname := "用户" + bson.NewObjectId().Hex()[16:]
+	change := bson.M{
+		"$set": bson.M{
+			"nickname": nickname,
+		},
+		"$unset": bson.M{
+			"profile": 1,
+			"about":   1,
+			"photos":  1,
+		},
+	}
+	old := &Account{}
+	if _, err := apply(accountColl, bson.M{"_id": this.Id}, mgo.Change{Update: change}, old); err != nil {
+		if err == mgo.ErrNotFound {
+			return errors.NewError(errors.NotExistsError)
+		}
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	changeFileRefs(append([]string{old.Profile}, old.Photos...), nil)
+	reindexUser(this.Id)
+
+	this.Nickname = nickname
+	this.Profile = ""
+	this.About = ""
+	this.Photos = nil
+	return nil
+}
+
 /*
 func (this *Account) UpdateLevel(score int, level int) error {
 	change := bson.M{
@@ -278,11 +381,22 @@ func (this *Account) UpdateLevel(score int, level int) error {
 	return nil
 }
 */
+// The location is stored at LocationPrecision only.
 func (this *Account) UpdateLocation(loc Location, locaddr string) error {
+	hash := ""
+	if loc.Lat != 0 || loc.Lng != 0 {
+		hash = Geohash(loc, LocationPrecision)
+	}
+	// the address of the location is shown with the location only, it's not saved to the profile
+	if len(locaddr) == 0 {
+		locaddr = Loc2Addr(loc).String()
+	}
 	change := bson.M{
 		"$set": bson.M{
-			"loc":     loc,
-			"locaddr": locaddr,
+			"loc":      RoundLocation(loc, LocationPrecision),
+			"locaddr":  locaddr,
+			"geohash":  hash,
+			"loc_time": time.Now(),
 		},
 	}
 	if err := updateId(accountColl, this.Id, change, true); err != nil {
@@ -291,6 +405,39 @@ func (this *Account) UpdateLocation(loc Location, locaddr string) error {
 	return nil
 }
 
+// The location from the profile address, for the users who have not reported one.
+// It is not used by the nearby search, as the location time is not set.
+func (this *Account) LocateAddr() error {
+	if this.Addr == nil {
+		return nil
+	}
+	loc := Addr2Loc(*this.Addr)
+	if loc.Lat == 0 && loc.Lng == 0 {
+		return nil
+	}
+
+	query := bson.M{
+		"_id": this.Id,
+		"$or": []bson.M{
+			{"loc": nil},
+			{"loc.latitude": 0, "loc.longitude": 0},
+		},
+	}
+	change := bson.M{
+		"$set": bson.M{
+			"loc": loc,
+		},
+	}
+	if err := update(accountColl, query, change, true); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	this.Loc = loc
+	return nil
+}
+
 /*
 func (this *Account) SetLogin(count int, lastlog time.Time) (int64, error) {
 	this.LoginCount = count
@@ -362,10 +509,21 @@ func (this *Account) SetWallet(wallet DbWallet) error {
 	return nil
 }
 
+// set the new plain password, the expired flag is cleared.
 func (this *Account) ChangePassword(newPass string) error {
+	hash, err := HashPassword(newPass)
+	if err != nil {
+		return err
+	}
+	this.Password = hash
+	this.PasswordExpired = false
+
 	change := bson.M{
 		"$set": bson.M{
-			"password": newPass,
+			"password": hash,
+		},
+		"$unset": bson.M{
+			"password_expired": 1,
 		},
 	}
 
@@ -384,9 +542,13 @@ func (this *Account) ChangeProfile(profile string) error {
 		},
 	}
 
-	if err := update(accountColl, bson.M{"_id": this.Id}, change, true); err != nil {
+	old := &Account{}
+	if _, err := apply(accountColl, bson.M{"_id": this.Id}, mgo.Change{Update: change}, old); err != nil {
 		return errors.NewError(errors.DbError, err.Error())
 	}
+	if old.Profile != profile {
+		changeFileRefs([]string{old.Profile}, []string{profile})
+	}
 	return nil
 }
 
@@ -398,9 +560,17 @@ func (this *Account) AddPhotos(photos []string) error {
 			},
 		},
 	}
-	if err := update(accountColl, bson.M{"_id": this.Id}, change, true); err != nil {
+	old := &Account{}
+	if _, err := apply(accountColl, bson.M{"_id": this.Id}, mgo.Change{Update: change}, old); err != nil {
 		return errors.NewError(errors.DbError, err.Error())
 	}
+	var added []string
+	for _, photo := range photos {
+		if !containsString(old.Photos, photo) && !containsString(added, photo) {
+			added = append(added, photo)
+		}
+	}
+	changeFileRefs(nil, added)
 	return nil
 }
 
@@ -410,9 +580,13 @@ func (this *Account) DelPhoto(id string) error {
 			"photos": id,
 		},
 	}
-	if err := update(accountColl, bson.M{"_id": this.Id}, change, true); err != nil {
+	old := &Account{}
+	if _, err := apply(accountColl, bson.M{"_id": this.Id}, mgo.Change{Update: change}, old); err != nil {
 		return errors.NewError(errors.DbError, err.Error())
 	}
+	if containsString(old.Photos, id) {
+		changeFileRefs([]string{id}, nil)
+	}
 	return nil
 }
 
@@ -433,19 +607,10 @@ func (this *Account) Recommend(friends []string) (users []Account, err error) {
 	}
 
 	if this.Loc.Lat != 0 && this.Loc.Lng != 0 {
-		query := bson.M{
-			"loc": bson.D{
-				{"$near", []float64{this.Loc.Lat, this.Loc.Lng}},
-				{"$maxDistance", float64(50000) / float64(111319)},
-			},
-			"_id": bson.M{
-				"$nin": friends,
-			},
-		}
-		list = nil
-		err = search(accountColl, query, nil, 0, 50, nil, nil, &list)
-		users = append(users, list...)
-		for _, user := range list {
+		var nearby []Neighbor
+		nearby, err = NearbyUsers(this.Loc, 50000, friends, 50)
+		for _, user := range nearby {
+			users = append(users, user.Account)
 			friends = append(friends, user.Id)
 		}
 	}
@@ -1060,7 +1225,7 @@ func Users(ids []string, paging *Paging) ([]Account, error) {
 }
 
 func (this *Account) ArticleCount() (count int) {
-	query := bson.M{"author": this.Id, "parent": nil}
+	query := bson.M{"author": this.Id, "parent": nil, "draft": bson.M{"$ne": true}}
 	search(articleColl, query, nil, 0, 0, nil, &count, nil)
 	return
 }
@@ -1111,6 +1276,10 @@ func searchPagingFunc(c *mgo.Collection, first, last string, args ...interface{}
 }
 
 func Search(nickname string, paging *Paging) ([]Account, error) {
+	if len(nickname) > 0 {
+		return searchUsers(nickname, paging)
+	}
+
 	var users []Account
 	total := 0
 
@@ -1120,13 +1289,6 @@ func Search(nickname string, paging *Paging) ([]Account, error) {
 		},
 	}
 
-	if len(nickname) > 0 {
-		query["nickname"] = bson.M{
-			"$regex":   nickname,
-			"$options": "i",
-		}
-	}
-
 	pageUp := false
 	sortFields := []string{"-lastlogin"}
 	if len(paging.First) > 0 {
@@ -1159,43 +1321,35 @@ func Search(nickname string, paging *Paging) ([]Account, error) {
 	return users, nil
 }
 
-func (this *Account) SearchNear(paging *Paging, distance int) ([]Account, error) {
-	var users []Account
-	total := 0
-	fmt.Println("search nearby:", this.Loc.Lat, this.Loc.Lng, distance)
-	if this.Loc.Lat == 0 && this.Loc.Lng == 0 {
-		return nil, nil
-	}
-	query := bson.M{
-		"loc": bson.M{
-			"$near": []float64{this.Loc.Lat, this.Loc.Lng},
-		},
-	}
-	if distance > 0 {
-		query = bson.M{
-			"loc": bson.D{
-				{"$near", []float64{this.Loc.Lat, this.Loc.Lng}},
-				{"$maxDistance", float64(distance) / float64(111319)},
-			},
-		}
+// the nearby users within the distance in meters, paged by the userid of the last one.
+func (this *Account) SearchNear(paging *Paging, distance int) ([]Neighbor, error) {
+	list, err := NearbyUsers(this.Loc, distance, []string{this.Id}, 0)
+	if err != nil {
+		return nil, err
 	}
+	total := len(list)
 
-	log.Println(query)
-	if err := psearch(accountColl, query, nil, nil, nil, &users, nil, paging); err != nil {
-		if err != mgo.ErrNotFound {
-			return nil, errors.NewError(errors.DbError, err.Error())
+	if len(paging.Last) > 0 {
+		for i, _ := range list {
+			if list[i].Id == paging.Last {
+				list = list[i+1:]
+				break
+			}
 		}
 	}
+	if paging.Count > 0 && len(list) > paging.Count {
+		list = list[:paging.Count]
+	}
 
 	paging.First = ""
 	paging.Last = ""
 	paging.Count = 0
-	if len(users) > 0 {
-		paging.First = users[0].Id
-		paging.Last = users[len(users)-1].Id
+	if len(list) > 0 {
+		paging.First = list[0].Id
+		paging.Last = list[len(list)-1].Id
 		paging.Count = total
 	}
-	return users, nil
+	return list, nil
 }
 
 func (this *Account) AddWalletAddr(addr string) error {
@@ -1219,9 +1373,19 @@ func (this *Account) ClearEvent(eventType string, eventId string) int {
 }
 
 func (this *Account) UpdateInfo(change bson.M) error {
-	if err := updateId(accountColl, this.Id, change, true); err != nil {
+	old := &Account{}
+	if _, err := apply(accountColl, bson.M{"_id": this.Id}, mgo.Change{Update: change}, old); err != nil {
 		return errors.NewError(errors.DbError, err.Error())
 	}
+	reindexUser(this.Id)
+
+	// the profile and the photos may be changed
+	user := &Account{}
+	if find, err := user.FindByUserid(this.Id); find {
+		changeFileRefs(append([]string{old.Profile}, old.Photos...), append([]string{user.Profile}, user.Photos...))
+	} else if err != nil {
+		log.Println(err)
+	}
 	return nil
 }
 
@@ -1242,7 +1406,16 @@ func (this *Account) AddTask(typ string, tid int, proofs []string) error {
 		"_id": this.Id,
 	}
 
-	update(accountColl, selector, bson.M{"$pull": bson.M{"tasks.proofs": bson.M{"tid": tid}}}, true)
+	// the proof images submitted before are released
+	old := &Account{}
+	pull := bson.M{"$pull": bson.M{"tasks.proofs": bson.M{"tid": tid}}}
+	apply(accountColl, selector, mgo.Change{Update: pull}, old)
+	var released []string
+	for _, proof := range old.Tasks.Proofs {
+		if proof.Tid == tid {
+			released = append(released, proof.Pics...)
+		}
+	}
 
 	var change bson.M
 	if typ == TaskRunning {
@@ -1272,6 +1445,11 @@ func (this *Account) AddTask(typ string, tid int, proofs []string) error {
 	if err := update(accountColl, selector, change, true); err != nil {
 		return errors.NewError(errors.DbError, err.Error())
 	}
+	if typ == TaskRunning {
+		changeFileRefs(released, proofs)
+	} else {
+		changeFileRefs(released, nil)
+	}
 	return nil
 }
 
@@ -1315,7 +1493,8 @@ func (this *Account) SetTaskComplete(tid int, completed bool, reason string) err
 	return nil
 }
 
-func (this *Account) Articles(typ string, paging *Paging) (int, []Article, error) {
+// the articles or the comments of the user, without the ones with the hidden visibilities.
+func (this *Account) Articles(typ string, hidden []string, paging *Paging) (int, []Article, error) {
 	var articles []Article
 	total := 0
 	var query bson.M
@@ -1323,9 +1502,12 @@ func (this *Account) Articles(typ string, paging *Paging) (int, []Article, error
 	case "COMMENTS":
 		query = bson.M{"author": this.Id, "parent": bson.M{"$ne": nil}}
 	case "ARTICLES":
-		query = bson.M{"author": this.Id, "parent": nil}
+		query = bson.M{"author": this.Id, "parent": nil, "draft": bson.M{"$ne": true}}
 	default:
-		query = bson.M{"author": this.Id}
+		query = bson.M{"author": this.Id, "draft": bson.M{"$ne": true}}
+	}
+	if len(hidden) > 0 {
+		query["visibility"] = bson.M{"$nin": hidden}
 	}
 
 	pageUp := false
@@ -1569,7 +1751,7 @@ func (this *Account) RmDevice(dev string) error {
 
 func (this *Account) LatestArticle() *Article {
 	article := &Article{}
-	findOne(articleColl, bson.M{"author": this.Id, "parent": nil},
+	findOne(articleColl, bson.M{"author": this.Id, "parent": nil, "draft": bson.M{"$ne": true}},
 		[]string{"-pub_time"}, article)
 
 	return article
@@ -0,0 +1,306 @@
+// activity
+package models
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"strconv"
+	"time"
+)
+
+const (
+	ActivityRadius       = 200  // the default check-in radius in meters
+	ActivityCheckinEarly = 3600 // the check-in opens an hour before the start
+	ActivityNearbyMax    = 1000 // the max nearby activities can be paged through
+)
+
+func init() {
+	ensureIndex(activityColl, "creator")
+	ensureIndex(activityColl, "gid", "-start")
+	ensureIndex(activityColl, "going")
+	ensureIndex2D(activityColl, "loc")
+}
+
+type Checkin struct {
+	Userid string    `json:"userid"`
+	Method string    `json:"method"` // qrcode or geofence
+	Time   time.Time `json:"-"`
+}
+
+type ActivityResult struct {
+	Userid   string `json:"userid"`
+	Record   string `json:"record_id"`
+	Distance int    `json:"distance"`
+	Duration int64  `json:"duration"`
+}
+
+// The organised run or race. The users sign up until the capacity is full, then they are put in the waitlist,
+// and they are moved from the waitlist in order when the others leave.
+type Activity struct {
+	Id        bson.ObjectId `bson:"_id,omitempty"`
+	Creator   string
+	Gid       string `bson:",omitempty"` // the group organised the activity
+	Title     string
+	Desc      string   `bson:",omitempty"`
+	Addr      *Address `bson:",omitempty"`
+	Loc       Location
+	Radius    int // the geofence radius in meters
+	Capacity  int // 0 is unlimited
+	Start     time.Time
+	End       time.Time
+	Time      time.Time
+	Code      string // the check-in code of the qrcode
+	Cancelled bool   `bson:",omitempty"`
+
+	Going    []string         `bson:",omitempty"`
+	Waitlist []string         `bson:",omitempty"`
+	Checkins []Checkin        `bson:",omitempty"`
+	Results  []ActivityResult `bson:",omitempty"`
+}
+
+func (this *Activity) FindById(id string) (bool, error) {
+	if !bson.IsObjectIdHex(id) {
+		return false, nil
+	}
+	if err := findOne(activityColl, bson.M{"_id": bson.ObjectIdHex(id)}, nil, this); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, errors.NewError(errors.DbError, err.Error())
+	}
+	return true, nil
+}
+
+func (this *Activity) Save() error {
+	this.Id = bson.NewObjectId()
+	this.Time = time.Now()
+	if this.Radius <= 0 {
+		this.Radius = ActivityRadius
+	}
+	if err := save(activityColl, this, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+func (this *Activity) Cancel() error {
+	change := bson.M{
+		"$set": bson.M{
+			"cancelled": true,
+		},
+	}
+	if err := updateId(activityColl, this.Id, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	this.Cancelled = true
+	return nil
+}
+
+// the status of the user in the activity: going, waitlist, checkedin or empty.
+func (this *Activity) Status(userid string) string {
+	for _, c := range this.Checkins {
+		if c.Userid == userid {
+			return "checkedin"
+		}
+	}
+	if containsString(this.Going, userid) {
+		return "going"
+	}
+	if containsString(this.Waitlist, userid) {
+		return "waitlist"
+	}
+	return ""
+}
+
+// the selector matches if the activity is not full
+func (this *Activity) notFull(selector bson.M) bson.M {
+	if this.Capacity > 0 {
+		selector["going."+strconv.Itoa(this.Capacity-1)] = bson.M{"$exists": false}
+	}
+	return selector
+}
+
+// sign up the activity, the user is put in the waitlist if the activity is full.
+// It returns the status of the user.
+func (this *Activity) Join(userid string) (string, error) {
+	if status := this.Status(userid); len(status) > 0 {
+		return status, nil
+	}
+
+	selector := this.notFull(bson.M{
+		"_id":      this.Id,
+		"going":    bson.M{"$ne": userid},
+		"waitlist": bson.M{"$ne": userid},
+	})
+	change := bson.M{"$push": bson.M{"going": userid}}
+	err := update(activityColl, selector, change, true)
+	if err == nil {
+		this.Going = append(this.Going, userid)
+		return "going", nil
+	}
+	if err != mgo.ErrNotFound {
+		return "", errors.NewError(errors.DbError, err.Error())
+	}
+
+	// full
+	selector = bson.M{
+		"_id":      this.Id,
+		"going":    bson.M{"$ne": userid},
+		"waitlist": bson.M{"$ne": userid},
+	}
+	change = bson.M{"$push": bson.M{"waitlist": userid}}
+	if err := update(activityColl, selector, change, true); err != nil && err != mgo.ErrNotFound {
+		return "", errors.NewError(errors.DbError, err.Error())
+	}
+	this.Waitlist = append(this.Waitlist, userid)
+	return "waitlist", nil
+}
+
+// leave the activity, the first users in the waitlist take the places.
+// It returns the users moved from the waitlist.
+func (this *Activity) Leave(userid string) ([]string, error) {
+	change := bson.M{
+		"$pull": bson.M{
+			"going":    userid,
+			"waitlist": userid,
+			"checkins": bson.M{"userid": userid},
+		},
+	}
+	if err := updateId(activityColl, this.Id, change, true); err != nil {
+		return nil, errors.NewError(errors.DbError, err.Error())
+	}
+	if _, err := this.FindById(this.Id.Hex()); err != nil {
+		return nil, err
+	}
+
+	var promoted []string
+	for len(this.Waitlist) > 0 && (this.Capacity == 0 || len(this.Going) < this.Capacity) {
+		first := this.Waitlist[0]
+		selector := this.notFull(bson.M{
+			"_id":        this.Id,
+			"waitlist.0": first,
+		})
+		change := bson.M{
+			"$pull": bson.M{"waitlist": first},
+			"$push": bson.M{"going": first},
+		}
+		if err := update(activityColl, selector, change, true); err != nil {
+			if err != mgo.ErrNotFound {
+				return promoted, errors.NewError(errors.DbError, err.Error())
+			}
+		} else {
+			promoted = append(promoted, first)
+		}
+		// reload for the concurrent changes
+		if _, err := this.FindById(this.Id.Hex()); err != nil {
+			return promoted, err
+		}
+	}
+	return promoted, nil
+}
+
+// check in the activity by the method
+func (this *Activity) Checkin(userid, method string) error {
+	selector := bson.M{
+		"_id":             this.Id,
+		"going":           userid,
+		"checkins.userid": bson.M{"$ne": userid},
+	}
+	change := bson.M{
+		"$push": bson.M{
+			"checkins": &Checkin{Userid: userid, Method: method, Time: time.Now()},
+		},
+	}
+	if err := update(activityColl, selector, change, true); err != nil && err != mgo.ErrNotFound {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+// set the record as the result of the user, the previous result is replaced.
+func (this *Activity) SetResult(record *Record) error {
+	result := &ActivityResult{
+		Userid: record.Uid,
+		Record: record.Id.Hex(),
+	}
+	if record.Sport != nil {
+		result.Distance = record.Sport.Distance
+		result.Duration = record.Sport.Duration
+	}
+
+	selector := bson.M{
+		"_id":            this.Id,
+		"results.userid": record.Uid,
+	}
+	err := update(activityColl, selector, bson.M{"$set": bson.M{"results.$": result}}, true)
+	if err == mgo.ErrNotFound {
+		selector["results.userid"] = bson.M{"$ne": record.Uid}
+		err = update(activityColl, selector, bson.M{"$push": bson.M{"results": result}}, true)
+	}
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+// the upcoming activities near the location within the distance in meters, the nearest first.
+// The results are ordered by the distance, so the next page starts after the activity paging.Last
+// in the same order, the page is empty if that activity is no longer listed.
+func NearbyActivities(loc Location, distance int, paging *Paging) ([]Activity, error) {
+	var activities []Activity
+	query := bson.M{
+		"loc": bson.D{
+			{"$near", []float64{loc.Lat, loc.Lng}},
+			{"$maxDistance", float64(distance) / float64(111319)},
+		},
+		"end":       bson.M{"$gt": time.Now()},
+		"cancelled": bson.M{"$ne": true},
+	}
+	if paging.Count == 0 {
+		paging.Count = DefaultPageSize
+	}
+
+	err := withCollection(activityColl, nil, func(c *mgo.Collection) error {
+		iter := c.Find(query).Limit(ActivityNearbyMax).Iter()
+		found := len(paging.Last) == 0
+		for len(activities) < paging.Count {
+			activity := Activity{}
+			if !iter.Next(&activity) {
+				break
+			}
+			if !found {
+				found = activity.Id.Hex() == paging.Last
+				continue
+			}
+			activities = append(activities, activity)
+		}
+		return iter.Close()
+	})
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, errors.NewError(errors.DbError, err.Error())
+	}
+
+	paging.First = ""
+	paging.Last = ""
+	paging.Count = 0
+	if len(activities) > 0 {
+		paging.First = activities[0].Id.Hex()
+		paging.Last = activities[len(activities)-1].Id.Hex()
+	}
+	return activities, nil
+}
+
+// the upcoming activities of the group
+func GroupActivities(gid string) ([]Activity, error) {
+	var activities []Activity
+	query := bson.M{
+		"gid":       gid,
+		"end":       bson.M{"$gt": time.Now()},
+		"cancelled": bson.M{"$ne": true},
+	}
+	if err := search(activityColl, query, nil, 0, 0, []string{"start"}, nil, &activities); err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
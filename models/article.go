@@ -9,11 +9,19 @@ import (
 	"log"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MaxTopicLength = 20
 )
 
 func init() {
 	ensureIndex(articleColl, "author")
 	ensureIndex(articleColl, "-pub_time")
+	ensureIndex(articleColl, "mentions")
+	ensureIndex(articleColl, "draft", "pub_time")
 }
 
 type Segment struct {
@@ -36,6 +44,20 @@ type Article struct {
 	Rewards     []string `bson:",omitempty"`
 	TotalReward int64    `bson:"total_reward"`
 	Tags        []string `bson:",omitempty"`
+	Mentions    []string `bson:",omitempty"`
+
+	Draft      bool      `bson:",omitempty"`
+	Scheduled  bool      `bson:",omitempty"`
+	EditTime   time.Time `bson:"edit_time,omitempty"`
+	Visibility string    `bson:",omitempty"` // public, followers, friends or private
+
+	// comment
+	Root       string `bson:",omitempty"`
+	ReplyTo    string `bson:"reply_to,omitempty"`
+	ReplyUser  string `bson:"reply_user,omitempty"`
+	ReplyCount int    `bson:"reply_count"`
+	ThumbCount int    `bson:"thumb_count"`
+	Deleted    bool   `bson:",omitempty"`
 }
 
 func (this *Article) Cover() (text string, image string) {
@@ -53,6 +75,72 @@ func (this *Article) Cover() (text string, image string) {
 	return
 }
 
+// topics in the text segments, a topic starts with '#' and ends with '#', a space or punctuation.
+func (this *Article) Topics() []string {
+	var topics []string
+
+	for _, seg := range this.Contents {
+		if strings.ToUpper(seg.ContentType) != "TEXT" {
+			continue
+		}
+		for _, topic := range findTopics(seg.ContentText) {
+			dup := false
+			for _, t := range topics {
+				if t == topic {
+					dup = true
+					break
+				}
+			}
+			if !dup {
+				topics = append(topics, topic)
+			}
+		}
+	}
+
+	return topics
+}
+
+func findTopics(text string) []string {
+	var topics []string
+
+	for {
+		i := strings.Index(text, "#")
+		if i < 0 {
+			break
+		}
+		text = text[i+1:]
+
+		topic := text
+		end := strings.IndexFunc(text, func(r rune) bool {
+			return unicode.IsSpace(r) || (unicode.IsPunct(r) && r != '_' && r != '-')
+		})
+		if end >= 0 {
+			topic = text[:end]
+			text = text[end:]
+		} else {
+			text = ""
+		}
+		// closing '#'
+		if strings.HasPrefix(text, "#") {
+			text = text[1:]
+		}
+
+		if topic = NormalizeTopic(topic); len(topic) > 0 {
+			topics = append(topics, topic)
+		}
+	}
+
+	return topics
+}
+
+func NormalizeTopic(topic string) string {
+	topic = strings.ToLower(strings.TrimSpace(topic))
+	if n := utf8.RuneCountInString(topic); n == 0 || n > MaxTopicLength {
+		return ""
+	}
+	return topic
+}
+
 func FindArticles(ids ...string) (articles []Article, err error) {
 	var oid []interface{}
 	for _, id := range ids {
@@ -92,6 +180,8 @@ func (this *Article) Save() error {
 		if err := save(articleColl, this, true); err != nil {
 			return errors.NewError(errors.DbError, err.Error())
 		}
+		indexArticle(this)
+		changeFileRefs(nil, imageRefs(this.Contents))
 		return nil
 	}
 
@@ -119,6 +209,18 @@ func (this *Article) Save() error {
 				},
 			},
 		}
+		if bson.IsObjectIdHex(this.Root) {
+			ops = append(ops, txn.Op{
+				C:      articleColl,
+				Id:     bson.ObjectIdHex(this.Root),
+				Assert: txn.DocExists,
+				Update: bson.M{
+					"$inc": bson.M{
+						"reply_count": 1,
+					},
+				},
+			})
+		}
 
 		return runner.Run(ops, bson.NewObjectId(), nil)
 	}
@@ -127,15 +229,95 @@ func (this *Article) Save() error {
 		log.Println(err)
 		return errors.NewError(errors.DbError, err.Error())
 	}
+	changeFileRefs(nil, imageRefs(this.Contents))
+	return nil
+}
+
+// save the edited contents, a revision of the changes is stored for the published article.
+func (this *Article) Edit(editor string, old []Segment) error {
+	m := bson.M{
+		"contents": this.Contents,
+		"tags":     this.Tags,
+		"mentions": this.Mentions,
+	}
+
+	// the tags may be changed without the contents, no revision is needed
+	if removed, added := DiffSegments(old, this.Contents); !this.Draft && (len(removed) > 0 || len(added) > 0) {
+		revision := &Revision{
+			Article: this.Id.Hex(),
+			Editor:  editor,
+			Time:    time.Now(),
+			Removed: removed,
+			Added:   added,
+		}
+		if err := revision.Save(); err != nil {
+			return err
+		}
+		this.EditTime = revision.Time
+		m["edit_time"] = this.EditTime
+	}
+
+	if err := updateId(articleColl, this.Id, bson.M{"$set": m}, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	indexArticle(this)
+	changeFileRefs(imageRefs(old), imageRefs(this.Contents))
 	return nil
 }
 
+// publish the draft, it will be scheduled if the pubTime is in the future.
+// It returns false if the draft has been published by others.
+func (this *Article) Publish(pubTime time.Time) (bool, error) {
+	now := time.Now()
+	if pubTime.Before(now) {
+		pubTime = now
+	}
+	scheduled := pubTime.After(now)
+
+	change := bson.M{
+		"$set": bson.M{
+			"draft":     scheduled,
+			"scheduled": scheduled,
+			"pub_time":  pubTime,
+		},
+	}
+	selector := bson.M{"_id": this.Id, "draft": true}
+	if err := update(articleColl, selector, change, true); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, errors.NewError(errors.DbError, err.Error())
+	}
+
+	this.Draft = scheduled
+	this.Scheduled = scheduled
+	this.PubTime = pubTime
+	reindexArticle(this.Id)
+	return true, nil
+}
+
+// scheduled articles which should be published now
+func DueArticles() ([]Article, error) {
+	var articles []Article
+
+	query := bson.M{
+		"draft":     true,
+		"scheduled": true,
+		"pub_time":  bson.M{"$lte": time.Now()},
+	}
+	err := search(articleColl, query, nil, 0, 0, []string{"pub_time"}, nil, &articles)
+	return articles, err
+}
+
 func (this *Article) RemoveId() error {
+	if find, err := this.findOne(bson.M{"_id": this.Id}); !find {
+		return err
+	}
 	if err := removeId(articleColl, this.Id, true); err != nil {
-		if e, ok := err.(*mgo.LastError); ok {
-			return errors.NewError(errors.DbError, e.Error())
-		}
+		return errors.NewError(errors.DbError, err.Error())
 	}
+	articleIndex.Remove(this.Id.Hex())
+	changeFileRefs(imageRefs(this.Contents), nil)
 	return nil
 }
 
@@ -146,11 +328,11 @@ func (this *Article) Remove() error {
 	}
 
 	if len(this.Parent) == 0 {
-		if err := removeId(articleColl, this.Id.Hex(), true); err != nil {
-			if e, ok := err.(*mgo.LastError); ok {
-				return errors.NewError(errors.DbError, e.Error())
-			}
+		if err := removeId(articleColl, this.Id, true); err != nil {
+			return errors.NewError(errors.DbError, err.Error())
 		}
+		articleIndex.Remove(this.Id.Hex())
+		changeFileRefs(imageRefs(this.Contents), nil)
 		return nil
 	}
 
@@ -179,17 +361,27 @@ func (this *Article) Remove() error {
 		log.Println(err)
 		return errors.NewError(errors.DbError, err.Error())
 	}
+	changeFileRefs(imageRefs(this.Contents), nil)
 	return nil
 }
 
 func (article *Article) Update() error {
 	m := bson.M{}
+	var old []Segment
 
 	if len(article.Author) > 0 {
 		m["author"] = article.Author
 	}
 	if len(article.Contents) > 0 {
 		m["contents"] = article.Contents
+		a := &Article{}
+		if find, err := a.findOne(bson.M{"_id": article.Id}); !find {
+			if err == nil {
+				err = errors.NewError(errors.NotExistsError)
+			}
+			return err
+		}
+		old = a.Contents
 	}
 	if len(article.Tags) > 0 {
 		m["tags"] = article.Tags
@@ -205,28 +397,39 @@ func (article *Article) Update() error {
 	if err := updateId(articleColl, article.Id, change, true); err != nil {
 		return errors.NewError(errors.DbError, err.Error())
 	}
+	reindexArticle(article.Id)
+	if len(article.Contents) > 0 {
+		changeFileRefs(imageRefs(old), imageRefs(article.Contents))
+	}
 	return nil
 }
 
 func (this *Article) SetThumb(userid string, thumb bool) error {
-
-	var m bson.M
+	var selector, m bson.M
 
 	if thumb {
+		selector = bson.M{"_id": this.Id, "thumbs": bson.M{"$ne": userid}}
 		m = bson.M{
-			"$addToSet": bson.M{
+			"$push": bson.M{
 				"thumbs": userid,
 			},
+			"$inc": bson.M{
+				"thumb_count": 1,
+			},
 		}
 	} else {
+		selector = bson.M{"_id": this.Id, "thumbs": userid}
 		m = bson.M{
 			"$pull": bson.M{
 				"thumbs": userid,
 			},
+			"$inc": bson.M{
+				"thumb_count": -1,
+			},
 		}
 	}
 
-	if err := updateId(articleColl, this.Id, m, true); err != nil {
+	if err := update(articleColl, selector, m, true); err != nil && err != mgo.ErrNotFound {
 		return errors.NewError(errors.DbError, err.Error())
 	}
 
@@ -279,7 +482,9 @@ func GetArticles(tag string, paging *Paging) (int, []Article, error) {
 	total := 0
 
 	selector := bson.M{
-		"parent": nil,
+		"parent":     nil,
+		"draft":      bson.M{"$ne": true},
+		"visibility": bson.M{"$nin": HiddenVisibilities(RelNone)},
 	}
 	if len(tag) > 0 {
 		selector["tags"] = tag
@@ -320,12 +525,49 @@ func GetArticles(tag string, paging *Paging) (int, []Article, error) {
 	return total, articles, nil
 }
 
-func (this *Article) CommentCount() (count int) {
-	search(articleColl, bson.M{"parent": this.Id.Hex()}, nil, 0, 0, nil, &count, nil)
-	return
+// top-level articles of the authors, newest published first. first and last are article ids used as cursors.
+func AuthorArticles(authors []string, first, last string, count int) ([]Article, error) {
+	var articles []Article
+
+	if len(authors) == 0 {
+		return nil, nil
+	}
+	if count <= 0 {
+		count = DefaultPageSize
+	}
+
+	query := bson.M{
+		"author": bson.M{"$in": authors},
+		"parent": nil,
+		"draft":  bson.M{"$ne": true},
+	}
+	pageUp := false
+	sortFields := []string{"-pub_time", "-_id"}
+	if len(first) > 0 {
+		pageUp = true
+		sortFields = []string{"pub_time", "_id"}
+	}
+
+	paging := &Paging{First: first, Last: last, Count: count}
+	if err := psearch(articleColl, query, nil,
+		sortFields, nil, &articles, articlePagingFunc, paging); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, errors.NewError(errors.NotFoundError, err.Error())
+		}
+		return nil, errors.NewError(errors.DbError, err.Error())
+	}
+
+	if pageUp {
+		for i := 0; i < len(articles)/2; i++ {
+			articles[i], articles[len(articles)-i-1] = articles[len(articles)-i-1], articles[i]
+		}
+	}
+
+	return articles, nil
 }
 
-func (this *Article) Comments(paging *Paging) (int, []Article, error) {
+// the drafts and scheduled articles of the author
+func DraftArticles(author string, paging *Paging) (int, []Article, error) {
 	var articles []Article
 	total := 0
 
@@ -336,7 +578,11 @@ func (this *Article) Comments(paging *Paging) (int, []Article, error) {
 		sortFields = []string{"pub_time"}
 	}
 
-	if err := psearch(articleColl, bson.M{"parent": this.Id.Hex()}, nil,
+	query := bson.M{
+		"author": author,
+		"draft":  true,
+	}
+	if err := psearch(articleColl, query, nil,
 		sortFields, &total, &articles, articlePagingFunc, paging); err != nil {
 		e := errors.NewError(errors.DbError, err.Error())
 		if err == mgo.ErrNotFound {
@@ -364,47 +610,10 @@ func (this *Article) Comments(paging *Paging) (int, []Article, error) {
 	return total, articles, nil
 }
 
-func (this *Article) AdminComments(pageIndex, pageCount int) (total int, articles []Article, err error) {
-	err = search(articleColl, bson.M{"parent": this.Id.Hex()}, nil,
-		pageIndex*pageCount, pageCount, []string{"-pub_time"}, &total, &articles)
-	return
-}
-
-func (this *Article) Reward(userid string, amount int64) error {
-	change := mgo.Change{
-		Update: bson.M{
-			"$addToSet": bson.M{
-				"rewards": userid,
-			},
-			"$inc": bson.M{
-				"total_reward": amount,
-			},
-		},
-		ReturnNew: true,
-	}
-	_, err := apply(articleColl, bson.M{"_id": this.Id}, change, this)
-
-	this.TotalReward += amount
-
-	return err
-}
-
-func PostCount(start, end time.Time) int {
-	c, _ := count(articleColl, bson.M{"pub_time": bson.M{"$gte": start, "$lt": end}})
-	return c
-}
-
-func SearchArticle(keyword string, paging *Paging) (int, []Article, error) {
+func MentionArticles(userid string, paging *Paging) (int, []Article, error) {
 	var articles []Article
 	total := 0
 
-	query := bson.M{
-		"contents.seg_content": bson.M{
-			"$regex":   keyword,
-			"$options": "i",
-		},
-	}
-
 	pageUp := false
 	sortFields := []string{"-pub_time"}
 	if len(paging.First) > 0 {
@@ -412,11 +621,17 @@ func SearchArticle(keyword string, paging *Paging) (int, []Article, error) {
 		sortFields = []string{"pub_time"}
 	}
 
-	if err := psearch(articleColl, query, nil, sortFields, &total, &articles,
-		articlePagingFunc, paging); err != nil {
-		if err != mgo.ErrNotFound {
-			return total, nil, errors.NewError(errors.DbError, err.Error())
+	query := bson.M{
+		"mentions": userid,
+		"draft":    bson.M{"$ne": true},
+	}
+	if err := psearch(articleColl, query, nil,
+		sortFields, &total, &articles, articlePagingFunc, paging); err != nil {
+		e := errors.NewError(errors.DbError, err.Error())
+		if err == mgo.ErrNotFound {
+			e = errors.NewError(errors.NotFoundError, err.Error())
 		}
+		return total, nil, e
 	}
 
 	paging.First = ""
@@ -438,31 +653,39 @@ func SearchArticle(keyword string, paging *Paging) (int, []Article, error) {
 	return total, articles, nil
 }
 
-func AdminSearchArticle(keyword string, tag string,
-	pageIndex, pageCount int) (total int, articles []Article, err error) {
-	query := bson.M{}
+func (this *Article) CommentCount() (count int) {
+	search(articleColl, bson.M{"parent": this.Id.Hex()}, nil, 0, 0, nil, &count, nil)
+	return
+}
+
+func (this *Article) AdminComments(pageIndex, pageCount int) (total int, articles []Article, err error) {
+	err = search(articleColl, bson.M{"parent": this.Id.Hex()}, nil,
+		pageIndex*pageCount, pageCount, []string{"-pub_time"}, &total, &articles)
+	return
+}
 
-	if len(keyword) == 0 {
-		query = bson.M{
-			"parent": nil,
-			"tags":   tag,
-		}
-	} else {
-		query = bson.M{
-			"parent": nil,
-			"contents.seg_content": bson.M{
-				"$regex":   keyword,
-				"$options": "i",
+func (this *Article) Reward(userid string, amount int64) error {
+	change := mgo.Change{
+		Update: bson.M{
+			"$addToSet": bson.M{
+				"rewards": userid,
 			},
-		}
-		if len(tag) > 0 {
-			query["tags"] = tag
-		}
+			"$inc": bson.M{
+				"total_reward": amount,
+			},
+		},
+		ReturnNew: true,
 	}
+	_, err := apply(articleColl, bson.M{"_id": this.Id}, change, this)
 
-	err = search(articleColl, query, nil,
-		pageIndex*pageCount, pageCount, []string{"-pub_time"}, &total, &articles)
-	return
+	this.TotalReward += amount
+
+	return err
+}
+
+func PostCount(start, end time.Time) int {
+	c, _ := count(articleColl, bson.M{"pub_time": bson.M{"$gte": start, "$lt": end}})
+	return c
 }
 
 func ArticleList(sort string, pageIndex, pageCount int) (total int, articles []Article, err error) {
@@ -0,0 +1,242 @@
+// challenge
+package models
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// the metrics of the challenges
+const (
+	ChallengeDistance = "distance" // total distance in meters
+	ChallengeDuration = "duration" // total duration in seconds
+	ChallengeRecords  = "records"  // count of the sport records
+)
+
+func init() {
+	ensureIndex(challengeColl, "groups", "-_id")
+	ensureIndex(challengeColl, "finished", "end")
+	ensureIndex(challengeColl, "settled", "end")
+	ensureIndex(challengeColl, "invited")
+}
+
+type ChallengeResult struct {
+	Gid     string `json:"group_id"`
+	Score   int64  `json:"score"`
+	Rank    int    `json:"rank"`
+	Reached bool   `json:"reached"`
+}
+
+// The challenge is created by the admin of the group, and the members of the opposing groups compete with them.
+// The opposing groups are invited, they join the challenge after their admins accept it.
+// The qualifying records of the members are counted in the challenge until it ends.
+type Challenge struct {
+	Id      bson.ObjectId `bson:"_id,omitempty"`
+	Gid     string        // the group created the challenge
+	Creator string
+	Title   string
+	Desc    string `bson:",omitempty"`
+	Metric  string
+	Target  int64    // the target of each group
+	Groups  []string // the group created the challenge and the opposing groups accepted it
+	Invited []string `bson:",omitempty"` // the opposing groups not accepted yet
+	Start   time.Time
+	End     time.Time
+	Time    time.Time
+
+	// the awards set by the admins when the challenge was created
+	WinnerAwards   Props // for the contributing members of the winner group
+	FinisherAwards Props // for the contributing members of the groups reached the target
+
+	Finished bool
+	Results  []ChallengeResult `bson:",omitempty"`
+	Awarded  []string          `bson:",omitempty"` // the members have been awarded
+	Settled  bool              // all the awards are given
+}
+
+func ValidChallengeMetric(metric string) bool {
+	switch metric {
+	case ChallengeDistance, ChallengeDuration, ChallengeRecords:
+		return true
+	}
+	return false
+}
+
+func (this *Challenge) FindById(id string) (bool, error) {
+	if !bson.IsObjectIdHex(id) {
+		return false, nil
+	}
+	if err := findOne(challengeColl, bson.M{"_id": bson.ObjectIdHex(id)}, nil, this); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, errors.NewError(errors.DbError, err.Error())
+	}
+	return true, nil
+}
+
+func (this *Challenge) Save() error {
+	this.Id = bson.NewObjectId()
+	this.Time = time.Now()
+	if !containsString(this.Groups, this.Gid) {
+		this.Groups = append([]string{this.Gid}, this.Groups...)
+	}
+	if err := save(challengeColl, this, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+// the value of the record counted in the challenge, 0 if the record doesn't qualify.
+func (this *Challenge) RecordValue(record *Record) int64 {
+	if this.Finished || record.Sport == nil ||
+		record.Time.Before(this.Start) || record.Time.After(this.End) {
+		return 0
+	}
+	switch this.Metric {
+	case ChallengeDistance:
+		return int64(record.Sport.Distance)
+	case ChallengeDuration:
+		return record.Sport.Duration
+	case ChallengeRecords:
+		return 1
+	}
+	return 0
+}
+
+// the opposing group accepts or rejects the invitation before the challenge ends.
+func (this *Challenge) Accept(gid string, accept bool) error {
+	selector := bson.M{
+		"_id":      this.Id,
+		"invited":  gid,
+		"finished": false,
+		"end":      bson.M{"$gt": time.Now()},
+	}
+	change := bson.M{
+		"$pull": bson.M{
+			"invited": gid,
+		},
+	}
+	if accept {
+		change["$addToSet"] = bson.M{"groups": gid}
+	}
+	if err := update(challengeColl, selector, change, true); err != nil {
+		if err == mgo.ErrNotFound {
+			return errors.NewError(errors.AccessError, "挑战已结束或未被邀请")
+		}
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	var invited []string
+	for _, g := range this.Invited {
+		if g != gid {
+			invited = append(invited, g)
+		}
+	}
+	this.Invited = invited
+	if accept && !containsString(this.Groups, gid) {
+		this.Groups = append(this.Groups, gid)
+	}
+	return nil
+}
+
+// mark the challenge finished with the results, the awards are given after that,
+// it's settled when all the awards are given.
+// It returns false if the challenge is already finished.
+func (this *Challenge) Finish(results []ChallengeResult) (bool, error) {
+	selector := bson.M{
+		"_id":      this.Id,
+		"finished": false,
+	}
+	change := bson.M{
+		"$set": bson.M{
+			"finished": true,
+			"results":  results,
+			"settled":  false,
+		},
+		"$unset": bson.M{
+			"invited": 1,
+		},
+	}
+	if err := update(challengeColl, selector, change, true); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, errors.NewError(errors.DbError, err.Error())
+	}
+	this.Finished = true
+	this.Results = results
+	this.Invited = nil
+	return true, nil
+}
+
+// mark the member awarded before the awards are given, so the member is never awarded twice
+// if the settlement is interrupted. It returns false if the member has been awarded.
+func (this *Challenge) SetAwarded(userid string) (bool, error) {
+	selector := bson.M{
+		"_id":     this.Id,
+		"awarded": bson.M{"$ne": userid},
+	}
+	change := bson.M{
+		"$push": bson.M{
+			"awarded": userid,
+		},
+	}
+	if err := update(challengeColl, selector, change, true); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, errors.NewError(errors.DbError, err.Error())
+	}
+	this.Awarded = append(this.Awarded, userid)
+	return true, nil
+}
+
+// all the awards of the finished challenge are given
+func (this *Challenge) Settle() error {
+	if err := updateId(challengeColl, this.Id, bson.M{"$set": bson.M{"settled": true}}, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	this.Settled = true
+	return nil
+}
+
+// the challenges of the group and the challenges the group is invited to, the latest first, paged by the challenge id.
+func GroupChallenges(gid string, paging *Paging) ([]Challenge, error) {
+	var challenges []Challenge
+	if paging.Count == 0 {
+		paging.Count = DefaultPageSize
+	}
+	query := bson.M{"$or": []bson.M{{"groups": gid}, {"invited": gid}}}
+	if bson.IsObjectIdHex(paging.Last) {
+		query["_id"] = bson.M{"$lt": bson.ObjectIdHex(paging.Last)}
+	}
+	if err := search(challengeColl, query, nil, 0, paging.Count, []string{"-_id"}, nil, &challenges); err != nil {
+		return nil, err
+	}
+
+	paging.First = ""
+	paging.Last = ""
+	if len(challenges) > 0 {
+		paging.First = challenges[0].Id.Hex()
+		paging.Last = challenges[len(challenges)-1].Id.Hex()
+	}
+	return challenges, nil
+}
+
+// the challenges ended but not finished or not settled
+func DueChallenges() ([]Challenge, error) {
+	var challenges []Challenge
+	query := bson.M{
+		"$or": []bson.M{
+			{"finished": false},
+			{"settled": false},
+		},
+		"end": bson.M{"$lte": time.Now()},
+	}
+	if err := search(challengeColl, query, nil, 0, 0, nil, nil, &challenges); err != nil {
+		return nil, err
+	}
+	return challenges, nil
+}
@@ -0,0 +1,243 @@
+// comment
+package models
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"labix.org/v2/mgo/txn"
+	"log"
+)
+
+const (
+	CommentSortNewest = "newest"
+	CommentSortLiked  = "liked"
+
+	ThreadReplyCount = 3 // replies shown with each thread
+)
+
+func init() {
+	registerMigration("thumb_count", migrateThumbCount)
+	ensureIndex(articleColl, "parent", "root", "-_id")
+	ensureIndex(articleColl, "parent", "root", "-thumb_count", "-_id")
+	ensureIndex(articleColl, "root", "_id")
+}
+
+// the thumb_count of the articles liked before
+func migrateThumbCount() (int, error) {
+	query := bson.M{"thumb_count": bson.M{"$exists": false}}
+	return migrateEach(articleColl, query, bson.M{"thumbs": 1},
+		func() interface{} { return &Article{} },
+		func(doc interface{}) (interface{}, bson.M) {
+			article := doc.(*Article)
+			return article.Id, bson.M{"$set": bson.M{"thumb_count": len(article.Thumbs)}}
+		})
+}
+
+// query of comments with the thumb count equal to count, old comments may have no thumb count.
+func thumbCountIs(count int) interface{} {
+	if count == 0 {
+		return bson.M{"$in": []interface{}{0, nil}}
+	}
+	return count
+}
+
+// the comment threads of the article, a reply to a reply joins the thread of its root.
+func (this *Article) Comments(sortBy string, paging *Paging) (int, []Article, error) {
+	var comments []Article
+	total := 0
+
+	query := bson.M{"parent": this.Id.Hex(), "root": nil}
+	if n, err := count(articleColl, query); err == nil {
+		total = n
+	}
+
+	pageUp := bson.IsObjectIdHex(paging.First)
+	cursor := paging.Last
+	if pageUp {
+		cursor = paging.First
+	}
+	if paging.Count <= 0 {
+		paging.Count = DefaultPageSize
+	}
+
+	var sortFields []string
+	switch sortBy {
+	case CommentSortLiked:
+		sortFields = []string{"-thumb_count", "-_id"}
+		if pageUp {
+			sortFields = []string{"thumb_count", "_id"}
+		}
+		c := &Article{}
+		if bson.IsObjectIdHex(cursor) {
+			if find, err := c.findOne(bson.M{"_id": bson.ObjectIdHex(cursor)}); !find {
+				return total, nil, err
+			}
+			op := "$lt"
+			if pageUp {
+				op = "$gt"
+			}
+			or := []bson.M{
+				{"thumb_count": thumbCountIs(c.ThumbCount), "_id": bson.M{op: c.Id}},
+			}
+			if pageUp {
+				or = append(or, bson.M{"thumb_count": bson.M{"$gt": c.ThumbCount}})
+			} else if c.ThumbCount > 0 {
+				or = append(or, bson.M{"thumb_count": bson.M{"$lt": c.ThumbCount}},
+					bson.M{"thumb_count": nil})
+			}
+			query["$or"] = or
+		}
+	default:
+		sortFields = []string{"-_id"}
+		if pageUp {
+			sortFields = []string{"_id"}
+			query["_id"] = bson.M{"$gt": bson.ObjectIdHex(cursor)}
+		} else if bson.IsObjectIdHex(cursor) {
+			query["_id"] = bson.M{"$lt": bson.ObjectIdHex(cursor)}
+		}
+	}
+
+	if err := search(articleColl, query, nil, 0, paging.Count, sortFields, nil, &comments); err != nil {
+		return total, nil, err
+	}
+
+	paging.First = ""
+	paging.Last = ""
+	paging.Count = 0
+	if len(comments) > 0 {
+		if pageUp {
+			for i := 0; i < len(comments)/2; i++ {
+				comments[i], comments[len(comments)-i-1] = comments[len(comments)-i-1], comments[i]
+			}
+		}
+		paging.First = comments[0].Id.Hex()
+		paging.Last = comments[len(comments)-1].Id.Hex()
+		paging.Count = total
+	}
+
+	return total, comments, nil
+}
+
+// replies of the thread, oldest first.
+func (this *Article) Replies(paging *Paging) (int, []Article, error) {
+	var replies []Article
+	total := 0
+
+	query := bson.M{"root": this.Id.Hex()}
+	if n, err := count(articleColl, query); err == nil {
+		total = n
+	}
+
+	pageUp := false
+	sortFields := []string{"_id"}
+	if bson.IsObjectIdHex(paging.First) {
+		pageUp = true
+		sortFields = []string{"-_id"}
+		query["_id"] = bson.M{"$lt": bson.ObjectIdHex(paging.First)}
+	} else if bson.IsObjectIdHex(paging.Last) {
+		query["_id"] = bson.M{"$gt": bson.ObjectIdHex(paging.Last)}
+	}
+	if paging.Count <= 0 {
+		paging.Count = DefaultPageSize
+	}
+
+	if err := search(articleColl, query, nil, 0, paging.Count, sortFields, nil, &replies); err != nil {
+		return total, nil, err
+	}
+
+	paging.First = ""
+	paging.Last = ""
+	paging.Count = 0
+	if len(replies) > 0 {
+		if pageUp {
+			for i := 0; i < len(replies)/2; i++ {
+				replies[i], replies[len(replies)-i-1] = replies[len(replies)-i-1], replies[i]
+			}
+		}
+		paging.First = replies[0].Id.Hex()
+		paging.Last = replies[len(replies)-1].Id.Hex()
+		paging.Count = total
+	}
+
+	return total, replies, nil
+}
+
+// delete the comment by the author of the comment or the article.
+// A thread with replies is kept as a placeholder.
+func (this *Article) DeleteComment(userid string) error {
+	if find, err := this.findOne(bson.M{"_id": this.Id}); !find {
+		if err == nil {
+			err = errors.NewError(errors.NotExistsError)
+		}
+		return err
+	}
+	if len(this.Parent) == 0 || !bson.IsObjectIdHex(this.Parent) {
+		return errors.NewError(errors.InvalidMsgError)
+	}
+
+	if this.Author != userid {
+		parent := &Article{}
+		if find, err := parent.FindById(this.Parent); !find || parent.Author != userid {
+			if err == nil {
+				err = errors.NewError(errors.AccessError)
+			}
+			return err
+		}
+	}
+
+	if this.ReplyCount > 0 {
+		change := bson.M{
+			"$set": bson.M{
+				"deleted":  true,
+				"contents": []Segment{},
+			},
+		}
+		if err := updateId(articleColl, this.Id, change, true); err != nil {
+			return errors.NewError(errors.DbError, err.Error())
+		}
+		changeFileRefs(imageRefs(this.Contents), nil)
+		this.Deleted = true
+		this.Contents = nil
+		return nil
+	}
+
+	f := func(c *mgo.Collection) error {
+		runner := txn.NewRunner(c)
+		ops := []txn.Op{
+			{
+				C:      articleColl,
+				Id:     this.Id,
+				Remove: true,
+			},
+			{
+				C:  articleColl,
+				Id: bson.ObjectIdHex(this.Parent),
+				Update: bson.M{
+					"$pull": bson.M{
+						"reviews": this.Id.Hex(),
+					},
+				},
+			},
+		}
+		if bson.IsObjectIdHex(this.Root) {
+			ops = append(ops, txn.Op{
+				C:  articleColl,
+				Id: bson.ObjectIdHex(this.Root),
+				Update: bson.M{
+					"$inc": bson.M{
+						"reply_count": -1,
+					},
+				},
+			})
+		}
+
+		return runner.Run(ops, bson.NewObjectId(), nil)
+	}
+	if err := withCollection("comment_tx", &mgo.Safe{}, f); err != nil {
+		log.Println(err)
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	changeFileRefs(imageRefs(this.Contents), nil)
+	return nil
+}
@@ -4,7 +4,6 @@ package models
 import (
 	"encoding/json"
 	"github.com/ginuerzh/sports/errors"
-	"github.com/nf/geocode"
 	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
 	"log"
@@ -37,6 +36,7 @@ const (
 	RelFollowing = "following"
 	RelFollower  = "follower"
 	RelBlacklist = "blacklist"
+	RelSelf      = "self" // the viewer is the owner
 )
 
 var (
@@ -46,12 +46,18 @@ var (
 	articleColl = "articles"
 	msgColl     = "messages"
 	//reviewColl   = "reviews"
-	fileColl   = "files"
-	recordColl = "records"
-	actionColl = "actions"
-	groupColl  = "groups"
-	eventColl  = "events"
-	ruleColl   = "rules"
+	fileColl      = "files"
+	recordColl    = "records"
+	actionColl    = "actions"
+	groupColl     = "groups"
+	eventColl     = "events"
+	ruleColl      = "rules"
+	revisionColl  = "revisions"
+	identityColl  = "identities"
+	challengeColl = "challenges"
+	activityColl  = "activities"
+	reportColl    = "reports"
+	migrationColl = "migrations"
 	//rateColl     = "rates"
 )
 
@@ -166,28 +172,6 @@ type Location struct {
 	Lng float64 `bson:"longitude" json:"longitude"`
 }
 
-func Addr2Loc(addr Address) Location {
-	return Location{}
-
-	if len(addr.String()) == 0 {
-		return Location{}
-	}
-	req := &geocode.Request{
-		Region:   "cn",
-		Provider: geocode.GOOGLE,
-		Address:  addr.String(),
-	}
-	resp, err := req.Lookup(nil)
-	if err != nil || resp.Status != "OK" || len(resp.Results) == 0 {
-		return Location{}
-	}
-
-	return Location{
-		Lat: resp.Results[0].Geometry.Location.Lat,
-		Lng: resp.Results[0].Geometry.Location.Lng,
-	}
-}
-
 type PagingFunc func(c *mgo.Collection, first, last string, args ...interface{}) (query bson.M, err error)
 
 func getSession() *mgo.Session {
@@ -375,6 +359,19 @@ func update(collection string, selector, change interface{}, safe bool) error {
 	return withCollection(collection, nil, update)
 }
 
+func updateAll(collection string, selector, change interface{}, safe bool) (info *mgo.ChangeInfo, err error) {
+	update := func(c *mgo.Collection) error {
+		info, err = c.UpdateAll(selector, change)
+		return err
+	}
+	if safe {
+		err = withCollection(collection, &mgo.Safe{}, update)
+	} else {
+		err = withCollection(collection, nil, update)
+	}
+	return
+}
+
 func upsert(collection string, selector, change interface{}, safe bool) (*mgo.ChangeInfo, error) {
 	var chinfo *mgo.ChangeInfo
 
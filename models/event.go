@@ -23,6 +23,15 @@ const (
 	EventComment = "comment"
 	EventTx      = "tx"
 	EventReward  = "reward"
+	EventMention = "mention"
+	EventRevoke  = "revoke"
+
+	EventChallenge     = "challenge"
+	EventActivity      = "activity"
+	EventFollowRequest = "follow_request"
+	EventFollowAccept  = "follow_accept"
+	EventReport        = "report" // the report is resolved
+	EventWarn          = "warn"   // warned by the moderator
 )
 
 func init() {
@@ -3,15 +3,39 @@ package models
 
 import (
 	"github.com/ginuerzh/sports/errors"
-	"github.com/ginuerzh/weedo"
+	"github.com/ginuerzh/sports/storage"
 	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
 func init() {
 	ensureIndex(fileColl, "fid")
 	ensureIndex(fileColl, "-uploadDate")
+	ensureIndex(fileColl, "md5")
+	ensureIndex(fileColl, "blobs")
+	ensureIndex(fileColl, "count", "release_time")
+	registerMigrationOnce("file_refs", migrateFileRefs)
+}
+
+var (
+	// the blob store of the file data
+	Storage storage.BlobStore
+	// unreferenced files are deleted after the grace period
+	FileGCGrace = 24 * time.Hour
+)
+
+type ImageVariant struct {
+	Fid         string
+	Url         string
+	Width       int
+	Height      int
+	Length      int64  `bson:"length"`
+	ContentType string `bson:"contentType"`
 }
 
 type File struct {
@@ -21,9 +45,14 @@ type File struct {
 	Length      int64  `bson:"length"`
 	Md5         string
 	Owner       string
-	Count       int
-	ContentType string    `bson:"contentType"`
-	UploadDate  time.Time `bson:"uploadDate"`
+	Count       int                     // reference count
+	ContentType string                  `bson:"contentType"`
+	UploadDate  time.Time               `bson:"uploadDate"`
+	Width       int                     `bson:",omitempty"`
+	Height      int                     `bson:",omitempty"`
+	Variants    map[string]ImageVariant `bson:",omitempty"`
+	Blobs       []string                `bson:",omitempty"` // fids of the file and the variants
+	ReleaseTime time.Time               `bson:"release_time,omitempty"`
 }
 
 func (this *File) Exists() (bool, error) {
@@ -53,11 +82,56 @@ func (this *File) FindByFid(fid string) (bool, error) {
 	return this.findOne(bson.M{"fid": fid})
 }
 
+// find the file by the fid of itself or its variants
+func (this *File) FindByBlob(fid string) (bool, error) {
+	return this.findOne(fileSelector([]string{fid}))
+}
+
+func (this *File) FindByMd5(md5 string) (bool, error) {
+	return this.findOne(bson.M{"md5": md5})
+}
+
+// the file is released at once, it will be deleted if nobody references it in the grace period.
 func (this *File) Save() error {
 	this.Id = bson.NewObjectId()
+	this.Count = 0
+	this.ReleaseTime = this.UploadDate
+	this.Blobs = []string{this.Fid}
+	for _, v := range this.Variants {
+		if !containsString(this.Blobs, v.Fid) {
+			this.Blobs = append(this.Blobs, v.Fid)
+		}
+	}
 	if err := save(fileColl, this, true); err != nil {
 		return errors.NewError(errors.DbError)
 	}
+	return addStorageUsed(this.Owner, this.Size())
+}
+
+// total bytes of the file and its variants
+func (this *File) Size() int64 {
+	size := this.Length
+	counted := map[string]bool{this.Fid: true}
+	for _, v := range this.Variants {
+		if !counted[v.Fid] {
+			size += v.Length
+			counted[v.Fid] = true
+		}
+	}
+	return size
+}
+
+// delay the deletion of the unreferenced file, it's going to be referenced again.
+func (this *File) Touch() error {
+	selector := bson.M{"_id": this.Id, "count": bson.M{"$lte": 0}}
+	change := bson.M{
+		"$set": bson.M{
+			"release_time": time.Now(),
+		},
+	}
+	if err := update(fileColl, selector, change, true); err != nil && err != mgo.ErrNotFound {
+		return errors.NewError(errors.DbError, err.Error())
+	}
 	return nil
 }
 
@@ -65,7 +139,8 @@ func (this *File) Delete() error {
 	remove := func(c *mgo.Collection) error {
 		err := c.Remove(bson.M{"fid": this.Fid})
 		if err == nil {
-			weedo.Delete(this.Fid, this.Count) //TODO: fail process
+			this.deleteBlobs()
+			addStorageUsed(this.Owner, -this.Size())
 		}
 		return err
 	}
@@ -81,3 +156,300 @@ func (this *File) Delete() error {
 func (this *File) OwnedBy(userid string) (bool, error) {
 	return this.findOne(bson.M{"fid": this.Fid, "owner": userid})
 }
+
+func (this *File) deleteBlobs() {
+	fids := append([]string{this.Fid}, this.Blobs...)
+	for _, v := range this.Variants {
+		fids = append(fids, v.Fid)
+	}
+
+	deleted := map[string]bool{}
+	for _, fid := range fids {
+		if deleted[fid] {
+			continue
+		}
+		if err := Storage.Delete(fid); err != nil && err != storage.ErrNotFound {
+			log.Println(err) //TODO: fail process
+		}
+		deleted[fid] = true
+	}
+}
+
+// fid of the file reference, a reference is either the fid or the url of the file,
+// such as "3,01637037d6", "http://host/3,01637037d6.jpg", "http://host/3/01637037d6/name.jpg",
+// "http://host/1/file/get?fileid=9a3c..." or "http://host/bucket/9a3c...".
+func fileFid(ref string) string {
+	ref = strings.TrimSpace(ref)
+	i := strings.Index(ref, "://")
+	if i < 0 {
+		return ref
+	}
+	ref = ref[i+3:]
+
+	if i := strings.Index(ref, "?"); i >= 0 {
+		if v, err := url.ParseQuery(ref[i+1:]); err == nil && len(v.Get("fileid")) > 0 {
+			return v.Get("fileid")
+		}
+		ref = ref[:i]
+	}
+	if i := strings.Index(ref, "#"); i >= 0 {
+		ref = ref[:i]
+	}
+
+	parts := strings.Split(strings.Trim(ref, "/"), "/")[1:] // without the host
+	if len(parts) == 0 {
+		return ""
+	}
+	// weed-fs url: volume/key/name
+	if len(parts) == 3 {
+		if _, err := strconv.Atoi(parts[0]); err == nil {
+			return parts[0] + "," + parts[1]
+		}
+	}
+	ref = parts[len(parts)-1]
+	if i := strings.Index(ref, "."); i >= 0 {
+		ref = ref[:i]
+	}
+	return ref
+}
+
+func fileFids(refs []string) []string {
+	var fids []string
+	for _, ref := range refs {
+		if fid := fileFid(ref); len(fid) > 0 && !containsString(fids, fid) {
+			fids = append(fids, fid)
+		}
+	}
+	return fids
+}
+
+func imageRefs(contents []Segment) []string {
+	var refs []string
+	for _, seg := range contents {
+		if strings.ToUpper(seg.ContentType) == "IMAGE" {
+			refs = append(refs, seg.ContentText)
+		}
+	}
+	return refs
+}
+
+// the images in the chat messages
+func msgImageRefs(body []MsgBody) []string {
+	var refs []string
+	for _, b := range body {
+		if strings.ToUpper(b.Type) == "IMAGE" {
+			refs = append(refs, b.Content)
+		}
+	}
+	return refs
+}
+
+func proofRefs(proofs []Proof) []string {
+	var refs []string
+	for _, proof := range proofs {
+		refs = append(refs, proof.Pics...)
+	}
+	return refs
+}
+
+func fileSelector(fids []string) bson.M {
+	return bson.M{
+		"$or": []bson.M{
+			{"fid": bson.M{"$in": fids}},
+			{"blobs": bson.M{"$in": fids}},
+		},
+	}
+}
+
+// increase the reference count of the files
+func RefFiles(refs []string) error {
+	fids := fileFids(refs)
+	if len(fids) == 0 {
+		return nil
+	}
+
+	change := bson.M{
+		"$inc":   bson.M{"count": 1},
+		"$unset": bson.M{"release_time": 1},
+	}
+	if _, err := updateAll(fileColl, fileSelector(fids), change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+// decrease the reference count of the files, the release time is recorded for the unreferenced files.
+func ReleaseFiles(refs []string) error {
+	fids := fileFids(refs)
+	if len(fids) == 0 {
+		return nil
+	}
+
+	if _, err := updateAll(fileColl, fileSelector(fids), bson.M{"$inc": bson.M{"count": -1}}, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+
+	selector := fileSelector(fids)
+	selector["count"] = bson.M{"$lte": 0}
+	change := bson.M{
+		"$set": bson.M{
+			"count":        0,
+			"release_time": time.Now(),
+		},
+	}
+	if _, err := updateAll(fileColl, selector, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+// reference the added files and release the removed files
+func changeFileRefs(old, new []string) {
+	var added, removed []string
+	for _, ref := range new {
+		if !containsString(old, ref) {
+			added = append(added, ref)
+		}
+	}
+	for _, ref := range old {
+		if !containsString(new, ref) {
+			removed = append(removed, ref)
+		}
+	}
+
+	if err := RefFiles(added); err != nil {
+		log.Println(err)
+	}
+	if err := ReleaseFiles(removed); err != nil {
+		log.Println(err)
+	}
+}
+
+// delete the files that have been unreferenced longer than the grace period
+func CollectFiles(grace time.Duration) (int, error) {
+	var files []File
+
+	query := bson.M{
+		"count":        bson.M{"$lte": 0},
+		"release_time": bson.M{"$lt": time.Now().Add(-grace)},
+	}
+	if err := search(fileColl, query, nil, 0, 0, nil, nil, &files); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i, _ := range files {
+		file := &files[i]
+		// make sure it's not referenced again
+		query["_id"] = file.Id
+		if err := remove(fileColl, query, true); err != nil {
+			if err != mgo.ErrNotFound {
+				log.Println(err)
+			}
+			continue
+		}
+		file.deleteBlobs()
+		if err := addStorageUsed(file.Owner, -file.Size()); err != nil {
+			log.Println(err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Recount the references of all the files, the files stored before were not referenced.
+// Every document referencing a file is counted once, the same as changeFileRefs.
+func migrateFileRefs() (int, error) {
+	refs := make(map[string]int)
+	count := func(urls []string) {
+		for _, fid := range fileFids(urls) {
+			refs[fid]++
+		}
+	}
+	scan := func(collection string, selector bson.M, result func() interface{}, f func(doc interface{})) error {
+		return withCollection(collection, nil, func(c *mgo.Collection) error {
+			iter := c.Find(nil).Select(selector).Iter()
+			doc := result()
+			for iter.Next(doc) {
+				f(doc)
+				doc = result()
+			}
+			return iter.Close()
+		})
+	}
+
+	if err := scan(articleColl, bson.M{"contents": 1},
+		func() interface{} { return &Article{} },
+		func(doc interface{}) { count(imageRefs(doc.(*Article).Contents)) }); err != nil {
+		return 0, err
+	}
+	if err := scan(accountColl, bson.M{"profile": 1, "photos": 1, "tasks.proofs": 1},
+		func() interface{} { return &Account{} },
+		func(doc interface{}) {
+			user := doc.(*Account)
+			count([]string{user.Profile})
+			count(user.Photos)
+			for _, proof := range user.Tasks.Proofs {
+				count(proof.Pics)
+			}
+		}); err != nil {
+		return 0, err
+	}
+	if err := scan(recordColl, bson.M{"sport.pics": 1},
+		func() interface{} { return &Record{} },
+		func(doc interface{}) {
+			if record := doc.(*Record); record.Sport != nil {
+				count(record.Sport.Pics)
+			}
+		}); err != nil {
+		return 0, err
+	}
+	if err := scan(groupColl, bson.M{"profile": 1},
+		func() interface{} { return &Group{} },
+		func(doc interface{}) { count([]string{doc.(*Group).Profile}) }); err != nil {
+		return 0, err
+	}
+	if err := scan(msgColl, bson.M{"body": 1},
+		func() interface{} { return &Message{} },
+		func(doc interface{}) { count(msgImageRefs(doc.(*Message).Body)) }); err != nil {
+		return 0, err
+	}
+	if err := withCollection(reportColl, nil, func(c *mgo.Collection) error {
+		iter := c.Find(bson.M{"status": bson.M{"$in": []string{ReportPending, ReportResolving}}}).Select(bson.M{"evidence": 1, "contents": 1}).Iter()
+		report := &Report{}
+		for iter.Next(report) {
+			count(report.fileRefs())
+			report = &Report{}
+		}
+		return iter.Close()
+	}); err != nil {
+		return 0, err
+	}
+
+	// the unreferenced files are released from now on, so they are kept for the grace period
+	now := time.Now()
+	return migrateEach(fileColl, nil, bson.M{"fid": 1, "blobs": 1},
+		func() interface{} { return &File{} },
+		func(doc interface{}) (interface{}, bson.M) {
+			file := doc.(*File)
+			n := refs[file.Fid]
+			for _, fid := range file.Blobs {
+				if fid != file.Fid {
+					n += refs[fid]
+				}
+			}
+			if n > 0 {
+				return file.Id, bson.M{"$set": bson.M{"count": n}, "$unset": bson.M{"release_time": 1}}
+			}
+			return file.Id, bson.M{"$set": bson.M{"count": 0, "release_time": now}}
+		})
+}
+
+func containsString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,266 @@
+// fulltext
+package models
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"github.com/ginuerzh/sports/fulltext"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	articleIndex = fulltext.NewIndex()
+	userIndex    = fulltext.NewIndex()
+)
+
+func articleDocument(article *Article) fulltext.Document {
+	var texts []string
+	for _, seg := range article.Contents {
+		if strings.ToUpper(seg.ContentType) == "TEXT" {
+			texts = append(texts, seg.ContentText)
+		}
+	}
+	return fulltext.Document{
+		Id:     article.Id.Hex(),
+		Text:   strings.Join(texts, "\n"),
+		Author: article.Author,
+		Tags:   article.Tags,
+		Time:   article.PubTime,
+	}
+}
+
+func userDocument(user *Account) fulltext.Document {
+	return fulltext.Document{
+		Id:   user.Id,
+		Text: user.Nickname,
+		Time: user.LastLogin,
+	}
+}
+
+// only published articles are searchable
+func indexArticle(article *Article) {
+	if len(article.Parent) > 0 || article.Draft {
+		articleIndex.Remove(article.Id.Hex())
+		return
+	}
+	articleIndex.Add(articleDocument(article))
+}
+
+func reindexArticle(id bson.ObjectId) {
+	article := &Article{}
+	if find, _ := article.findOne(bson.M{"_id": id}); !find {
+		articleIndex.Remove(id.Hex())
+		return
+	}
+	indexArticle(article)
+}
+
+// guests are not searchable
+func indexUser(user *Account) {
+	if user.RegTime.Unix() <= 0 || len(user.Nickname) == 0 {
+		userIndex.Remove(user.Id)
+		return
+	}
+	userIndex.Add(userDocument(user))
+}
+
+func reindexUser(userid string) {
+	user := &Account{}
+	if find, _ := user.FindByUserid(userid); !find {
+		userIndex.Remove(userid)
+		return
+	}
+	indexUser(user)
+}
+
+// rebuild the search indexes from the database
+func RebuildSearchIndex() error {
+	start := time.Now()
+	articleIndex.BeginLoad()
+	userIndex.BeginLoad()
+	cancel := func() {
+		articleIndex.CancelLoad()
+		userIndex.CancelLoad()
+	}
+
+	var articles []fulltext.Document
+	f := func(c *mgo.Collection) error {
+		iter := c.Find(bson.M{"parent": nil, "draft": bson.M{"$ne": true}}).Iter()
+		article := Article{}
+		for iter.Next(&article) {
+			articles = append(articles, articleDocument(&article))
+			article = Article{}
+		}
+		return iter.Close()
+	}
+	if err := withCollection(articleColl, nil, f); err != nil {
+		cancel()
+		return errors.NewError(errors.DbError, err.Error())
+	}
+
+	var users []fulltext.Document
+	f = func(c *mgo.Collection) error {
+		query := bson.M{
+			"reg_time": bson.M{"$gt": time.Unix(0, 0)},
+			"nickname": bson.M{"$ne": ""},
+		}
+		iter := c.Find(query).Select(bson.M{"nickname": 1, "reg_time": 1, "lastlogin": 1}).Iter()
+		user := Account{}
+		for iter.Next(&user) {
+			users = append(users, userDocument(&user))
+			user = Account{}
+		}
+		return iter.Close()
+	}
+	if err := withCollection(accountColl, nil, f); err != nil {
+		cancel()
+		return errors.NewError(errors.DbError, err.Error())
+	}
+
+	articleIndex.Load(articles)
+	userIndex.Load(users)
+	log.Printf("search index rebuilt, %d articles, %d users, %v\n",
+		len(articles), len(users), time.Since(start))
+
+	return nil
+}
+
+// the hits on the page after paging.Last or before paging.First
+func pageHits(hits []fulltext.Hit, paging *Paging) []fulltext.Hit {
+	count := paging.Count
+	if count <= 0 {
+		count = DefaultPageSize
+	}
+
+	start, end := 0, len(hits)
+	for i, hit := range hits {
+		if len(paging.First) > 0 && hit.Id == paging.First {
+			end = i
+			break
+		}
+		if len(paging.Last) > 0 && hit.Id == paging.Last {
+			start = i + 1
+			break
+		}
+	}
+	if len(paging.First) > 0 {
+		if start = end - count; start < 0 {
+			start = 0
+		}
+	} else if end = start + count; end > len(hits) {
+		end = len(hits)
+	}
+
+	return hits[start:end]
+}
+
+// full-text search of articles, it returns the highlighted snippets of the articles.
+func SearchArticle(q fulltext.Query, paging *Paging) (int, []Article, map[string]string, error) {
+	hits := articleIndex.Search(q)
+	total := len(hits)
+	hits = pageHits(hits, paging)
+
+	articles, highlights, err := hitArticles(hits, q.Keyword)
+
+	paging.First = ""
+	paging.Last = ""
+	paging.Count = 0
+	if len(hits) > 0 {
+		paging.First = hits[0].Id
+		paging.Last = hits[len(hits)-1].Id
+		paging.Count = total
+	}
+	return total, articles, highlights, err
+}
+
+func AdminSearchArticle(q fulltext.Query,
+	pageIndex, pageCount int) (int, []Article, map[string]string, error) {
+
+	hits := articleIndex.Search(q)
+	total := len(hits)
+
+	if pageIndex < 0 {
+		pageIndex = 0
+	}
+	start := pageIndex * pageCount
+	if start > total || start < 0 {
+		start = total
+	}
+	end := start + pageCount
+	if end > total || pageCount <= 0 {
+		end = total
+	}
+
+	articles, highlights, err := hitArticles(hits[start:end], q.Keyword)
+	return total, articles, highlights, err
+}
+
+func hitArticles(hits []fulltext.Hit, keyword string) ([]Article, map[string]string, error) {
+	if len(hits) == 0 {
+		return nil, nil, nil
+	}
+
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.Id
+	}
+	found, err := FindArticles(ids...)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := make(map[string]*Article, len(found))
+	for i, _ := range found {
+		m[found[i].Id.Hex()] = &found[i]
+	}
+
+	var articles []Article
+	highlights := make(map[string]string)
+	for _, id := range ids {
+		if article, ok := m[id]; ok {
+			articles = append(articles, *article)
+			if len(keyword) > 0 {
+				highlights[id] = articleIndex.Snippet(id, keyword)
+			}
+		}
+	}
+	return articles, highlights, nil
+}
+
+// full-text search of users by nickname
+func searchUsers(nickname string, paging *Paging) ([]Account, error) {
+	hits := pageHits(userIndex.Search(fulltext.Query{Keyword: nickname}), paging)
+
+	paging.First = ""
+	paging.Last = ""
+	paging.Count = 0
+	if len(hits) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.Id
+	}
+	found, err := FindUsers(ids)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]*Account, len(found))
+	for i, _ := range found {
+		m[found[i].Id] = &found[i]
+	}
+
+	var users []Account
+	for _, id := range ids {
+		if user, ok := m[id]; ok {
+			users = append(users, *user)
+		}
+	}
+
+	paging.First = hits[0].Id
+	paging.Last = hits[len(hits)-1].Id
+	return users, nil
+}
@@ -0,0 +1,193 @@
+// gazetteer
+package models
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	gazetteer []place
+
+	// the longest suffixes first
+	placeSuffixes = []string{"特别行政区", "维吾尔自治区", "壮族自治区", "回族自治区",
+		"自治区", "自治州", "地区", "新区", "省", "市", "区", "县", "州"}
+)
+
+type place struct {
+	Province string
+	City     string
+	Area     string
+	Loc      Location
+}
+
+func init() {
+	gazetteer = parseGazetteer(gazetteerData)
+}
+
+// one place a line: province city district latitude longitude, "-" is empty.
+func parseGazetteer(data string) []place {
+	var places []place
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 5 {
+			continue
+		}
+		for i := 0; i < 3; i++ {
+			if fields[i] == "-" {
+				fields[i] = ""
+			}
+		}
+		lat, err1 := strconv.ParseFloat(fields[3], 64)
+		lng, err2 := strconv.ParseFloat(fields[4], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		places = append(places, place{
+			Province: fields[0],
+			City:     fields[1],
+			Area:     fields[2],
+			Loc:      Location{Lat: lat, Lng: lng},
+		})
+	}
+	return places
+}
+
+// Load the gazetteer from the file in the format of gazetteerData, such as the full GB/T 2260 table
+// with all the counties, it replaces the built-in one.
+func LoadGazetteer(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	places := parseGazetteer(string(data))
+	if len(places) == 0 {
+		return fmt.Errorf("gazetteer: no places in %s", file)
+	}
+	gazetteer = places
+	return nil
+}
+
+func (p *place) names() []string {
+	switch {
+	case p.Area != "":
+		return []string{p.Province, p.City, p.Area}
+	case p.City != "":
+		return []string{p.Province, p.City}
+	}
+	return []string{p.Province}
+}
+
+// the place name without the suffix, such as 北京 for 北京市
+func shortPlaceName(name string) string {
+	name = strings.TrimSpace(name)
+	for _, suffix := range placeSuffixes {
+		if short := strings.TrimSuffix(name, suffix); short != name && utf8.RuneCountInString(short) >= 2 {
+			return short
+		}
+	}
+	return name
+}
+
+// 大理 is the same as 大理白族自治州
+func samePlace(a, b string) bool {
+	a, b = shortPlaceName(a), shortPlaceName(b)
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return utf8.RuneCountInString(a) >= 2 && strings.HasPrefix(b, a)
+}
+
+// Find the location of the address in the gazetteer. The province, the city and the area are matched first,
+// the most specific place wins. If none of them is given, the places are searched in the description.
+func Addr2Loc(addr Address) Location {
+	if addr.Country != "" && !samePlace(addr.Country, "中国") {
+		return Location{}
+	}
+
+	given := []string{addr.Province, addr.City, addr.Area}
+	best, depth := -1, 0
+	if addr.Province != "" || addr.City != "" || addr.Area != "" {
+		for i, _ := range gazetteer {
+			names := gazetteer[i].names()
+			if given[len(names)-1] == "" || len(names) <= depth {
+				continue
+			}
+			match := true
+			for j, name := range names {
+				if given[j] != "" && !samePlace(given[j], name) {
+					match = false
+					break
+				}
+			}
+			if match {
+				best, depth = i, len(names)
+			}
+		}
+	} else if addr.Desc != "" {
+		score := 0
+		for i, _ := range gazetteer {
+			names := gazetteer[i].names()
+			short := shortPlaceName(names[len(names)-1])
+			if utf8.RuneCountInString(short) < 2 || !strings.Contains(addr.Desc, short) {
+				continue
+			}
+			n := 0
+			for _, name := range names {
+				if strings.Contains(addr.Desc, shortPlaceName(name)) {
+					n++
+				}
+			}
+			// the places with more names in the description, then the more specific ones
+			if s := n*4 + len(names); s > score {
+				best, score = i, s
+			}
+		}
+	}
+
+	if best < 0 {
+		return Location{}
+	}
+	return gazetteer[best].Loc
+}
+
+// the nearest place with the depth, the province is 1, the city is 2 and the area is 3.
+func nearestPlace(loc Location, depth int) (best int, min float64) {
+	best = -1
+	for i, _ := range gazetteer {
+		if len(gazetteer[i].names()) != depth {
+			continue
+		}
+		if d := Distance(loc, gazetteer[i].Loc); best < 0 || d < min {
+			best, min = i, d
+		}
+	}
+	return
+}
+
+// Find the address of the location, the nearest area within 10km, or the nearest city within 100km.
+// All the prefecture-level cities are listed, but the built-in gazetteer has the districts of
+// the largest cities only, so the area is empty elsewhere unless the full table is loaded.
+func Loc2Addr(loc Location) Address {
+	if loc.Lat == 0 && loc.Lng == 0 {
+		return Address{}
+	}
+
+	for _, r := range []struct {
+		depth  int
+		radius float64
+	}{{3, 10000}, {2, 100000}} {
+		if i, d := nearestPlace(loc, r.depth); i >= 0 && d <= r.radius {
+			p := gazetteer[i]
+			addr := Address{Province: p.Province, Area: p.Area}
+			if p.City != p.Province {
+				addr.City = p.City
+			}
+			return addr
+		}
+	}
+	return Address{}
+}
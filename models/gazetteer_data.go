@@ -0,0 +1,494 @@
+// gazetteer data
+package models
+
+// The places of China with their locations: all the provinces, all the prefecture-level cities
+// and the county-level cities administered by the provinces directly, and the districts of
+// the largest cities only. The full table with all the counties can be loaded by LoadGazetteer.
+// One place a line: province city district latitude longitude, "-" is empty.
+const gazetteerData = `
+北京市 - - 39.9042 116.4074
+北京市 北京市 - 39.9042 116.4074
+北京市 北京市 东城区 39.9288 116.4160
+北京市 北京市 西城区 39.9123 116.3660
+北京市 北京市 朝阳区 39.9219 116.4436
+北京市 北京市 海淀区 39.9599 116.2982
+北京市 北京市 丰台区 39.8585 116.2871
+北京市 北京市 石景山区 39.9056 116.2229
+北京市 北京市 门头沟区 39.9405 116.1020
+北京市 北京市 房山区 39.7355 116.1393
+北京市 北京市 通州区 39.9025 116.6586
+北京市 北京市 顺义区 40.1302 116.6546
+北京市 北京市 昌平区 40.2207 116.2312
+北京市 北京市 大兴区 39.7269 116.3415
+北京市 北京市 怀柔区 40.3160 116.6319
+北京市 北京市 平谷区 40.1406 117.1214
+北京市 北京市 密云区 40.3769 116.8431
+北京市 北京市 延庆区 40.4568 115.9749
+天津市 - - 39.3434 117.3616
+天津市 天津市 - 39.3434 117.3616
+天津市 天津市 和平区 39.1172 117.2147
+天津市 天津市 河西区 39.1097 117.2232
+天津市 天津市 南开区 39.1380 117.1503
+天津市 天津市 河东区 39.1284 117.2519
+天津市 天津市 河北区 39.1475 117.1969
+天津市 天津市 滨海新区 39.0032 117.7105
+上海市 - - 31.2304 121.4737
+上海市 上海市 - 31.2304 121.4737
+上海市 上海市 黄浦区 31.2317 121.4846
+上海市 上海市 徐汇区 31.1884 121.4365
+上海市 上海市 长宁区 31.2204 121.4244
+上海市 上海市 静安区 31.2290 121.4481
+上海市 上海市 普陀区 31.2495 121.3977
+上海市 上海市 虹口区 31.2646 121.5050
+上海市 上海市 杨浦区 31.2595 121.5260
+上海市 上海市 闵行区 31.1127 121.3816
+上海市 上海市 宝山区 31.4045 121.4891
+上海市 上海市 嘉定区 31.3747 121.2655
+上海市 上海市 浦东新区 31.2212 121.5447
+上海市 上海市 金山区 30.7416 121.3420
+上海市 上海市 松江区 31.0322 121.2277
+上海市 上海市 青浦区 31.1499 121.1241
+上海市 上海市 奉贤区 30.9180 121.4740
+上海市 上海市 崇明区 31.6234 121.3975
+重庆市 - - 29.5630 106.5516
+重庆市 重庆市 - 29.5630 106.5516
+重庆市 重庆市 渝中区 29.5528 106.5688
+重庆市 重庆市 江北区 29.6066 106.5741
+重庆市 重庆市 渝北区 29.7180 106.6313
+重庆市 重庆市 沙坪坝区 29.5411 106.4578
+重庆市 重庆市 九龙坡区 29.5020 106.5109
+重庆市 重庆市 南岸区 29.5231 106.5607
+河北省 - - 38.0428 114.5149
+河北省 石家庄市 - 38.0428 114.5149
+河北省 唐山市 - 39.6305 118.1802
+河北省 秦皇岛市 - 39.9354 119.6005
+河北省 邯郸市 - 36.6256 114.5391
+河北省 邢台市 - 37.0706 114.5044
+河北省 保定市 - 38.8739 115.4646
+河北省 张家口市 - 40.7689 114.8863
+河北省 承德市 - 40.9515 117.9634
+河北省 沧州市 - 38.3037 116.8388
+河北省 廊坊市 - 39.5380 116.6838
+河北省 衡水市 - 37.7390 115.6709
+山西省 - - 37.8706 112.5489
+山西省 太原市 - 37.8706 112.5489
+山西省 大同市 - 40.0768 113.3001
+山西省 长治市 - 36.1954 113.1163
+山西省 运城市 - 35.0264 111.0070
+山西省 阳泉市 - 37.8570 113.5805
+山西省 晋城市 - 35.4907 112.8513
+山西省 朔州市 - 39.3316 112.4329
+山西省 晋中市 - 37.6870 112.7527
+山西省 忻州市 - 38.4167 112.7341
+山西省 临汾市 - 36.0881 111.5190
+山西省 吕梁市 - 37.5193 111.1443
+内蒙古自治区 - - 40.8424 111.7490
+内蒙古自治区 呼和浩特市 - 40.8424 111.7490
+内蒙古自治区 包头市 - 40.6574 109.8403
+内蒙古自治区 鄂尔多斯市 - 39.6086 109.7810
+内蒙古自治区 赤峰市 - 42.2578 118.8869
+内蒙古自治区 乌海市 - 39.6554 106.7942
+内蒙古自治区 通辽市 - 43.6174 122.2632
+内蒙古自治区 呼伦贝尔市 - 49.2116 119.7656
+内蒙古自治区 巴彦淖尔市 - 40.7574 107.3878
+内蒙古自治区 乌兰察布市 - 40.9939 113.1326
+内蒙古自治区 兴安盟 - 46.0763 122.0700
+内蒙古自治区 锡林郭勒盟 - 43.9332 116.0479
+内蒙古自治区 阿拉善盟 - 38.8431 105.7286
+辽宁省 - - 41.8057 123.4315
+辽宁省 沈阳市 - 41.8057 123.4315
+辽宁省 大连市 - 38.9140 121.6147
+辽宁省 鞍山市 - 41.1087 122.9946
+辽宁省 抚顺市 - 41.8807 123.9573
+辽宁省 丹东市 - 40.0005 124.3540
+辽宁省 锦州市 - 41.0951 121.1270
+辽宁省 本溪市 - 41.2979 123.7665
+辽宁省 营口市 - 40.6670 122.2352
+辽宁省 阜新市 - 42.0219 121.6700
+辽宁省 辽阳市 - 41.2694 123.2365
+辽宁省 盘锦市 - 41.1245 122.0707
+辽宁省 铁岭市 - 42.2862 123.8443
+辽宁省 朝阳市 - 41.5734 120.4508
+辽宁省 葫芦岛市 - 40.7110 120.8369
+吉林省 - - 43.8171 125.3235
+吉林省 长春市 - 43.8171 125.3235
+吉林省 吉林市 - 43.8378 126.5494
+吉林省 延边朝鲜族自治州 - 42.8913 129.5083
+吉林省 四平市 - 43.1664 124.3505
+吉林省 辽源市 - 42.8880 125.1437
+吉林省 通化市 - 41.7285 125.9399
+吉林省 白山市 - 41.9399 126.4236
+吉林省 松原市 - 45.1411 124.8253
+吉林省 白城市 - 45.6196 122.8388
+黑龙江省 - - 45.8038 126.5349
+黑龙江省 哈尔滨市 - 45.8038 126.5349
+黑龙江省 齐齐哈尔市 - 47.3543 123.9180
+黑龙江省 大庆市 - 46.5893 125.1035
+黑龙江省 牡丹江市 - 44.5522 129.6332
+黑龙江省 鸡西市 - 45.2953 130.9694
+黑龙江省 鹤岗市 - 47.3499 130.2978
+黑龙江省 双鸭山市 - 46.6466 131.1591
+黑龙江省 伊春市 - 47.7276 128.8994
+黑龙江省 佳木斯市 - 46.7998 130.3188
+黑龙江省 七台河市 - 45.7713 131.0031
+黑龙江省 黑河市 - 50.2455 127.5284
+黑龙江省 绥化市 - 46.6374 126.9688
+黑龙江省 大兴安岭地区 - 50.4243 124.1174
+江苏省 - - 32.0603 118.7969
+江苏省 南京市 - 32.0603 118.7969
+江苏省 南京市 玄武区 32.0486 118.7977
+江苏省 南京市 秦淮区 32.0339 118.7945
+江苏省 南京市 鼓楼区 32.0661 118.7698
+江苏省 南京市 建邺区 32.0033 118.7314
+江苏省 无锡市 - 31.4912 120.3119
+江苏省 徐州市 - 34.2044 117.2859
+江苏省 常州市 - 31.8107 119.9741
+江苏省 苏州市 - 31.2990 120.5853
+江苏省 南通市 - 31.9802 120.8943
+江苏省 连云港市 - 34.5967 119.2216
+江苏省 淮安市 - 33.6104 119.0153
+江苏省 盐城市 - 33.3496 120.1633
+江苏省 扬州市 - 32.3936 119.4129
+江苏省 镇江市 - 32.1878 119.4250
+江苏省 泰州市 - 32.4555 119.9229
+江苏省 宿迁市 - 33.9630 118.2752
+浙江省 - - 30.2741 120.1551
+浙江省 杭州市 - 30.2741 120.1551
+浙江省 杭州市 上城区 30.2425 120.1693
+浙江省 杭州市 拱墅区 30.3197 120.1419
+浙江省 杭州市 西湖区 30.2595 120.1302
+浙江省 杭州市 滨江区 30.2084 120.2119
+浙江省 杭州市 萧山区 30.1853 120.2645
+浙江省 杭州市 余杭区 30.4193 120.2999
+浙江省 宁波市 - 29.8683 121.5440
+浙江省 温州市 - 27.9938 120.6994
+浙江省 嘉兴市 - 30.7461 120.7555
+浙江省 湖州市 - 30.8943 120.0868
+浙江省 绍兴市 - 30.0303 120.5802
+浙江省 金华市 - 29.0790 119.6474
+浙江省 衢州市 - 28.9700 118.8594
+浙江省 舟山市 - 29.9853 122.2072
+浙江省 台州市 - 28.6564 121.4208
+浙江省 丽水市 - 28.4676 119.9229
+安徽省 - - 31.8206 117.2272
+安徽省 合肥市 - 31.8206 117.2272
+安徽省 芜湖市 - 31.3529 118.4331
+安徽省 蚌埠市 - 32.9163 117.3889
+安徽省 安庆市 - 30.5430 117.0635
+安徽省 黄山市 - 29.7147 118.3375
+安徽省 淮南市 - 32.6255 116.9998
+安徽省 马鞍山市 - 31.6705 118.5068
+安徽省 淮北市 - 33.9550 116.7983
+安徽省 铜陵市 - 30.9454 117.8121
+安徽省 滁州市 - 32.3016 118.3171
+安徽省 阜阳市 - 32.8900 115.8142
+安徽省 宿州市 - 33.6464 116.9641
+安徽省 六安市 - 31.7348 116.5222
+安徽省 亳州市 - 33.8446 115.7786
+安徽省 池州市 - 30.6648 117.4914
+安徽省 宣城市 - 30.9406 118.7587
+福建省 - - 26.0745 119.2965
+福建省 福州市 - 26.0745 119.2965
+福建省 厦门市 - 24.4798 118.0894
+福建省 莆田市 - 25.4540 119.0077
+福建省 泉州市 - 24.8741 118.6757
+福建省 漳州市 - 24.5130 117.6472
+福建省 三明市 - 26.2634 117.6389
+福建省 南平市 - 26.6417 118.1777
+福建省 龙岩市 - 25.0751 117.0174
+福建省 宁德市 - 26.6657 119.5479
+江西省 - - 28.6820 115.8579
+江西省 南昌市 - 28.6820 115.8579
+江西省 景德镇市 - 29.2688 117.1784
+江西省 九江市 - 29.7050 116.0019
+江西省 赣州市 - 25.8310 114.9330
+江西省 萍乡市 - 27.6229 113.8543
+江西省 新余市 - 27.8174 114.9172
+江西省 鹰潭市 - 28.2602 117.0692
+江西省 吉安市 - 27.1138 114.9927
+江西省 宜春市 - 27.8136 114.4163
+江西省 抚州市 - 27.9492 116.3581
+江西省 上饶市 - 28.4546 117.9434
+山东省 - - 36.6512 117.1201
+山东省 济南市 - 36.6512 117.1201
+山东省 青岛市 - 36.0671 120.3826
+山东省 淄博市 - 36.8131 118.0548
+山东省 烟台市 - 37.4638 121.4479
+山东省 潍坊市 - 36.7069 119.1619
+山东省 济宁市 - 35.4149 116.5871
+山东省 泰安市 - 36.2000 117.0874
+山东省 威海市 - 37.5128 122.1201
+山东省 日照市 - 35.4164 119.5269
+山东省 临沂市 - 35.1041 118.3564
+山东省 枣庄市 - 34.8107 117.3237
+山东省 东营市 - 37.4346 118.6747
+山东省 德州市 - 37.4355 116.3575
+山东省 聊城市 - 36.4570 115.9854
+山东省 滨州市 - 37.3821 117.9707
+山东省 菏泽市 - 35.2334 115.4807
+河南省 - - 34.7466 113.6254
+河南省 郑州市 - 34.7466 113.6254
+河南省 开封市 - 34.7973 114.3076
+河南省 洛阳市 - 34.6197 112.4540
+河南省 安阳市 - 36.0976 114.3927
+河南省 新乡市 - 35.3030 113.9268
+河南省 南阳市 - 32.9907 112.5283
+河南省 平顶山市 - 33.7662 113.1927
+河南省 鹤壁市 - 35.7476 114.2974
+河南省 焦作市 - 35.2158 113.2418
+河南省 濮阳市 - 35.7618 115.0292
+河南省 许昌市 - 34.0357 113.8523
+河南省 漯河市 - 33.5815 114.0169
+河南省 三门峡市 - 34.7726 111.2003
+河南省 商丘市 - 34.4143 115.6564
+河南省 信阳市 - 32.1470 114.0913
+河南省 周口市 - 33.6260 114.6969
+河南省 驻马店市 - 33.0114 114.0225
+河南省 济源市 - 35.0672 112.6022
+湖北省 - - 30.5928 114.3055
+湖北省 武汉市 - 30.5928 114.3055
+湖北省 武汉市 江岸区 30.6000 114.3097
+湖北省 武汉市 江汉区 30.6015 114.2709
+湖北省 武汉市 武昌区 30.5536 114.3160
+湖北省 武汉市 洪山区 30.5000 114.3436
+湖北省 十堰市 - 32.6292 110.7980
+湖北省 宜昌市 - 30.6919 111.2865
+湖北省 襄阳市 - 32.0090 112.1226
+湖北省 荆州市 - 30.3352 112.2397
+湖北省 黄石市 - 30.1999 115.0389
+湖北省 鄂州市 - 30.3910 114.8949
+湖北省 荆门市 - 31.0354 112.1994
+湖北省 孝感市 - 30.9245 113.9169
+湖北省 黄冈市 - 30.4537 114.8724
+湖北省 咸宁市 - 29.8413 114.3225
+湖北省 随州市 - 31.6900 113.3826
+湖北省 恩施土家族苗族自治州 - 30.2720 109.4882
+湖北省 仙桃市 - 30.3628 113.4549
+湖北省 潜江市 - 30.4019 112.8996
+湖北省 天门市 - 30.6631 113.1660
+湖北省 神农架林区 - 31.7444 110.6759
+湖南省 - - 28.2282 112.9388
+湖南省 长沙市 - 28.2282 112.9388
+湖南省 株洲市 - 27.8274 113.1340
+湖南省 湘潭市 - 27.8297 112.9441
+湖南省 衡阳市 - 26.8934 112.5720
+湖南省 岳阳市 - 29.3572 113.1289
+湖南省 常德市 - 29.0317 111.6985
+湖南省 张家界市 - 29.1170 110.4792
+湖南省 邵阳市 - 27.2389 111.4677
+湖南省 益阳市 - 28.5539 112.3551
+湖南省 郴州市 - 25.7706 113.0148
+湖南省 永州市 - 26.4204 111.6132
+湖南省 怀化市 - 27.5501 109.9985
+湖南省 娄底市 - 27.6975 111.9941
+湖南省 湘西土家族苗族自治州 - 28.3117 109.7390
+广东省 - - 23.1291 113.2644
+广东省 广州市 - 23.1291 113.2644
+广东省 广州市 越秀区 23.1290 113.2668
+广东省 广州市 天河区 23.1246 113.3612
+广东省 广州市 海珠区 23.0838 113.3173
+广东省 广州市 荔湾区 23.1259 113.2443
+广东省 广州市 白云区 23.1573 113.2731
+广东省 广州市 番禺区 22.9377 113.3841
+广东省 广州市 黄埔区 23.1063 113.4599
+广东省 深圳市 - 22.5431 114.0579
+广东省 深圳市 福田区 22.5410 114.0550
+广东省 深圳市 罗湖区 22.5484 114.1315
+广东省 深圳市 南山区 22.5333 113.9304
+广东省 深圳市 宝安区 22.5550 113.8838
+广东省 深圳市 龙岗区 22.7200 114.2468
+广东省 深圳市 盐田区 22.5574 114.2360
+广东省 深圳市 龙华区 22.6967 114.0448
+广东省 珠海市 - 22.2710 113.5767
+广东省 汕头市 - 23.3540 116.6820
+广东省 佛山市 - 23.0215 113.1214
+广东省 韶关市 - 24.8104 113.5972
+广东省 湛江市 - 21.2707 110.3594
+广东省 江门市 - 22.5789 113.0815
+广东省 茂名市 - 21.6630 110.9255
+广东省 肇庆市 - 23.0469 112.4651
+广东省 惠州市 - 23.1115 114.4152
+广东省 梅州市 - 24.2886 116.1225
+广东省 汕尾市 - 22.7862 115.3751
+广东省 河源市 - 23.7435 114.7002
+广东省 阳江市 - 21.8579 111.9822
+广东省 清远市 - 23.6818 113.0560
+广东省 东莞市 - 23.0207 113.7518
+广东省 中山市 - 22.5176 113.3926
+广东省 潮州市 - 23.6567 116.6226
+广东省 揭阳市 - 23.5497 116.3728
+广东省 云浮市 - 22.9151 112.0444
+广西壮族自治区 - - 22.8170 108.3665
+广西壮族自治区 南宁市 - 22.8170 108.3665
+广西壮族自治区 柳州市 - 24.3264 109.4281
+广西壮族自治区 桂林市 - 25.2736 110.2900
+广西壮族自治区 北海市 - 21.4811 109.1193
+广西壮族自治区 梧州市 - 23.4770 111.2791
+广西壮族自治区 防城港市 - 21.6867 108.3547
+广西壮族自治区 钦州市 - 21.9817 108.6541
+广西壮族自治区 贵港市 - 23.1115 109.5986
+广西壮族自治区 玉林市 - 22.6540 110.1810
+广西壮族自治区 百色市 - 23.9025 106.6183
+广西壮族自治区 贺州市 - 24.4038 111.5665
+广西壮族自治区 河池市 - 24.6929 108.0854
+广西壮族自治区 来宾市 - 23.7521 109.2212
+广西壮族自治区 崇左市 - 22.3769 107.3649
+海南省 - - 20.0440 110.1999
+海南省 海口市 - 20.0440 110.1999
+海南省 三亚市 - 18.2528 109.5119
+海南省 三沙市 - 16.8310 112.3386
+海南省 儋州市 - 19.5210 109.5808
+海南省 五指山市 - 18.7751 109.5169
+海南省 琼海市 - 19.2584 110.4746
+海南省 文昌市 - 19.5430 110.7977
+海南省 万宁市 - 18.7953 110.3893
+海南省 东方市 - 19.0951 108.6518
+海南省 定安县 - 19.6812 110.3593
+海南省 屯昌县 - 19.3517 110.1035
+海南省 澄迈县 - 19.7381 110.0072
+海南省 临高县 - 19.9121 109.6903
+海南省 白沙黎族自治县 - 19.2246 109.4519
+海南省 昌江黎族自治县 - 19.2983 109.0556
+海南省 乐东黎族自治县 - 18.7499 109.1733
+海南省 陵水黎族自治县 - 18.5060 110.0372
+海南省 保亭黎族苗族自治县 - 18.6395 109.7026
+海南省 琼中黎族苗族自治县 - 19.0334 109.8384
+四川省 - - 30.5728 104.0668
+四川省 成都市 - 30.5728 104.0668
+四川省 成都市 锦江区 30.6569 104.0834
+四川省 成都市 青羊区 30.6742 104.0625
+四川省 成都市 金牛区 30.6913 104.0523
+四川省 成都市 武侯区 30.6423 104.0432
+四川省 成都市 成华区 30.6599 104.1019
+四川省 自贡市 - 29.3392 104.7784
+四川省 攀枝花市 - 26.5823 101.7185
+四川省 泸州市 - 28.8718 105.4423
+四川省 德阳市 - 31.1270 104.3979
+四川省 绵阳市 - 31.4675 104.6796
+四川省 乐山市 - 29.5521 103.7656
+四川省 南充市 - 30.8373 106.1107
+四川省 宜宾市 - 28.7513 104.6417
+四川省 广元市 - 32.4355 105.8436
+四川省 遂宁市 - 30.5327 105.5929
+四川省 内江市 - 29.5802 105.0584
+四川省 眉山市 - 30.0754 103.8485
+四川省 广安市 - 30.4564 106.6333
+四川省 达州市 - 31.2096 107.4680
+四川省 雅安市 - 29.9805 103.0133
+四川省 巴中市 - 31.8672 106.7475
+四川省 资阳市 - 30.1289 104.6276
+四川省 阿坝藏族羌族自治州 - 31.8994 102.2246
+四川省 甘孜藏族自治州 - 30.0498 101.9625
+四川省 凉山彝族自治州 - 27.8816 102.2674
+贵州省 - - 26.6470 106.6302
+贵州省 贵阳市 - 26.6470 106.6302
+贵州省 遵义市 - 27.7257 106.9272
+贵州省 六盘水市 - 26.5934 104.8305
+贵州省 安顺市 - 26.2456 105.9476
+贵州省 毕节市 - 27.2986 105.2850
+贵州省 铜仁市 - 27.7183 109.1896
+贵州省 黔西南布依族苗族自治州 - 25.0881 104.9064
+贵州省 黔东南苗族侗族自治州 - 26.5834 107.9774
+贵州省 黔南布依族苗族自治州 - 26.2582 107.5173
+云南省 - - 24.8801 102.8329
+云南省 昆明市 - 24.8801 102.8329
+云南省 丽江市 - 26.8550 100.2271
+云南省 大理白族自治州 - 25.6065 100.2676
+云南省 西双版纳傣族自治州 - 22.0075 100.7975
+云南省 曲靖市 - 25.4900 103.7962
+云南省 玉溪市 - 24.3520 102.5429
+云南省 保山市 - 25.1120 99.1618
+云南省 昭通市 - 27.3380 103.7172
+云南省 普洱市 - 22.8252 100.9660
+云南省 临沧市 - 23.8772 100.0869
+云南省 楚雄彝族自治州 - 25.0419 101.5461
+云南省 红河哈尼族彝族自治州 - 23.3639 103.3756
+云南省 文山壮族苗族自治州 - 23.3695 104.2440
+云南省 德宏傣族景颇族自治州 - 24.4333 98.5784
+云南省 怒江傈僳族自治州 - 25.8509 98.8567
+云南省 迪庆藏族自治州 - 27.8269 99.7065
+西藏自治区 - - 29.6520 91.1721
+西藏自治区 拉萨市 - 29.6520 91.1721
+西藏自治区 日喀则市 - 29.2670 88.8806
+西藏自治区 昌都市 - 31.1369 97.1785
+西藏自治区 林芝市 - 29.6490 94.3624
+西藏自治区 山南市 - 29.2370 91.7731
+西藏自治区 那曲市 - 31.4762 92.0514
+西藏自治区 阿里地区 - 32.5013 80.1055
+陕西省 - - 34.3416 108.9398
+陕西省 西安市 - 34.3416 108.9398
+陕西省 西安市 新城区 34.2670 108.9607
+陕西省 西安市 碑林区 34.2566 108.9347
+陕西省 西安市 莲湖区 34.2650 108.9435
+陕西省 西安市 雁塔区 34.2133 108.9488
+陕西省 宝鸡市 - 34.3619 107.2373
+陕西省 咸阳市 - 34.3296 108.7093
+陕西省 延安市 - 36.5853 109.4897
+陕西省 汉中市 - 33.0676 107.0238
+陕西省 铜川市 - 34.8967 108.9451
+陕西省 渭南市 - 34.4994 109.5102
+陕西省 榆林市 - 38.2852 109.7347
+陕西省 安康市 - 32.6849 109.0293
+陕西省 商洛市 - 33.8704 109.9404
+甘肃省 - - 36.0611 103.8343
+甘肃省 兰州市 - 36.0611 103.8343
+甘肃省 嘉峪关市 - 39.7726 98.2891
+甘肃省 天水市 - 34.5809 105.7249
+甘肃省 酒泉市 - 39.7325 98.4944
+甘肃省 金昌市 - 38.5200 102.1880
+甘肃省 白银市 - 36.5447 104.1389
+甘肃省 武威市 - 37.9283 102.6380
+甘肃省 张掖市 - 38.9259 100.4498
+甘肃省 平凉市 - 35.5428 106.6651
+甘肃省 庆阳市 - 35.7342 107.6434
+甘肃省 定西市 - 35.5806 104.6263
+甘肃省 陇南市 - 33.4009 104.9219
+甘肃省 临夏回族自治州 - 35.6012 103.2104
+甘肃省 甘南藏族自治州 - 34.9864 102.9110
+青海省 - - 36.6171 101.7782
+青海省 西宁市 - 36.6171 101.7782
+青海省 海东市 - 36.4821 102.4017
+青海省 海北藏族自治州 - 36.9595 100.9010
+青海省 黄南藏族自治州 - 35.5177 102.0152
+青海省 海南藏族自治州 - 36.2804 100.6196
+青海省 果洛藏族自治州 - 34.4736 100.2422
+青海省 玉树藏族自治州 - 33.0040 97.0085
+青海省 海西蒙古族藏族自治州 - 37.3747 97.3708
+宁夏回族自治区 - - 38.4872 106.2309
+宁夏回族自治区 银川市 - 38.4872 106.2309
+宁夏回族自治区 石嘴山市 - 38.9841 106.3835
+宁夏回族自治区 吴忠市 - 37.9862 106.1990
+宁夏回族自治区 固原市 - 36.0160 106.2425
+宁夏回族自治区 中卫市 - 37.5149 105.1896
+新疆维吾尔自治区 - - 43.8256 87.6168
+新疆维吾尔自治区 乌鲁木齐市 - 43.8256 87.6168
+新疆维吾尔自治区 克拉玛依市 - 45.5798 84.8892
+新疆维吾尔自治区 喀什地区 - 39.4677 75.9898
+新疆维吾尔自治区 吐鲁番市 - 42.9513 89.1895
+新疆维吾尔自治区 哈密市 - 42.8185 93.5150
+新疆维吾尔自治区 昌吉回族自治州 - 44.0143 87.3082
+新疆维吾尔自治区 博尔塔拉蒙古自治州 - 44.9059 82.0664
+新疆维吾尔自治区 巴音郭楞蒙古自治州 - 41.7686 86.1451
+新疆维吾尔自治区 阿克苏地区 - 41.1707 80.2651
+新疆维吾尔自治区 克孜勒苏柯尔克孜自治州 - 39.7134 76.1728
+新疆维吾尔自治区 和田地区 - 37.1107 79.9253
+新疆维吾尔自治区 伊犁哈萨克自治州 - 43.9169 81.3241
+新疆维吾尔自治区 塔城地区 - 46.7463 82.9857
+新疆维吾尔自治区 阿勒泰地区 - 47.8449 88.1396
+新疆维吾尔自治区 石河子市 - 44.3059 86.0411
+新疆维吾尔自治区 阿拉尔市 - 40.5479 81.2808
+新疆维吾尔自治区 图木舒克市 - 39.8673 79.0774
+新疆维吾尔自治区 五家渠市 - 44.1674 87.5269
+新疆维吾尔自治区 北屯市 - 47.3533 87.8246
+新疆维吾尔自治区 铁门关市 - 41.8271 85.5013
+新疆维吾尔自治区 双河市 - 44.8406 82.3536
+新疆维吾尔自治区 可克达拉市 - 43.9476 81.0449
+新疆维吾尔自治区 昆玉市 - 37.2095 79.2913
+新疆维吾尔自治区 胡杨河市 - 44.6929 84.8275
+台湾省 - - 25.0330 121.5654
+台湾省 台北市 - 25.0330 121.5654
+台湾省 台中市 - 24.1477 120.6736
+台湾省 高雄市 - 22.6273 120.3014
+香港特别行政区 - - 22.3193 114.1694
+澳门特别行政区 - - 22.1987 113.5439
+`
@@ -0,0 +1,380 @@
+// geo
+package models
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"math"
+	"sort"
+	"time"
+)
+
+var (
+	LocationPrecision = 7              // the geohash length of the stored locations, about 150m
+	LocationFuzz      = 6              // the geohash length of the locations shown to the others, about 1km
+	LocationExpire    = 24 * time.Hour // the older locations are ignored
+)
+
+const (
+	earthRadius   = 6371000. // in meters
+	geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+	nearbyMax     = 1000 // the max nearest users loaded for one nearby search
+	nearbyScanMax = 5000 // the max candidates scanned in the cells of one precision
+)
+
+func init() {
+	registerMigration("geohash", migrateGeohash)
+}
+
+// set the geohash of the locations saved before the geohashes, the location time is
+// the last login time, when the location was reported.
+func migrateGeohash() (int, error) {
+	query := bson.M{"geohash": bson.M{"$exists": false}}
+	return migrateEach(accountColl, query, bson.M{"loc": 1, "loc_time": 1, "lastlogin": 1},
+		func() interface{} { return &Account{} },
+		func(doc interface{}) (interface{}, bson.M) {
+			user := doc.(*Account)
+			set := bson.M{"geohash": ""}
+			if user.Loc.Lat != 0 || user.Loc.Lng != 0 {
+				set["geohash"] = Geohash(user.Loc, LocationPrecision)
+				set["loc"] = RoundLocation(user.Loc, LocationPrecision)
+			}
+			if user.LocTime.IsZero() {
+				set["loc_time"] = user.LastLogin
+			}
+			return user.Id, bson.M{"$set": set}
+		})
+}
+
+// the distance in meters between the two locations
+func Distance(a, b Location) float64 {
+	rad := math.Pi / 180
+	dlat := (b.Lat - a.Lat) * rad
+	dlng := (b.Lng - a.Lng) * rad
+	h := math.Sin(dlat/2)*math.Sin(dlat/2) +
+		math.Cos(a.Lat*rad)*math.Cos(b.Lat*rad)*math.Sin(dlng/2)*math.Sin(dlng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// the distance shown to the others, such as "<1km"
+func DistanceBucket(d float64) string {
+	switch {
+	case d < 1000:
+		return "<1km"
+	case d < 3000:
+		return "1-3km"
+	case d < 5000:
+		return "3-5km"
+	case d < 10000:
+		return "5-10km"
+	case d < 20000:
+		return "10-20km"
+	case d < 50000:
+		return "20-50km"
+	}
+	return ">50km"
+}
+
+func Geohash(loc Location, precision int) string {
+	minLat, maxLat := -90., 90.
+	minLng, maxLng := -180., 180.
+
+	hash := make([]byte, 0, precision)
+	bit, ch := 0, 0
+	even := true // the even bits are the longitude
+	for len(hash) < precision {
+		if even {
+			mid := (minLng + maxLng) / 2
+			if loc.Lng >= mid {
+				ch |= 1 << uint(4-bit)
+				minLng = mid
+			} else {
+				maxLng = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if loc.Lat >= mid {
+				ch |= 1 << uint(4-bit)
+				minLat = mid
+			} else {
+				maxLat = mid
+			}
+		}
+		even = !even
+
+		if bit++; bit == 5 {
+			hash = append(hash, geohashBase32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// the bounding box of the geohash cell
+func geohashBox(hash string) (minLat, maxLat, minLng, maxLng float64) {
+	minLat, maxLat = -90., 90.
+	minLng, maxLng = -180., 180.
+
+	even := true
+	for i := 0; i < len(hash); i++ {
+		ch := 0
+		for ; ch < len(geohashBase32); ch++ {
+			if geohashBase32[ch] == hash[i] {
+				break
+			}
+		}
+		for bit := 4; bit >= 0; bit-- {
+			on := ch&(1<<uint(bit)) != 0
+			if even {
+				mid := (minLng + maxLng) / 2
+				if on {
+					minLng = mid
+				} else {
+					maxLng = mid
+				}
+			} else {
+				mid := (minLat + maxLat) / 2
+				if on {
+					minLat = mid
+				} else {
+					maxLat = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return
+}
+
+// the center of the geohash cell
+func GeohashCenter(hash string) Location {
+	minLat, maxLat, minLng, maxLng := geohashBox(hash)
+	return Location{Lat: (minLat + maxLat) / 2, Lng: (minLng + maxLng) / 2}
+}
+
+// the location rounded to the center of its geohash cell with the precision
+func RoundLocation(loc Location, precision int) Location {
+	if loc.Lat == 0 && loc.Lng == 0 {
+		return loc
+	}
+	return GeohashCenter(Geohash(loc, precision))
+}
+
+// The location shown to the others. It is rounded rather than randomly shifted,
+// so that averaging the responses does not reveal the stored location.
+func FuzzLocation(loc Location) Location {
+	return RoundLocation(loc, LocationFuzz)
+}
+
+// the size in meters of the geohash cell with the precision around the location, the shorter side
+func geohashSize(loc Location, precision int) float64 {
+	minLat, maxLat, minLng, maxLng := geohashBox(Geohash(loc, precision))
+	height := (maxLat - minLat) * 111319
+	width := (maxLng - minLng) * 111319 * math.Cos(loc.Lat*math.Pi/180)
+	return math.Min(height, width)
+}
+
+// The geohash cells with the precision around the location, the cell contains the location and its eight neighbours.
+// All the locations within the size of the cell from the location are in them.
+func geohashCells(loc Location, precision int) []string {
+	minLat, maxLat, minLng, maxLng := geohashBox(Geohash(loc, precision))
+	center := Location{Lat: (minLat + maxLat) / 2, Lng: (minLng + maxLng) / 2}
+
+	var cells []string
+	for i := -1; i <= 1; i++ {
+		lat := center.Lat + float64(i)*(maxLat-minLat)
+		if lat > 90 || lat < -90 {
+			continue
+		}
+		for j := -1; j <= 1; j++ {
+			lng := center.Lng + float64(j)*(maxLng-minLng)
+			if lng >= 180 {
+				lng -= 360
+			} else if lng < -180 {
+				lng += 360
+			}
+			cell := Geohash(Location{Lat: lat, Lng: lng}, precision)
+			if !containsString(cells, cell) {
+				cells = append(cells, cell)
+			}
+		}
+	}
+	return cells
+}
+
+type Neighbor struct {
+	Account
+	Distance     float64 // the great-circle distance in meters
+	FuzzDistance float64 // the distance to the fuzzed location, it's shown to the others and can't be trilaterated
+}
+
+type neighbors []Neighbor
+
+func (list neighbors) Len() int           { return len(list) }
+func (list neighbors) Less(i, j int) bool { return list[i].Distance < list[j].Distance }
+func (list neighbors) Swap(i, j int)      { list[i], list[j] = list[j], list[i] }
+
+// The discoverable users within the radius in meters, the nearest first.
+// The users without a fresh location or with the location not public are ignored.
+func NearbyUsers(loc Location, radius int, excludes []string, limit int) ([]Neighbor, error) {
+	if loc.Lat == 0 && loc.Lng == 0 {
+		return nil, nil
+	}
+	if limit <= 0 || limit > nearbyMax {
+		limit = nearbyMax
+	}
+
+	// Search the cells around the location from the smallest, until the nearest users are all found
+	// or the cells cover the radius. The users within the cell size are all in the cells,
+	// so the nearest are not missed, and each scan is capped in the dense areas.
+	var list []Neighbor
+	for precision := LocationPrecision; precision > 0; precision-- {
+		candidates, truncated, err := nearbyCandidates(loc, radius, excludes, geohashCells(loc, precision))
+		if err != nil {
+			return nil, err
+		}
+		if truncated {
+			// the users found in the smaller cells are complete, keep them
+			for _, n := range list {
+				if !containsNeighbor(candidates, n.Id) {
+					candidates = append(candidates, n)
+				}
+			}
+			list = candidates
+			break
+		}
+		list = candidates
+
+		size := geohashSize(loc, precision)
+		if size >= float64(radius) {
+			break
+		}
+		n := 0
+		for i, _ := range list {
+			if list[i].Distance <= size {
+				n++
+			}
+		}
+		if n >= limit {
+			break
+		}
+	}
+	sort.Sort(neighbors(list))
+	if len(list) > limit {
+		list = list[:limit]
+	}
+
+	ids := make([]string, len(list))
+	for i, _ := range list {
+		ids[i] = list[i].Id
+	}
+	users, err := FindUsers(ids)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]*Account, len(users))
+	for i, _ := range users {
+		found[users[i].Id] = &users[i]
+	}
+	nearby := list[:0]
+	for _, n := range list {
+		if u, ok := found[n.Id]; ok {
+			n.Account = *u
+			nearby = append(nearby, n)
+		}
+	}
+	return nearby, nil
+}
+
+func containsNeighbor(list []Neighbor, id string) bool {
+	for i, _ := range list {
+		if list[i].Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// the users in the cells within the radius, only the ids and the locations are loaded.
+// It's truncated if there are more than nearbyScanMax users in the cells.
+func nearbyCandidates(loc Location, radius int, excludes []string, cells []string) ([]Neighbor, bool, error) {
+	var patterns []interface{}
+	for _, cell := range cells {
+		patterns = append(patterns, bson.RegEx{Pattern: "^" + cell})
+	}
+	query := bson.M{
+		"geohash": bson.M{
+			"$in": patterns,
+		},
+		"loc_time": bson.M{
+			"$gt": time.Now().Add(-LocationExpire),
+		},
+		"hide_loc": bson.M{
+			"$ne": true,
+		},
+		"privacy.location": bson.M{
+			"$nin": HiddenVisibilities(RelNone),
+		},
+	}
+	if len(excludes) > 0 {
+		query["_id"] = bson.M{
+			"$nin": excludes,
+		}
+	}
+
+	var list []Neighbor
+	scanned := 0
+	err := withCollection(accountColl, nil, func(c *mgo.Collection) error {
+		iter := c.Find(query).Select(bson.M{"loc": 1}).Limit(nearbyScanMax + 1).Iter()
+		user := Account{}
+		for iter.Next(&user) {
+			scanned++
+			if scanned > nearbyScanMax {
+				break
+			}
+			if d := Distance(loc, user.Loc); d <= float64(radius) {
+				list = append(list, Neighbor{
+					Account:      Account{Id: user.Id},
+					Distance:     d,
+					FuzzDistance: Distance(loc, FuzzLocation(user.Loc)),
+				})
+			}
+			user = Account{}
+		}
+		return iter.Close()
+	})
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, false, errors.NewError(errors.DbError, err.Error())
+	}
+	return list, scanned > nearbyScanMax, nil
+}
+
+// The location and the address of the user shown to the viewer, rel is the relationship of the user to the viewer.
+// The others see the fuzzed location if the location privacy allows, and nothing if the location is stale.
+// The location of the undiscoverable users is private unless the privacy is set.
+func (this *Account) VisibleLoc(rel string) (Location, string) {
+	if rel == RelSelf {
+		return this.Loc, this.LocAddr
+	}
+	visibility := this.Privacy.Location
+	if len(visibility) == 0 && this.HideLoc {
+		visibility = PrivacyPrivate
+	}
+	if !Visible(visibility, rel) || time.Since(this.LocTime) > LocationExpire {
+		return Location{}, ""
+	}
+	return FuzzLocation(this.Loc), this.LocAddr
+}
+
+func (this *Account) SetDiscoverable(discoverable bool) error {
+	change := bson.M{
+		"$set": bson.M{
+			"hide_loc": !discoverable,
+		},
+	}
+	if err := updateId(accountColl, this.Id, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
@@ -3,28 +3,61 @@ package models
 
 import (
 	"github.com/ginuerzh/sports/errors"
+	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
 	"time"
 )
 
+// how the users join the group
+const (
+	GroupPublic   = "public"   // anyone can join
+	GroupApproval = "approval" // the join request must be approved by the admins
+	GroupInvite   = "invite"   // invited users only
+)
+
+// the roles of the group members
+const (
+	GroupOwner  = "owner"
+	GroupAdmin  = "admin"
+	GroupMember = "member"
+)
+
 func init() {
 	ensureIndex(groupColl, "gid")
 	ensureIndex(groupColl, "creator")
+	ensureIndex(groupColl, "members")
 	ensureIndex(groupColl, "-time")
 }
 
+type JoinRequest struct {
+	Userid  string    `json:"userid"`
+	Message string    `bson:",omitempty" json:"message,omitempty"`
+	Time    time.Time `json:"-"`
+}
+
+// The members of the group in the database are the source of truth,
+// the members cached in redis are reconciled with them.
 type Group struct {
 	Id      bson.ObjectId `bson:"_id,omitempty" json:"-"`
 	Gid     string        `json:"-"`
 	Name    string        `json:"name,omitempty"`
 	Profile string        `bson:",omitempty" json:"profile,omitempty"`
 	Desc    string        `bson:",omitempty" json:"desc,omitempty"`
-	Creator string        `json:"-"`
+	Creator string        `json:"-"` // the owner, it's changed by transferring the group
 	Level   int           `json:"-"`
 	Addr    *Address      `bson:",omitempty" json:"addr,omitempty"`
 	Loc     *Location     `bson:",omitempty" json:"loc,omitempty"`
 	Time    time.Time     `json:"-"`
+	Access  string        `bson:",omitempty" json:"access,omitempty"`
 	Members []string      `bson:",omitempty" json:"-"`
+	Admins  []string      `bson:",omitempty" json:"-"`
+	Banned  []string      `bson:",omitempty" json:"-"`
+
+	Requests []JoinRequest `bson:",omitempty" json:"-"`
+
+	Muted   map[string]int64 `bson:",omitempty" json:"-"` // userid <-> the unix time the member is muted until
+	MuteAll bool             `bson:"mute_all,omitempty" json:"-"`
+	Pinned  []string         `bson:",omitempty" json:"-"` // the pinned message ids
 }
 
 func (group *Group) Exists() (bool, error) {
@@ -33,58 +66,283 @@ func (group *Group) Exists() (bool, error) {
 
 func (group *Group) FindById(gid string) error {
 	if err := findOne(groupColl, bson.M{"gid": gid}, nil, group); err != nil {
+		if err == mgo.ErrNotFound {
+			return errors.NewError(errors.NotExistsError, "群组不存在")
+		}
 		return errors.NewError(errors.DbError, err.Error())
 	}
 	return nil
 }
 
+// save the new group, the creator is the owner and the first member.
 func (group *Group) Save() error {
 	group.Id = bson.NewObjectId()
 	group.Gid = group.Id.Hex()
+	group.Members = []string{group.Creator}
+	if len(group.Access) == 0 {
+		group.Access = GroupPublic
+	}
 	if err := save(groupColl, group, true); err != nil {
 		return errors.NewError(errors.DbError, err.Error())
 	}
+	changeFileRefs(nil, []string{group.Profile})
 	return nil
 }
 
+// update the info of the group, the members are not changed. The empty fields are kept.
 func (group *Group) Update() error {
-	change := bson.M{
-		"$set": Struct2Map(group),
+	set := bson.M{}
+	if len(group.Name) > 0 {
+		set["name"] = group.Name
+	}
+	if len(group.Profile) > 0 {
+		set["profile"] = group.Profile
+	}
+	if len(group.Desc) > 0 {
+		set["desc"] = group.Desc
+	}
+	if group.Addr != nil {
+		set["addr"] = group.Addr
+		set["loc"] = group.Loc
+	}
+	if len(group.Access) > 0 {
+		set["access"] = group.Access
+	}
+	if len(set) == 0 {
+		return nil
 	}
 
-	if err := update(groupColl, bson.M{"gid": group.Gid}, change, true); err != nil {
+	old := &Group{}
+	if _, err := apply(groupColl, bson.M{"gid": group.Gid}, mgo.Change{Update: bson.M{"$set": set}}, old); err != nil {
 		return errors.NewError(errors.DbError, err.Error())
 	}
+	if len(group.Profile) > 0 && old.Profile != group.Profile {
+		changeFileRefs([]string{old.Profile}, []string{group.Profile})
+	}
 	return nil
 }
 
 func (group *Group) Remove(userid string) error {
-	if err := remove(groupColl, bson.M{"gid": group.Gid, "creator": userid}, true); err != nil {
+	old := &Group{}
+	if _, err := apply(groupColl, bson.M{"gid": group.Gid, "creator": userid}, mgo.Change{Remove: true}, old); err != nil {
+		if err == mgo.ErrNotFound {
+			return errors.NewError(errors.AccessError)
+		}
 		return errors.NewError(errors.DbError, err.Error())
 	}
+	changeFileRefs([]string{old.Profile}, nil)
+	return nil
+}
+
+// the role of the user in the group, empty if the user is not a member.
+func (group *Group) Role(userid string) string {
+	if len(userid) == 0 {
+		return ""
+	}
+	if group.Creator == userid {
+		return GroupOwner
+	}
+	if containsString(group.Admins, userid) {
+		return GroupAdmin
+	}
+	if containsString(group.Members, userid) {
+		return GroupMember
+	}
+	return ""
+}
+
+// the owner or the admins
+func (group *Group) IsAdmin(userid string) bool {
+	role := group.Role(userid)
+	return role == GroupOwner || role == GroupAdmin
+}
+
+func (group *Group) IsBanned(userid string) bool {
+	return containsString(group.Banned, userid)
+}
+
+func (group *Group) Request(userid string) *JoinRequest {
+	for i, _ := range group.Requests {
+		if group.Requests[i].Userid == userid {
+			return &group.Requests[i]
+		}
+	}
 	return nil
 }
 
-func (group *Group) SetMember(userid string, remove bool) error {
-	var m bson.M
+// add the member to the group, the banned users can't be added.
+func (group *Group) AddMember(userid string) error {
+	selector := bson.M{
+		"gid":    group.Gid,
+		"banned": bson.M{"$ne": userid},
+	}
+	change := bson.M{
+		"$addToSet": bson.M{
+			"members": userid,
+		},
+		"$pull": bson.M{
+			"requests": bson.M{"userid": userid},
+		},
+	}
+	if err := update(groupColl, selector, change, true); err != nil {
+		if err == mgo.ErrNotFound {
+			return errors.NewError(errors.AccessError, "已被禁止加入")
+		}
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	if !containsString(group.Members, userid) {
+		group.Members = append(group.Members, userid)
+	}
+	return nil
+}
 
-	if remove {
-		m = bson.M{
-			"$pull": bson.M{
-				"members": userid,
-			},
+// remove the member from the group, the owner can't be removed.
+// The user can't join the group again if it's banned.
+func (group *Group) RemoveMember(userid string, ban bool) error {
+	selector := bson.M{
+		"gid":     group.Gid,
+		"creator": bson.M{"$ne": userid},
+	}
+	change := bson.M{
+		"$pull": bson.M{
+			"members":  userid,
+			"admins":   userid,
+			"requests": bson.M{"userid": userid},
+		},
+	}
+	if ban {
+		change["$addToSet"] = bson.M{"banned": userid}
+	}
+	if err := update(groupColl, selector, change, true); err != nil {
+		if err == mgo.ErrNotFound {
+			return errors.NewError(errors.AccessError, "群主不能退出群组")
 		}
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+func (group *Group) Unban(userid string) error {
+	change := bson.M{
+		"$pull": bson.M{
+			"banned": userid,
+		},
+	}
+	if err := update(groupColl, bson.M{"gid": group.Gid}, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+// request to join the group, it's waiting for the approval of the admins.
+func (group *Group) AddRequest(userid, message string) error {
+	selector := bson.M{
+		"gid":             group.Gid,
+		"members":         bson.M{"$ne": userid},
+		"banned":          bson.M{"$ne": userid},
+		"requests.userid": bson.M{"$ne": userid},
+	}
+	change := bson.M{
+		"$push": bson.M{
+			"requests": &JoinRequest{Userid: userid, Message: message, Time: time.Now()},
+		},
+	}
+	if err := update(groupColl, selector, change, true); err != nil && err != mgo.ErrNotFound {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+func (group *Group) RemoveRequest(userid string) error {
+	change := bson.M{
+		"$pull": bson.M{
+			"requests": bson.M{"userid": userid},
+		},
+	}
+	if err := update(groupColl, bson.M{"gid": group.Gid}, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+// set or unset the member as the admin of the group
+func (group *Group) SetAdmin(userid string, admin bool) error {
+	selector := bson.M{
+		"gid":     group.Gid,
+		"members": userid,
+	}
+	var change bson.M
+	if admin {
+		change = bson.M{"$addToSet": bson.M{"admins": userid}}
 	} else {
-		m = bson.M{
-			"$addToSet": bson.M{
-				"members": userid,
-			},
+		change = bson.M{"$pull": bson.M{"admins": userid}}
+	}
+	if err := update(groupColl, selector, change, true); err != nil {
+		if err == mgo.ErrNotFound {
+			return errors.NewError(errors.NotExistsError, "不是群组成员")
 		}
+		return errors.NewError(errors.DbError, err.Error())
 	}
+	return nil
+}
 
-	if err := update(groupColl, bson.M{"gid": group.Gid}, m, true); err != nil {
+// transfer the ownership to the member, the former owner becomes a member.
+func (group *Group) Transfer(from, to string) error {
+	selector := bson.M{
+		"gid":     group.Gid,
+		"creator": from,
+		"members": to,
+	}
+	change := bson.M{
+		"$set": bson.M{
+			"creator": to,
+		},
+		"$pull": bson.M{
+			"admins": to,
+		},
+	}
+	if err := update(groupColl, selector, change, true); err != nil {
+		if err == mgo.ErrNotFound {
+			return errors.NewError(errors.AccessError)
+		}
 		return errors.NewError(errors.DbError, err.Error())
 	}
+	group.Creator = to
+	return nil
+}
 
+// set the members of the groups saved before the members were kept in the database.
+func (group *Group) SetMembers(members []string) error {
+	if !containsString(members, group.Creator) {
+		members = append(members, group.Creator)
+	}
+	change := bson.M{
+		"$set": bson.M{
+			"members": members,
+		},
+	}
+	if err := update(groupColl, bson.M{"gid": group.Gid}, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	group.Members = members
 	return nil
 }
+
+// all the groups with the members
+func AllGroups() ([]Group, error) {
+	var groups []Group
+	selector := bson.M{"gid": true, "creator": true, "members": true}
+	if err := search(groupColl, nil, selector, 0, 0, nil, nil, &groups); err != nil {
+		return nil, errors.NewError(errors.DbError, err.Error())
+	}
+	return groups, nil
+}
+
+// the current members of the group in the database
+func GroupMembers(gid string) ([]string, error) {
+	group := &Group{}
+	if err := group.FindById(gid); err != nil {
+		return nil, err
+	}
+	return group.Members, nil
+}
@@ -0,0 +1,210 @@
+// groupmsg
+package models
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"strings"
+	"time"
+)
+
+const (
+	MaxPinnedMessages = 10
+)
+
+func init() {
+	ensureIndex(msgColl, "to", "type", "-time")
+}
+
+// the message mentions all the members of the group
+func MentionsAll(body []MsgBody) bool {
+	for _, b := range body {
+		switch b.Type {
+		case "at", "mention":
+			if b.Content == "all" {
+				return true
+			}
+		default:
+			if strings.Contains(b.Content, "@all") || strings.Contains(b.Content, "@所有人") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// the time until the member is muted, zero if the member is not muted.
+func (group *Group) MutedUntil(userid string) time.Time {
+	if until, ok := group.Muted[userid]; ok && until > time.Now().Unix() {
+		return time.Unix(until, 0)
+	}
+	return time.Time{}
+}
+
+// check whether the user can send the message to the group.
+// The admins can always send, the others can't send when the group or the member is muted,
+// and only the admins can mention all.
+func (group *Group) CanSend(userid string, body []MsgBody) error {
+	if len(group.Role(userid)) == 0 {
+		return errors.NewError(errors.AccessError, "不是群组成员")
+	}
+	if group.IsAdmin(userid) {
+		return nil
+	}
+	if group.MuteAll {
+		return errors.NewError(errors.AccessError, "全员禁言中")
+	}
+	if !group.MutedUntil(userid).IsZero() {
+		return errors.NewError(errors.AccessError, "已被禁言")
+	}
+	if MentionsAll(body) {
+		return errors.NewError(errors.AccessError, "只有管理员可以@所有人")
+	}
+	return nil
+}
+
+// mute the member until the time, the member is unmuted if until is zero.
+func (group *Group) Mute(userid string, until time.Time) error {
+	var change bson.M
+	if until.IsZero() {
+		change = bson.M{"$unset": bson.M{"muted." + userid: 1}}
+	} else {
+		change = bson.M{"$set": bson.M{"muted." + userid: until.Unix()}}
+	}
+	if err := update(groupColl, bson.M{"gid": group.Gid}, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+// mute all the members except the admins
+func (group *Group) SetMuteAll(mute bool) error {
+	change := bson.M{
+		"$set": bson.M{
+			"mute_all": mute,
+		},
+	}
+	if err := update(groupColl, bson.M{"gid": group.Gid}, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	group.MuteAll = mute
+	return nil
+}
+
+// pin or unpin the message of the group, the latest pinned message is the first.
+func (group *Group) Pin(msgid string, pin bool) error {
+	selector := bson.M{"gid": group.Gid}
+	var change bson.M
+	if pin {
+		if containsString(group.Pinned, msgid) {
+			return nil
+		}
+		if len(group.Pinned) >= MaxPinnedMessages {
+			return errors.NewError(errors.AccessError, "置顶消息已达上限")
+		}
+		change = bson.M{
+			"$push": bson.M{
+				"pinned": bson.M{"$each": []string{msgid}, "$position": 0},
+			},
+		}
+	} else {
+		change = bson.M{"$pull": bson.M{"pinned": msgid}}
+	}
+	if err := update(groupColl, selector, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+func (group *Group) PinnedMessages() ([]Message, error) {
+	var ids []bson.ObjectId
+	for _, id := range group.Pinned {
+		if bson.IsObjectIdHex(id) {
+			ids = append(ids, bson.ObjectIdHex(id))
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var msgs []Message
+	if err := search(msgColl, bson.M{"_id": bson.M{"$in": ids}}, nil, 0, 0, nil, nil, &msgs); err != nil {
+		return nil, err
+	}
+	// in the pinned order
+	list := make([]Message, 0, len(msgs))
+	for _, id := range ids {
+		for i, _ := range msgs {
+			if msgs[i].Id == id {
+				list = append(list, msgs[i])
+				break
+			}
+		}
+	}
+	return list, nil
+}
+
+// the message of the group
+func (group *Group) Message(msgid string) (*Message, error) {
+	if !bson.IsObjectIdHex(msgid) {
+		return nil, errors.NewError(errors.NotFoundError)
+	}
+	msg := &Message{}
+	query := bson.M{
+		"_id":  bson.ObjectIdHex(msgid),
+		"to":   group.Gid,
+		"type": EventGChat,
+	}
+	if find, err := msg.findOne(query); !find {
+		if err == nil {
+			err = errors.NewError(errors.NotFoundError)
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// the message history of the group, paged by the message id.
+func (group *Group) Messages(paging *Paging) (int, []Message, error) {
+	var msgs []Message
+	total := 0
+	query := bson.M{
+		"to":   group.Gid,
+		"type": EventGChat,
+	}
+
+	pageUp := false
+	sortFields := []string{"-time"}
+	if len(paging.First) > 0 {
+		pageUp = true
+		sortFields = []string{"time"}
+	}
+
+	if err := psearch(msgColl, query, nil, sortFields, &total, &msgs,
+		msgPagingFunc, paging); err != nil {
+		e := errors.NewError(errors.DbError, err.Error())
+		if err == mgo.ErrNotFound {
+			e = errors.NewError(errors.NotFoundError, err.Error())
+		}
+		return total, nil, e
+	}
+
+	paging.First = ""
+	paging.Last = ""
+	paging.Count = 0
+	if len(msgs) > 0 {
+		if pageUp {
+			for i := 0; i < len(msgs)/2; i++ {
+				t := msgs[i]
+				msgs[i] = msgs[len(msgs)-i-1]
+				msgs[len(msgs)-i-1] = t
+			}
+		}
+		paging.First = msgs[0].Id.Hex()
+		paging.Last = msgs[len(msgs)-1].Id.Hex()
+		paging.Count = total
+	}
+
+	return total, msgs, nil
+}
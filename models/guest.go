@@ -0,0 +1,106 @@
+// guest
+package models
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	GuestRole   = "guest"
+	GuestExpire = 30 * 24 * time.Hour // inactive guests are removed after a month
+)
+
+func init() {
+	ensureIndex(accountColl, "role", "lastlogin")
+}
+
+func (this *Account) IsGuest() bool {
+	return this.Role == GuestRole || strings.HasPrefix(this.Id, GuestUserPrefix)
+}
+
+// save the guest account, guests have no registration time, so they are not searchable.
+func (this *Account) SaveGuest() error {
+	this.Role = GuestRole
+	this.RegTime = time.Time{}
+	return this.Save()
+}
+
+// upgrade the guest to the registered account of the role.
+// The userid is not changed, so the records, props, wallet and friends of the guest are kept.
+func (this *Account) Upgrade(role string, change bson.M) error {
+	if change == nil {
+		change = bson.M{}
+	}
+	change["role"] = role
+	change["reg_time"] = time.Now()
+
+	selector := bson.M{
+		"_id":  this.Id,
+		"role": GuestRole,
+	}
+	if err := update(accountColl, selector, bson.M{"$set": change}, true); err != nil {
+		if err == mgo.ErrNotFound {
+			return errors.NewError(errors.AccessError, "非游客账号")
+		}
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	reindexUser(this.Id)
+	// the profile is only set if the guest has none
+	if profile, ok := change["profile"].(string); ok {
+		changeFileRefs(nil, []string{profile})
+	}
+	return nil
+}
+
+// the guests not logged in since the time
+func ExpiredGuests(before time.Time) ([]Account, error) {
+	var users []Account
+	query := bson.M{
+		"role":      GuestRole,
+		"lastlogin": bson.M{"$lt": before},
+	}
+	if err := search(accountColl, query, nil, 0, 0, nil, nil, &users); err != nil {
+		return nil, errors.NewError(errors.DbError, err.Error())
+	}
+	return users, nil
+}
+
+// remove the guest account and its records, events and photos.
+func (this *Account) RemoveGuest() error {
+	selector := bson.M{
+		"_id":  this.Id,
+		"role": GuestRole,
+	}
+	if err := remove(accountColl, selector, true); err != nil {
+		if err == mgo.ErrNotFound { // upgraded
+			return nil
+		}
+		return errors.NewError(errors.DbError, err.Error())
+	}
+
+	if _, err := RemoveRecordsByID(this.Id, "", 0, 0); err != nil {
+		log.Println(err)
+	}
+	if _, err := removeAll(eventColl, bson.M{"data.to": this.Id}, true); err != nil {
+		log.Println(err)
+	}
+	change := bson.M{
+		"$pull": bson.M{
+			"members": this.Id,
+			"admins":  this.Id,
+		},
+	}
+	if _, err := updateAll(groupColl, bson.M{"members": this.Id}, change, true); err != nil {
+		log.Println(err)
+	}
+	changeFileRefs([]string{this.Profile}, nil)
+	changeFileRefs(this.Photos, nil)
+	changeFileRefs(proofRefs(this.Tasks.Proofs), nil)
+	userIndex.Remove(this.Id)
+	return nil
+}
@@ -0,0 +1,168 @@
+// identity
+package models
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"log"
+	"strings"
+	"time"
+)
+
+func init() {
+	withCollection(identityColl, nil, func(c *mgo.Collection) error {
+		return c.EnsureIndex(mgo.Index{
+			Key:    []string{"provider", "uid"},
+			Unique: true,
+		})
+	})
+	ensureIndex(identityColl, "userid")
+
+	registerMigration("weibo_identities", migrateWeiboIdentities)
+}
+
+// move the weibo uids of the accounts registered before the identities to the identities,
+// so the linked weibo can be unlinked. The uid is kept on the account if it can't be moved, and retried at the next start.
+func migrateWeiboIdentities() (int, error) {
+	query := bson.M{"weibo": bson.M{"$nin": []interface{}{nil, ""}}}
+	return migrateEach(accountColl, query, bson.M{"weibo": 1},
+		func() interface{} { return &Account{} },
+		func(doc interface{}) (interface{}, bson.M) {
+			user := doc.(*Account)
+			identity := &Identity{Provider: "weibo", Uid: strings.ToLower(user.Weibo), Userid: user.Id}
+			if err := identity.Save(); err != nil {
+				log.Println(user.Id, err)
+				return user.Id, nil
+			}
+			return user.Id, bson.M{"$unset": bson.M{"weibo": 1}}
+		})
+}
+
+// Identity is the third-party account linked to the user.
+type Identity struct {
+	Id       bson.ObjectId `bson:"_id,omitempty"`
+	Provider string
+	Uid      string
+	Userid   string
+	Token    string `bson:",omitempty"`
+	Time     time.Time
+}
+
+func (this *Identity) findOne(query interface{}) (bool, error) {
+	var ids []Identity
+
+	err := search(identityColl, query, nil, 0, 1, nil, nil, &ids)
+	if err != nil {
+		return false, err
+	}
+	if len(ids) > 0 {
+		*this = ids[0]
+	}
+	return len(ids) > 0, nil
+}
+
+func (this *Identity) FindByUid(provider, uid string) (bool, error) {
+	return this.findOne(bson.M{"provider": provider, "uid": uid})
+}
+
+func (this *Identity) FindByUser(provider, userid string) (bool, error) {
+	return this.findOne(bson.M{"provider": provider, "userid": userid})
+}
+
+// the identity is linked to a registered user, not the unregistered account kept for the imported friend.
+func (this *Identity) Registered() (bool, error) {
+	user := &Account{}
+	find, err := user.FindByUserid(this.Userid)
+	if err != nil {
+		return false, errors.NewError(errors.DbError, err.Error())
+	}
+	return find && user.RegTime.Unix() > 0, nil
+}
+
+// link the identity to the user, the token is updated if it's linked already.
+// It fails if the identity has been linked to another registered user,
+// the one linked to the unregistered account kept for the imported friend is handed over.
+func (this *Identity) Save() error {
+	this.Time = time.Now()
+	selector := bson.M{"provider": this.Provider, "uid": this.Uid, "userid": this.Userid}
+	change := bson.M{
+		"$set": bson.M{
+			"token": this.Token,
+			"time":  this.Time,
+		},
+	}
+	// the unique index rejects the insert if the identity is linked to another user
+	if _, err := upsert(identityColl, selector, change, true); err != nil {
+		if !mgo.IsDup(err) {
+			return errors.NewError(errors.DbError, err.Error())
+		}
+		if claimed, err := this.claim(); err != nil {
+			return err
+		} else if !claimed {
+			return errors.NewError(errors.UserExistError, "账号已被其他用户绑定")
+		}
+	}
+
+	if find, err := this.FindByUid(this.Provider, this.Uid); !find {
+		if err == nil {
+			err = errors.NewError(errors.DbError)
+		}
+		return err
+	}
+	return nil
+}
+
+// hand the identity linked to the unregistered account over to the user, the unregistered account is removed.
+func (this *Identity) claim() (bool, error) {
+	linked := &Identity{}
+	if find, err := linked.FindByUid(this.Provider, this.Uid); !find {
+		if err != nil {
+			return false, errors.NewError(errors.DbError, err.Error())
+		}
+		return false, nil
+	}
+	if registered, err := linked.Registered(); registered || err != nil {
+		return false, err
+	}
+
+	selector := bson.M{"provider": this.Provider, "uid": this.Uid, "userid": linked.Userid}
+	change := bson.M{
+		"$set": bson.M{
+			"userid": this.Userid,
+			"token":  this.Token,
+			"time":   this.Time,
+		},
+	}
+	if err := update(identityColl, selector, change, true); err != nil {
+		if err == mgo.ErrNotFound { // claimed by another user
+			return false, nil
+		}
+		return false, errors.NewError(errors.DbError, err.Error())
+	}
+
+	// the account is kept if it's registered in the meantime
+	err := remove(accountColl, bson.M{"_id": linked.Userid, "reg_time": bson.M{"$exists": false}}, true)
+	if err == nil {
+		userIndex.Remove(linked.Userid)
+	} else if err != mgo.ErrNotFound {
+		log.Println(err)
+	}
+	return true, nil
+}
+
+func Identities(userid string) ([]Identity, error) {
+	var ids []Identity
+	err := search(identityColl, bson.M{"userid": userid}, nil, 0, 0, []string{"time"}, nil, &ids)
+	return ids, err
+}
+
+func RemoveIdentity(userid, provider string) error {
+	if err := remove(identityColl, bson.M{"provider": provider, "userid": userid}, true); err != nil {
+		if err == mgo.ErrNotFound {
+			return errors.NewError(errors.NotFoundError)
+		}
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
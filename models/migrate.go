@@ -0,0 +1,79 @@
+// migrate
+package models
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"log"
+	"time"
+)
+
+type migration struct {
+	name string
+	run  func() (int, error) // it returns the number of the migrated documents
+	once bool                // it's recorded after done and never run again
+}
+
+// the backfills of the data stored before the fields were added, they only touch the documents not migrated yet.
+var migrations []migration
+
+func registerMigration(name string, run func() (int, error)) {
+	migrations = append(migrations, migration{name: name, run: run})
+}
+
+// the migration runs only once, such as the one recounting all the documents.
+func registerMigrationOnce(name string, run func() (int, error)) {
+	migrations = append(migrations, migration{name: name, run: run, once: true})
+}
+
+// Migrate runs all the migrations, it should be run at startup before the background jobs.
+func Migrate() error {
+	for _, m := range migrations {
+		if m.once {
+			if done, err := exists(migrationColl, bson.M{"_id": m.name}); err != nil {
+				return errors.NewError(errors.DbError, err.Error())
+			} else if done {
+				continue
+			}
+		}
+
+		n, err := m.run()
+		if err != nil {
+			return errors.NewError(errors.DbError, m.name+": "+err.Error())
+		}
+		if n > 0 {
+			log.Println("migrate", m.name+":", n)
+		}
+
+		if m.once {
+			if _, err := upsert(migrationColl, bson.M{"_id": m.name}, bson.M{"_id": m.name, "time": time.Now()}, true); err != nil {
+				return errors.NewError(errors.DbError, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// update the documents matched the query one by one with the change returned by f, nil is skipped.
+func migrateEach(collection string, query, selector bson.M, result func() interface{},
+	f func(doc interface{}) (id interface{}, change bson.M)) (int, error) {
+
+	n := 0
+	err := withCollection(collection, &mgo.Safe{}, func(c *mgo.Collection) error {
+		iter := c.Find(query).Select(selector).Iter()
+		doc := result()
+		for iter.Next(doc) {
+			if id, change := f(doc); change != nil {
+				if err := c.UpdateId(id, change); err != nil && err != mgo.ErrNotFound {
+					iter.Close()
+					return err
+				}
+				n++
+			}
+			doc = result()
+		}
+		return iter.Close()
+	})
+	return n, err
+}
@@ -45,6 +45,13 @@ func (this *Message) findOne(query interface{}) (bool, error) {
 	return len(msgs) > 0, nil
 }
 
+func (this *Message) FindById(id string) (bool, error) {
+	if !bson.IsObjectIdHex(id) {
+		return false, nil
+	}
+	return this.findOne(bson.M{"_id": bson.ObjectIdHex(id)})
+}
+
 func (this *Message) Last(from string) error {
 	var msgs []Message
 
@@ -64,16 +71,20 @@ func (this *Message) Save() error {
 	if err := save(msgColl, this, true); err != nil {
 		return errors.NewError(errors.DbError, err.(*mgo.LastError).Error())
 	}
-
+	changeFileRefs(nil, msgImageRefs(this.Body))
 	return nil
 }
 
 func (this *Message) RemoveId() error {
+	if find, err := this.findOne(bson.M{"_id": this.Id}); !find {
+		return err
+	}
 	if err := removeId(msgColl, this.Id, true); err != nil {
 		if e, ok := err.(*mgo.LastError); ok {
 			return errors.NewError(errors.DbError, e.Error())
 		}
 	}
+	changeFileRefs(msgImageRefs(this.Body), nil)
 	return nil
 }
 
@@ -88,11 +99,23 @@ func (this *Message) Delete(from, to string, start, end time.Time) (count int, e
 			"$gte": start,
 		},
 	}
-	info, err := removeAll(msgColl, selector, true)
+	var msgs []Message
+	if err = search(msgColl, selector, bson.M{"body": 1}, 0, 0, nil, nil, &msgs); err != nil {
+		return
+	}
+	ids := make([]bson.ObjectId, len(msgs))
+	for i, _ := range msgs {
+		ids[i] = msgs[i].Id
+	}
+	info, err := removeAll(msgColl, bson.M{"_id": bson.M{"$in": ids}}, true)
 	if info != nil {
 		count = info.Removed
 	}
-
+	if err == nil {
+		for i, _ := range msgs {
+			changeFileRefs(msgImageRefs(msgs[i].Body), nil)
+		}
+	}
 	return
 }
 
@@ -0,0 +1,81 @@
+// password
+package models
+
+import (
+	"crypto/md5"
+	"fmt"
+	"github.com/ginuerzh/sports/errors"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"labix.org/v2/mgo/bson"
+	"strings"
+)
+
+var PasswordCost = bcrypt.DefaultCost
+
+func HashPassword(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return "", errors.NewError(errors.PasswordError, err.Error())
+	}
+	return string(b), nil
+}
+
+// the legacy passwords are unsalted md5 hex strings
+func isLegacyPassword(hash string) bool {
+	return !strings.HasPrefix(hash, "$2")
+}
+
+func legacyPassword(password string) string {
+	h := md5.New()
+	io.WriteString(h, password)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func (this *Account) CheckPassword(password string) bool {
+	if len(this.Password) == 0 || len(password) == 0 {
+		return false
+	}
+	if isLegacyPassword(this.Password) {
+		return this.Password == legacyPassword(password)
+	}
+	return bcrypt.CompareHashAndPassword([]byte(this.Password), []byte(password)) == nil
+}
+
+// check the password, and rehash it if the hash is legacy or weaker than PasswordCost.
+func (this *Account) verifyPassword(password string) bool {
+	if !this.CheckPassword(password) {
+		return false
+	}
+
+	rehash := isLegacyPassword(this.Password)
+	if !rehash {
+		cost, err := bcrypt.Cost([]byte(this.Password))
+		rehash = err == nil && cost < PasswordCost
+	}
+	if rehash {
+		if hash, err := HashPassword(password); err == nil {
+			// only replace the hash we've verified
+			selector := bson.M{"_id": this.Id, "password": this.Password}
+			if err := update(accountColl, selector, bson.M{"$set": bson.M{"password": hash}}, true); err == nil {
+				this.Password = hash
+			}
+		}
+	}
+	return true
+}
+
+// mark the password of the compromised account as expired, the user must reset it before login.
+func (this *Account) ExpirePassword(expired bool) error {
+	var change bson.M
+	if expired {
+		change = bson.M{"$set": bson.M{"password_expired": true}}
+	} else {
+		change = bson.M{"$unset": bson.M{"password_expired": 1}}
+	}
+	if err := updateId(accountColl, this.Id, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	this.PasswordExpired = expired
+	return nil
+}
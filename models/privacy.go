@@ -0,0 +1,92 @@
+// privacy
+package models
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"labix.org/v2/mgo/bson"
+)
+
+const (
+	PrivacyPublic    = "public"
+	PrivacyFollowers = "followers"
+	PrivacyFriends   = "friends"
+	PrivacyPrivate   = "private" // only me
+)
+
+// Who can see the profile, the records, the articles and the location of the user, it's public if empty.
+// The others need the approval to follow the private account.
+type Privacy struct {
+	Profile  string `bson:",omitempty" json:"profile"`
+	Records  string `bson:",omitempty" json:"records"`
+	Articles string `bson:",omitempty" json:"articles"`
+	Location string `bson:",omitempty" json:"location"`
+	Private  bool   `bson:",omitempty" json:"private"`
+}
+
+func ValidPrivacy(visibility string) bool {
+	switch visibility {
+	case "", PrivacyPublic, PrivacyFollowers, PrivacyFriends, PrivacyPrivate:
+		return true
+	}
+	return false
+}
+
+// Whether the content with the visibility can be seen by the viewer,
+// rel is the relationship of the owner to the viewer. The blacklisted viewers see nothing.
+func Visible(visibility, rel string) bool {
+	switch rel {
+	case RelSelf:
+		return true
+	case RelBlacklist:
+		return false
+	}
+
+	switch visibility {
+	case PrivacyPrivate:
+		return false
+	case PrivacyFriends:
+		return rel == RelFriend
+	case PrivacyFollowers:
+		return rel == RelFriend || rel == RelFollower
+	}
+	return true
+}
+
+// the visibilities of the articles hidden from the viewer, rel is the relationship of the author to the viewer.
+func HiddenVisibilities(rel string) []string {
+	switch rel {
+	case RelSelf:
+		return nil
+	case RelFriend:
+		return []string{PrivacyPrivate}
+	case RelFollower:
+		return []string{PrivacyFriends, PrivacyPrivate}
+	}
+	return []string{PrivacyFollowers, PrivacyFriends, PrivacyPrivate}
+}
+
+func (this *Account) SetPrivacy(privacy Privacy) error {
+	change := bson.M{
+		"$set": bson.M{
+			"privacy": privacy,
+		},
+	}
+	if err := updateId(accountColl, this.Id, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	this.Privacy = privacy
+	return nil
+}
+
+func (this *Article) SetVisibility(visibility string) error {
+	change := bson.M{
+		"$set": bson.M{
+			"visibility": visibility,
+		},
+	}
+	if err := updateId(articleColl, this.Id, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	this.Visibility = visibility
+	return nil
+}
@@ -0,0 +1,106 @@
+// quota
+package models
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+)
+
+// default storage quotas and hourly upload limits
+const (
+	GuestQuota      int64 = 20 << 20  // 20M
+	UserQuota       int64 = 500 << 20 // 500M
+	PrivilegedQuota int64 = 2 << 30   // 2G
+
+	GuestUploadsPerHour      = 10
+	UserUploadsPerHour       = 60
+	PrivilegedUploadsPerHour = 200
+)
+
+func init() {
+	registerMigrationOnce("storage_used", migrateStorageUsed)
+}
+
+// the storage used by the users is recounted from the files, the files uploaded before were not counted.
+func migrateStorageUsed() (int, error) {
+	used := make(map[string]int64)
+	err := withCollection(fileColl, nil, func(c *mgo.Collection) error {
+		iter := c.Find(nil).Select(bson.M{"fid": 1, "owner": 1, "length": 1, "variants": 1}).Iter()
+		file := File{}
+		for iter.Next(&file) {
+			used[file.Owner] += file.Size()
+			file = File{}
+		}
+		return iter.Close()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return migrateEach(accountColl, nil, bson.M{"storage_used": 1},
+		func() interface{} { return &Account{} },
+		func(doc interface{}) (interface{}, bson.M) {
+			user := doc.(*Account)
+			if user.StorageUsed == used[user.Id] {
+				return nil, nil
+			}
+			return user.Id, bson.M{"$set": bson.M{"storage_used": used[user.Id]}}
+		})
+}
+
+// the quota set by admin takes precedence over the default of the role
+func (this *Account) StorageQuota() int64 {
+	if this.Quota > 0 {
+		return this.Quota
+	}
+	if this.IsGuest() {
+		return GuestQuota
+	}
+	if this.Privilege > 0 {
+		return PrivilegedQuota
+	}
+	return UserQuota
+}
+
+func (this *Account) UploadsPerHour() int {
+	if this.IsGuest() {
+		return GuestUploadsPerHour
+	}
+	if this.Privilege > 0 {
+		return PrivilegedUploadsPerHour
+	}
+	return UserUploadsPerHour
+}
+
+// set the storage quota in bytes, 0 restores the default quota.
+func (this *Account) SetQuota(quota int64) error {
+	var change bson.M
+	if quota > 0 {
+		change = bson.M{"$set": bson.M{"quota": quota}}
+	} else {
+		change = bson.M{"$unset": bson.M{"quota": 1}}
+	}
+	if err := updateId(accountColl, this.Id, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	if quota < 0 {
+		quota = 0
+	}
+	this.Quota = quota
+	return nil
+}
+
+func addStorageUsed(userid string, n int64) error {
+	if len(userid) == 0 || n == 0 {
+		return nil
+	}
+	if err := updateId(accountColl, userid, bson.M{"$inc": bson.M{"storage_used": n}}, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+func (this *Account) FileCount() (int, error) {
+	return count(fileColl, bson.M{"owner": this.Id})
+}
@@ -55,6 +55,13 @@ func (this *Record) FindByTask(tid int) (bool, error) {
 	return this.findOne(bson.M{"uid": this.Uid, "task": tid})
 }
 
+func (this *Record) FindById(id string) (bool, error) {
+	if !bson.IsObjectIdHex(id) {
+		return false, nil
+	}
+	return this.findOne(bson.M{"_id": bson.ObjectIdHex(id)})
+}
+
 func TotalRecords(userid string) (int, error) {
 	total := 0
 	err := search(recordColl, bson.M{"uid": userid}, nil, 0, 0, nil, &total, nil)
@@ -80,6 +87,9 @@ func (this *Record) Save() error {
 	if err := save(recordColl, this, true); err != nil {
 		return errors.NewError(errors.DbError, err.Error())
 	}
+	if this.Sport != nil {
+		changeFileRefs(nil, this.Sport.Pics)
+	}
 	return nil
 }
 
@@ -265,5 +275,9 @@ func RemoveRecordsByID(id, recType string, fromTime, toTime int64) (int, error)
 	if err != nil {
 		return 0, err
 	}
+	// only the first matched record is removed
+	if records[0].Sport != nil {
+		changeFileRefs(records[0].Sport.Pics, nil)
+	}
 	return total, err
 }
@@ -4,10 +4,12 @@ package models
 import (
 	//"fmt"
 	"github.com/garyburd/redigo/redis"
+	"github.com/ginuerzh/sports/errors"
 	"log"
-	//"strconv"
+	"math"
+	"strconv"
 	//"encoding/json"
-	//"labix.org/v2/mgo/bson"
+	"labix.org/v2/mgo/bson"
 	//"strings"
 	"time"
 )
@@ -31,6 +33,18 @@ const (
 	redisUserWBImportPrefix  = redisPrefix + ":user:import:weibo:" // set per user
 	redisUserGroupPrefix     = redisPrefix + ":user:group:"        // hash per user
 	redisGroupPrefix         = redisPrefix + ":group:"             // set per group
+	redisGroupInvitePrefix   = redisPrefix + ":group:invite:"      // string per invitation code, group id
+	redisUserTimelinePrefix  = redisPrefix + ":user:timeline:"     // sorted set per user, home timeline scored by the publish time
+	redisUserPopular         = redisPrefix + ":user:popular"       // set, authors whose articles are fanned out on read
+	redisUserUploadPrefix    = redisPrefix + ":user:uploads:"      // string per user per hour, upload count
+	redisVerifyCodePrefix    = redisPrefix + ":verify:code:"       // hash per purpose and phone, code and attempts
+	redisVerifySentPrefix    = redisPrefix + ":verify:sent:"       // string per phone, exists in the resend interval
+	redisVerifyDailyPrefix   = redisPrefix + ":verify:daily:"      // string per phone or ip per day, codes sent
+	redisUserSessionsPrefix  = redisPrefix + ":user:sessions:"     // sorted set per user, sessions ordered by last seen
+	redisSessionPrefix       = redisPrefix + ":session:"           // hash per session
+	redisTokenSessionPrefix  = redisPrefix + ":token:session:"     // string per access token, session id
+	redisRefreshTokenPrefix  = redisPrefix + ":token:refresh:"     // string per refresh token, session id
+	redisGuestLoginPrefix    = redisPrefix + ":guest:logins:"      // string per ip per hour, guest login count
 
 	redisStatArticleViewPrefix = redisPrefix + ":stat:articles:view:"  // sorted set per day
 	redisStatArticleView       = redisPrefix + ":stat:articles:view"   // sorted set
@@ -42,8 +56,27 @@ const (
 	redisArticleThumbPrefix   = redisPrefix + ":article:thumb:"   // set per article
 	redisArticleReviewPrefix  = redisPrefix + ":article:review:"  // set per article
 	redisArticleRelatedPrefix = redisPrefix + ":article:related:" // sorted set per article
+
+	redisStatTopicPrefix     = redisPrefix + ":stat:topics:"     // sorted set per day
+	redisStatTopicTmpPrefix  = redisPrefix + ":stat:topics:tmp:" // sorted set per request, the trending topics
+	redisStatTopic           = redisPrefix + ":stat:topics"      // sorted set, articles per topic
+	redisUserTopicPrefix     = redisPrefix + ":user:topics:"     // set per user, followed topics
+	redisTopicFollowerPrefix = redisPrefix + ":topic:follower:"  // set per topic
 	//redisUserArticlePrefix    = redisPrefix + ":user:articles:" // sorted set per user
 
+	redisGroupChallengePrefix = redisPrefix + ":group:challenges:" // set per group, running challenges
+	redisChallengeUserPrefix  = redisPrefix + ":challenge:users:"  // sorted set per challenge, members' scores
+	redisChallengeGroupPrefix = redisPrefix + ":challenge:groups:" // sorted set per challenge, groups' scores
+
+	redisUserRecommendPrefix     = redisPrefix + ":user:recommend:"         // sorted set per user, precomputed recommendations
+	redisUserReasonPrefix        = redisPrefix + ":user:recommend:reason:"  // hash per user, reasons of the recommendations
+	redisUserDismissPrefix       = redisPrefix + ":user:recommend:dismiss:" // set per user, dismissed recommendations
+	redisUserRecommendTimePrefix = redisPrefix + ":user:recommend:time:"    // string per user, exists if the recommendations are computed
+	redisRecommendTmpPrefix      = redisPrefix + ":tmp:recommend:"          // sorted set per user, temporary counts
+
+	redisUserFollowRequestPrefix   = redisPrefix + ":user:follow:requests:"  // sorted set per user, pending follow requests by time
+	redisUserFollowRequestedPrefix = redisPrefix + ":user:follow:requested:" // set per user, users requested to follow
+
 	redisDisLeaderboard    = redisPrefix + ":lb:distance:total" // sorted set
 	redisMaxDisLeaderboard = redisPrefix + ":lb:distance:max"   // sorted set
 	redisDurLeaderboard    = redisPrefix + ":lb:duration:total" // sorted set
@@ -59,8 +92,25 @@ const (
 )
 
 const (
-	onlineUserExpire = 30 * 24 * 60 * 60 // 1mon online user timeout
-	onlinesExpire    = 120 * 60          // 60m online set timeout
+	VerifyCodeExpire   = 10 * 60 // 10m
+	VerifyCodeInterval = 60      // 1m between two codes
+	VerifyCodeAttempts = 5
+	VerifyCodeDaily    = 10 // codes sent to a phone a day
+	VerifyCodeIpDaily  = 30 // codes requested from an ip a day
+)
+
+const (
+	onlinesExpire = 120 * 60 // 60m online set timeout
+
+	TimelineMaxLength = 800  // max articles kept in a user's home timeline
+	PopularFollowers  = 5000 // authors with more followers are fanned out on read
+
+	RecommendExpire      = 2 * 24 * 60 * 60 // 2d, the precomputed recommendations are refreshed nightly
+	RecommendEmptyExpire = 60 * 60          // 1h, the empty recommendations are computed again sooner
+	recommendFanout      = 500              // max follows or groups counted for the recommendations
+
+	TopicTrendDays = 30 // the daily topic counters are kept for a month
+	topicTmpExpire = 60 // 1m, the temporary union of the daily topic counters
 )
 
 type RedisLogger struct {
@@ -194,10 +244,16 @@ type redisUser struct {
 }
 */
 
+// the user of the access token, the legacy tokens issued without a session
+// can not be revoked, so they are rejected and the users must login again.
 func (logger *RedisLogger) OnlineUser(token string) (id string) {
 	conn := logger.conn
 
 	id, _ = redis.String(conn.Do("GET", redisUserOnlineUserPrefix+token))
+	if len(id) > 0 && len(logger.TokenSession(token)) == 0 {
+		conn.Do("DEL", redisUserOnlineUserPrefix+token)
+		return ""
+	}
 	return
 	/*
 		if strings.HasPrefix(accessToken, GuestUserPrefix) {
@@ -242,46 +298,6 @@ func (logger *RedisLogger) OnlineUser(token string) (id string) {
 	*/
 }
 
-func (logger *RedisLogger) SetOnlineUser(accessToken string, userid string) {
-	if len(accessToken) == 0 || len(userid) == 0 {
-		return
-	}
-
-	logger.conn.Do("SETEX", redisUserOnlineUserPrefix+accessToken, onlineUserExpire, userid)
-
-	/*
-		u := &redisUser{
-			Userid:    user.Id,
-			Nickname:  user.Nickname,
-			Profile:   user.Profile,
-			RegTime:   user.RegTime.Unix(),
-			Role:      user.Role,
-			SetInfo:   user.Setinfo,
-			WalletId:  user.Wallet.Id,
-			Sharedkey: user.Wallet.Key,
-			Addr:      user.Wallet.Addr,
-			Addrs:     strings.Join(user.Wallet.Addrs, ","),
-			Physical:  user.Props.Physical,
-			Literal:   user.Props.Literal,
-			Mental:    user.Props.Mental,
-			Wealth:    user.Props.Wealth,
-			Score:     user.Props.Score,
-			Level:     user.Props.Level,
-			TimeLimit: user.TimeLimit,
-		}
-		if user.Loc != nil {
-			u.Lat = user.Loc.Lat
-			u.Lng = user.Loc.Lng
-		}
-
-		logger.conn.Do("HMSET", redis.Args{}.Add(redisUserOnlineUserPrefix+accessToken).AddFlat(u)...)
-
-		if login {
-			logger.conn.Do("EXPIRE", redisUserOnlineUserPrefix+accessToken, onlineUserExpire)
-		}
-	*/
-}
-
 func (logger *RedisLogger) SetOnline(userid string) {
 	conn := logger.conn
 	t := onlineTimeString()
@@ -339,6 +355,11 @@ func (logger *RedisLogger) SetRelationship(userid string, peers []string, relati
 				conn.Send("SREM", redisUserFollowPrefix+peer, userid)
 				conn.Send("SREM", redisUserFollowerPrefix+peer, userid)
 				conn.Send("SREM", redisUserFollowerPrefix+userid, peer)
+				// the pending follow requests of both
+				conn.Send("ZREM", redisUserFollowRequestPrefix+userid, peer)
+				conn.Send("SREM", redisUserFollowRequestedPrefix+peer, userid)
+				conn.Send("ZREM", redisUserFollowRequestPrefix+peer, userid)
+				conn.Send("SREM", redisUserFollowRequestedPrefix+userid, peer)
 				conn.Send("SADD", redisUserBlacklistPrefix+userid, peer)
 			} else {
 				conn.Send("SREM", redisUserBlacklistPrefix+userid, peer)
@@ -427,6 +448,67 @@ func (logger *RedisLogger) Groups(userid string) []string {
 	return v
 }
 
+func (logger *RedisLogger) GroupMembers(gid string) []string {
+	v, _ := redis.Strings(logger.conn.Do("SMEMBERS", redisGroupPrefix+gid))
+	return v
+}
+
+// make the cached members of the group the same as the members loaded from the database.
+// The members are loaded after watching the cached members, so the members joined or left
+// concurrently are not overwritten, the transaction is retried if they changed.
+func (logger *RedisLogger) SetGroupMembers(gid string, load func() ([]string, error)) (added, removed int, err error) {
+	conn := logger.conn
+	for retry := 0; retry < 3; retry++ {
+		added, removed = 0, 0
+		if _, err = conn.Do("WATCH", redisGroupPrefix+gid); err != nil {
+			return
+		}
+		cached := logger.GroupMembers(gid)
+		var members []string
+		if members, err = load(); err != nil {
+			conn.Do("UNWATCH")
+			return
+		}
+
+		conn.Send("MULTI")
+		for _, userid := range cached {
+			if !containsString(members, userid) {
+				conn.Send("HDEL", redisUserGroupPrefix+userid, gid)
+				conn.Send("SREM", redisGroupPrefix+gid, userid)
+				removed++
+			}
+		}
+		now := time.Now().Unix()
+		for _, userid := range members {
+			if !containsString(cached, userid) {
+				conn.Send("HSET", redisUserGroupPrefix+userid, gid, now)
+				conn.Send("SADD", redisGroupPrefix+gid, userid)
+				added++
+			}
+		}
+		var reply interface{}
+		if reply, err = conn.Do("EXEC"); err != nil {
+			return
+		}
+		// the transaction is aborted if the members changed
+		if reply != nil {
+			return
+		}
+	}
+	return 0, 0, errors.NewError(errors.DbError, "group members changed while reconciling")
+}
+
+// the invitation code of the group expires in the seconds
+func (logger *RedisLogger) SetGroupInvite(code, gid string, expire int) {
+	logger.conn.Do("SETEX", redisGroupInvitePrefix+code, expire, gid)
+}
+
+// the group of the invitation code, empty if the code is expired.
+func (logger *RedisLogger) GroupInvite(code string) string {
+	gid, _ := redis.String(logger.conn.Do("GET", redisGroupInvitePrefix+code))
+	return gid
+}
+
 func (logger *RedisLogger) DelOnlineUser(accessToken string) {
 	conn := logger.conn
 
@@ -443,6 +525,9 @@ func (logger *RedisLogger) DelOnlineUser(accessToken string) {
 		}
 	*/
 	userid, _ := redis.String(conn.Do("GET", redisUserOnlineUserPrefix+accessToken))
+	if sid := logger.TokenSession(accessToken); len(sid) > 0 {
+		logger.RevokeSession(userid, sid)
+	}
 	conn.Send("MULTI")
 	conn.Send("DEL", redisUserOnlineUserPrefix+accessToken)
 	conn.Send("SREM", redisUserOnlinesPrefix+onlineTimeString(), userid)
@@ -491,10 +576,11 @@ func (logger *RedisLogger) setsCount(key string, days int) []int64 {
 }
 
 func (logger *RedisLogger) EventCount(userid string) (counts []int) {
-	counts = make([]int, 6)
+	counts = make([]int, 7)
 	conn := logger.conn
 	values, err := redis.Values(conn.Do("HMGET", RedisUserInfoPrefix+userid,
-		"event_chat", "event_comment", "event_thumb", "event_reward", "event_subscribe", "event_tx"))
+		"event_chat", "event_comment", "event_thumb", "event_reward", "event_subscribe", "event_tx",
+		"event_mention"))
 	if err != nil {
 		log.Println(err)
 		return
@@ -800,6 +886,221 @@ func (logger *RedisLogger) ArticleTopThumb(max int) []string {
 	return articles
 }
 
+func (logger *RedisLogger) LogArticleTopics(topics []string, add bool) {
+	if len(topics) == 0 {
+		return
+	}
+	inc := 1
+	if !add {
+		inc = -1
+	}
+
+	day := redisStatTopicPrefix + DateString(time.Now())
+	conn := logger.conn
+	conn.Send("MULTI")
+	for _, topic := range topics {
+		if add {
+			conn.Send("ZINCRBY", day, 1, topic)
+		}
+		conn.Send("ZINCRBY", redisStatTopic, inc, topic)
+	}
+	if add {
+		conn.Send("EXPIRE", day, TopicTrendDays*24*60*60)
+	}
+	conn.Do("EXEC")
+}
+
+func (logger *RedisLogger) TopicCount(topic string) int64 {
+	count, _ := redis.Int64(logger.conn.Do("ZSCORE", redisStatTopic, topic))
+	return count
+}
+
+// trending topics of the last days, the older the day the less it weighs.
+func (logger *RedisLogger) TrendingTopics(days, max int) []KV {
+	if days <= 0 {
+		days = 1
+	}
+	if days > TopicTrendDays {
+		days = TopicTrendDays
+	}
+	if max <= 0 {
+		max = 10
+	}
+
+	t := time.Now()
+	d, _ := time.ParseDuration("-24h")
+
+	keys := make([]string, days)
+	weights := make([]int, days)
+	for i := 0; i < days; i++ {
+		keys[i] = redisStatTopicPrefix + DateString(t)
+		weights[i] = days - i
+		t = t.Add(d)
+	}
+
+	// the union is stored per request, so the concurrent requests do not share it
+	tmp := redisStatTopicTmpPrefix + bson.NewObjectId().Hex()
+	args := redis.Args{}.Add(tmp).Add(days).AddFlat(keys).
+		Add("WEIGHTS").AddFlat(weights)
+	conn := logger.conn
+	conn.Send("MULTI")
+	conn.Send("ZUNIONSTORE", args...)
+	conn.Send("EXPIRE", tmp, topicTmpExpire)
+	conn.Send("ZREVRANGE", tmp, 0, max-1, "WITHSCORES")
+	conn.Send("DEL", tmp)
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	var tops []KV
+	s, _ := values[2].([]interface{})
+	if err := redis.ScanSlice(s, &tops); err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	return tops
+}
+
+func (logger *RedisLogger) FollowTopic(userid, topic string, follow bool) {
+	conn := logger.conn
+	conn.Send("MULTI")
+	if follow {
+		conn.Send("SADD", redisUserTopicPrefix+userid, topic)
+		conn.Send("SADD", redisTopicFollowerPrefix+topic, userid)
+	} else {
+		conn.Send("SREM", redisUserTopicPrefix+userid, topic)
+		conn.Send("SREM", redisTopicFollowerPrefix+topic, userid)
+	}
+	conn.Do("EXEC")
+}
+
+func (logger *RedisLogger) Topics(userid string) []string {
+	topics, _ := redis.Strings(logger.conn.Do("SMEMBERS", redisUserTopicPrefix+userid))
+	return topics
+}
+
+func (logger *RedisLogger) TopicFollowed(userid, topic string) (b bool) {
+	b, _ = redis.Bool(logger.conn.Do("SISMEMBER", redisUserTopicPrefix+userid, topic))
+	return
+}
+
+func (logger *RedisLogger) TopicFollowerCount(topic string) (count int) {
+	count, _ = redis.Int(logger.conn.Do("SCARD", redisTopicFollowerPrefix+topic))
+	return
+}
+
+// the score of the article in the timelines, the publish time in milliseconds.
+func timelineScore(article *Article) int64 {
+	return article.PubTime.UnixNano() / int64(time.Millisecond)
+}
+
+// push the article to the home timelines of the author and the followers,
+// articles of popular authors are only pushed to the author and pulled by the followers when reading.
+func (logger *RedisLogger) FanOutArticle(author string, article *Article) {
+	conn := logger.conn
+
+	users := []string{author}
+	followers, _ := redis.Int(conn.Do("SCARD", redisUserFollowerPrefix+author))
+	if followers >= PopularFollowers {
+		conn.Do("SADD", redisUserPopular, author)
+	} else {
+		conn.Do("SREM", redisUserPopular, author)
+		users = append(users, logger.Friends(RelFollower, author)...)
+	}
+
+	conn.Send("MULTI")
+	for _, userid := range users {
+		conn.Send("ZADD", redisUserTimelinePrefix+userid, timelineScore(article), article.Id.Hex())
+		conn.Send("ZREMRANGEBYRANK", redisUserTimelinePrefix+userid, 0, -(TimelineMaxLength + 1))
+	}
+	conn.Do("EXEC")
+}
+
+// add the articles to the home timeline, the score is updated if the article is in the timeline already.
+func (logger *RedisLogger) AddTimeline(userid string, articles ...Article) {
+	if len(userid) == 0 || len(articles) == 0 {
+		return
+	}
+
+	args := redis.Args{}.Add(redisUserTimelinePrefix + userid)
+	for i, _ := range articles {
+		args = args.Add(timelineScore(&articles[i])).Add(articles[i].Id.Hex())
+	}
+	conn := logger.conn
+	conn.Send("MULTI")
+	conn.Send("ZADD", args...)
+	conn.Send("ZREMRANGEBYRANK", redisUserTimelinePrefix+userid, 0, -(TimelineMaxLength + 1))
+	conn.Do("EXEC")
+}
+
+func (logger *RedisLogger) RemoveTimeline(userid string, articles ...string) {
+	if len(userid) == 0 || len(articles) == 0 {
+		return
+	}
+	args := redis.Args{}.Add(redisUserTimelinePrefix + userid).AddFlat(articles)
+	logger.conn.Do("ZREM", args...)
+}
+
+// article ids of the home timeline, newest first. first and last are the articles at the edges of the current page,
+// the articles published at the same time are ordered by the id.
+func (logger *RedisLogger) Timeline(userid string, first, last *Article, count int) []string {
+	if count <= 0 {
+		count = DefaultPageSize
+	}
+
+	conn := logger.conn
+	key := redisUserTimelinePrefix + userid
+	if first != nil {
+		score := timelineScore(first)
+		var articles []string
+		ties, _ := redis.Strings(conn.Do("ZRANGEBYSCORE", key, score, score))
+		for _, id := range ties {
+			if id > first.Id.Hex() {
+				articles = append(articles, id)
+			}
+		}
+		newer, _ := redis.Strings(conn.Do("ZRANGEBYSCORE", key, "("+strconv.FormatInt(score, 10), "+inf",
+			"LIMIT", 0, count))
+		articles = append(articles, newer...)
+		if len(articles) > count {
+			articles = articles[:count]
+		}
+		for i := 0; i < len(articles)/2; i++ {
+			articles[i], articles[len(articles)-i-1] = articles[len(articles)-i-1], articles[i]
+		}
+		return articles
+	}
+
+	if last == nil {
+		articles, _ := redis.Strings(conn.Do("ZREVRANGE", key, 0, count-1))
+		return articles
+	}
+	score := timelineScore(last)
+	var articles []string
+	ties, _ := redis.Strings(conn.Do("ZREVRANGEBYSCORE", key, score, score))
+	for _, id := range ties {
+		if id < last.Id.Hex() {
+			articles = append(articles, id)
+		}
+	}
+	older, _ := redis.Strings(conn.Do("ZREVRANGEBYSCORE", key, "("+strconv.FormatInt(score, 10), "-inf",
+		"LIMIT", 0, count))
+	articles = append(articles, older...)
+	if len(articles) > count {
+		articles = articles[:count]
+	}
+	return articles
+}
+
+// the popular authors followed by the user
+func (logger *RedisLogger) PopularFollowing(userid string) []string {
+	users, _ := redis.Strings(logger.conn.Do("SINTER", redisUserFollowPrefix+userid, redisUserPopular))
+	return users
+}
+
 func (logger *RedisLogger) UpdateRecLB(userid string, distance, duration int) {
 	if len(userid) == 0 {
 		return
@@ -970,3 +1271,410 @@ func (logger *RedisLogger) Transaction(from, to string, amount int64) {
 	conn.Send("ZINCRBY", RedisUserCoins, amount, to)
 	conn.Do("EXEC")
 }
+
+// count the upload of the user in current hour, it returns the count after increment.
+func (logger *RedisLogger) IncrUploads(userid string) int {
+	key := redisUserUploadPrefix + userid + ":" + time.Now().Format("2006010215")
+	conn := logger.conn
+	conn.Send("MULTI")
+	conn.Send("INCR", key)
+	conn.Send("EXPIRE", key, 3600)
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil || len(values) == 0 {
+		return 0
+	}
+	n, _ := redis.Int(values[0], nil)
+	return n
+}
+
+// count the guest logins from the ip in current hour, it returns the count after increment.
+func (logger *RedisLogger) IncrGuestLogins(ip string) int {
+	key := redisGuestLoginPrefix + ip + ":" + time.Now().Format("2006010215")
+	conn := logger.conn
+	conn.Send("MULTI")
+	conn.Send("INCR", key)
+	conn.Send("EXPIRE", key, 3600)
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil || len(values) == 0 {
+		return 0
+	}
+	n, _ := redis.Int(values[0], nil)
+	return n
+}
+
+func (logger *RedisLogger) Uploads(userid string) int {
+	key := redisUserUploadPrefix + userid + ":" + time.Now().Format("2006010215")
+	n, _ := redis.Int(logger.conn.Do("GET", key))
+	return n
+}
+
+// store the verification code, it returns false if the last code was sent just now.
+func (logger *RedisLogger) SetVerifyCode(purpose, phone, code string) bool {
+	conn := logger.conn
+	if ok, _ := redis.String(conn.Do("SET", redisVerifySentPrefix+phone, 1, "EX", VerifyCodeInterval, "NX")); ok != "OK" {
+		return false
+	}
+
+	key := redisVerifyCodePrefix + purpose + ":" + phone
+	conn.Send("MULTI")
+	conn.Send("DEL", key)
+	conn.Send("HMSET", key, "code", code, "attempts", 0)
+	conn.Send("EXPIRE", key, VerifyCodeExpire)
+	conn.Do("EXEC")
+	return true
+}
+
+// count the codes sent to the phone and requested from the ip today,
+// it returns false if either of them exceeds the daily limit.
+func (logger *RedisLogger) VerifyCodeAllowed(phone, ip string) bool {
+	day := DateString(time.Now())
+	phoneKey := redisVerifyDailyPrefix + day + ":" + phone
+	ipKey := redisVerifyDailyPrefix + day + ":ip:" + ip
+
+	conn := logger.conn
+	conn.Send("MULTI")
+	conn.Send("INCR", phoneKey)
+	conn.Send("EXPIRE", phoneKey, 24*60*60)
+	conn.Send("INCR", ipKey)
+	conn.Send("EXPIRE", ipKey, 24*60*60)
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	phones, _ := redis.Int(values[0], nil)
+	ips, _ := redis.Int(values[2], nil)
+	return phones <= VerifyCodeDaily && ips <= VerifyCodeIpDaily
+}
+
+// check the verification code, the code can be used only once and
+// it's invalidated after VerifyCodeAttempts failed attempts.
+func (logger *RedisLogger) CheckVerifyCode(purpose, phone, code string) bool {
+	conn := logger.conn
+	key := redisVerifyCodePrefix + purpose + ":" + phone
+
+	stored, err := redis.String(conn.Do("HGET", key, "code"))
+	if err != nil || len(stored) == 0 || len(code) == 0 {
+		return false
+	}
+	if stored == code {
+		conn.Do("DEL", key)
+		return true
+	}
+	if attempts, _ := redis.Int(conn.Do("HINCRBY", key, "attempts", 1)); attempts >= VerifyCodeAttempts {
+		conn.Do("DEL", key)
+	}
+	return false
+}
+
+// remove the user from the social graph, groups, topics and leaderboards, and delete the keys of the user.
+func (logger *RedisLogger) ClearUser(userid string) {
+	follows := logger.Friends(RelFollowing, userid)
+	followers := logger.Friends(RelFollower, userid)
+	groups := logger.Groups(userid)
+	topics := logger.Topics(userid)
+
+	conn := logger.conn
+	conn.Send("MULTI")
+	for _, peer := range follows {
+		conn.Send("SREM", redisUserFollowerPrefix+peer, userid)
+	}
+	for _, peer := range followers {
+		conn.Send("SREM", redisUserFollowPrefix+peer, userid)
+	}
+	for _, gid := range groups {
+		conn.Send("SREM", redisGroupPrefix+gid, userid)
+	}
+	for _, topic := range topics {
+		conn.Send("SREM", redisTopicFollowerPrefix+topic, userid)
+	}
+	for _, lb := range []string{redisDisLeaderboard, redisMaxDisLeaderboard, redisDurLeaderboard,
+		redisScorePhysicalLB, redisScoreLiteralLB, redisScoreMentalLB, redisScoreWealthLB, RedisUserCoins} {
+		conn.Send("ZREM", lb, userid)
+	}
+	conn.Send("DEL", redisUserFollowPrefix+userid, redisUserFollowerPrefix+userid,
+		redisUserBlacklistPrefix+userid, redisUserWBImportPrefix+userid, redisUserGroupPrefix+userid,
+		redisUserTimelinePrefix+userid, redisUserTopicPrefix+userid, RedisUserInfoPrefix+userid,
+		redisUserRecommendPrefix+userid, redisUserReasonPrefix+userid, redisUserDismissPrefix+userid,
+		redisUserRecommendTimePrefix+userid, redisUserFollowRequestPrefix+userid, redisUserFollowRequestedPrefix+userid)
+	if _, err := conn.Do("EXEC"); err != nil {
+		log.Println(err)
+	}
+}
+
+// start the challenge of the groups
+func (logger *RedisLogger) AddChallenge(cid string, groups []string) {
+	conn := logger.conn
+	conn.Send("MULTI")
+	for _, gid := range groups {
+		conn.Send("SADD", redisGroupChallengePrefix+gid, cid)
+		conn.Send("ZADD", redisChallengeGroupPrefix+cid, 0, gid)
+	}
+	conn.Do("EXEC")
+}
+
+// end the challenge, the leaderboards are kept.
+func (logger *RedisLogger) EndChallenge(cid string, groups []string) {
+	conn := logger.conn
+	conn.Send("MULTI")
+	for _, gid := range groups {
+		conn.Send("SREM", redisGroupChallengePrefix+gid, cid)
+	}
+	conn.Do("EXEC")
+}
+
+// the running challenges of the group
+func (logger *RedisLogger) GroupChallenges(gid string) []string {
+	ids, _ := redis.Strings(logger.conn.Do("SMEMBERS", redisGroupChallengePrefix+gid))
+	return ids
+}
+
+// add the value to the scores of the member and the groups of the member in the challenge,
+// it returns the new scores of the groups.
+func (logger *RedisLogger) IncrChallengeScore(cid, userid string, groups []string, value int64) []int64 {
+	conn := logger.conn
+	conn.Send("MULTI")
+	conn.Send("ZINCRBY", redisChallengeUserPrefix+cid, value, userid)
+	for _, gid := range groups {
+		conn.Send("ZINCRBY", redisChallengeGroupPrefix+cid, value, gid)
+	}
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	scores := make([]int64, len(groups))
+	for i, _ := range groups {
+		scores[i], _ = redis.Int64(values[i+1], nil)
+	}
+	return scores
+}
+
+// the leaderboard of the members in the challenge
+func (logger *RedisLogger) ChallengeUserLB(cid string, start, stop int) []KV {
+	values, _ := redis.Values(logger.conn.Do("ZREVRANGE", redisChallengeUserPrefix+cid, start, stop, "WITHSCORES"))
+	var s []KV
+	if err := redis.ScanSlice(values, &s); err != nil {
+		log.Println(err)
+		return nil
+	}
+	return s
+}
+
+// the leaderboard of the groups in the challenge
+func (logger *RedisLogger) ChallengeGroupLB(cid string) []KV {
+	values, _ := redis.Values(logger.conn.Do("ZREVRANGE", redisChallengeGroupPrefix+cid, 0, -1, "WITHSCORES"))
+	var s []KV
+	if err := redis.ScanSlice(values, &s); err != nil {
+		log.Println(err)
+		return nil
+	}
+	return s
+}
+
+// count the members of the sets, the most counted first, the user is not included.
+func (logger *RedisLogger) countMembers(userid string, keys []string, limit int) []KV {
+	if len(keys) == 0 {
+		return nil
+	}
+	if len(keys) > recommendFanout {
+		keys = keys[:recommendFanout]
+	}
+
+	tmp := redisRecommendTmpPrefix + userid
+	args := []interface{}{tmp, len(keys)}
+	for _, key := range keys {
+		args = append(args, key)
+	}
+
+	conn := logger.conn
+	conn.Send("MULTI")
+	conn.Send("ZUNIONSTORE", args...)
+	conn.Send("ZREM", tmp, userid)
+	conn.Send("ZREVRANGEBYSCORE", tmp, "+inf", 1, "WITHSCORES", "LIMIT", 0, limit)
+	conn.Send("DEL", tmp)
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	values, _ = redis.Values(values[2], nil)
+	var s []KV
+	if err := redis.ScanSlice(values, &s); err != nil {
+		log.Println(err)
+		return nil
+	}
+	return s
+}
+
+// the users followed by the follows of the user, with the number of the follows
+func (logger *RedisLogger) FollowsOfFollows(userid string, limit int) []KV {
+	var keys []string
+	for _, peer := range logger.Friends(RelFollowing, userid) {
+		keys = append(keys, redisUserFollowPrefix+peer)
+	}
+	return logger.countMembers(userid, keys, limit)
+}
+
+// the members of the groups of the user, with the number of the shared groups
+func (logger *RedisLogger) GroupMates(userid string, limit int) []KV {
+	var keys []string
+	for _, gid := range logger.Groups(userid) {
+		keys = append(keys, redisGroupPrefix+gid)
+	}
+	return logger.countMembers(userid, keys, limit)
+}
+
+// the users whose total distance is within 30% of the user's and whose pace is within 20%
+func (logger *RedisLogger) SimilarRunners(userid string, limit int) []string {
+	dis, dur := logger.RecStats(userid)
+	if dis == 0 || dur == 0 {
+		return nil
+	}
+	ids, _ := redis.Strings(logger.conn.Do("ZRANGEBYSCORE", redisDisLeaderboard,
+		dis*7/10, dis*13/10, "LIMIT", 0, limit*2))
+
+	pace := float64(dur) / float64(dis)
+	var users []string
+	for _, id := range ids {
+		if id == userid {
+			continue
+		}
+		d, t := logger.RecStats(id)
+		if d == 0 || math.Abs(float64(t)/float64(d)-pace) > pace*0.2 {
+			continue
+		}
+		if users = append(users, id); len(users) >= limit {
+			break
+		}
+	}
+	return users
+}
+
+// save the recommendations of the user in order, with the reasons.
+// The empty recommendations are saved too, so they are not computed on every request.
+func (logger *RedisLogger) SetRecommends(userid string, users []string, reasons map[string]string) {
+	expire := RecommendExpire
+	if len(users) == 0 {
+		expire = RecommendEmptyExpire
+	}
+
+	conn := logger.conn
+	conn.Send("MULTI")
+	conn.Send("DEL", redisUserRecommendPrefix+userid, redisUserReasonPrefix+userid)
+	for i, peer := range users {
+		conn.Send("ZADD", redisUserRecommendPrefix+userid, len(users)-i, peer)
+		conn.Send("HSET", redisUserReasonPrefix+userid, peer, reasons[peer])
+	}
+	conn.Send("EXPIRE", redisUserRecommendPrefix+userid, expire)
+	conn.Send("EXPIRE", redisUserReasonPrefix+userid, expire)
+	conn.Send("SETEX", redisUserRecommendTimePrefix+userid, expire, time.Now().Unix())
+	if _, err := conn.Do("EXEC"); err != nil {
+		log.Println(err)
+	}
+}
+
+// the precomputed recommendations of the user in order, with the reasons.
+// It returns false if the recommendations are not computed or expired.
+func (logger *RedisLogger) Recommends(userid string) ([]string, map[string]string, bool) {
+	if computed, _ := redis.Bool(logger.conn.Do("EXISTS", redisUserRecommendTimePrefix+userid)); !computed {
+		return nil, nil, false
+	}
+	users, _ := redis.Strings(logger.conn.Do("ZREVRANGE", redisUserRecommendPrefix+userid, 0, -1))
+	if len(users) == 0 {
+		return nil, nil, true
+	}
+
+	args := []interface{}{redisUserReasonPrefix + userid}
+	for _, peer := range users {
+		args = append(args, peer)
+	}
+	values, _ := redis.Strings(logger.conn.Do("HMGET", args...))
+	reasons := make(map[string]string)
+	for i, _ := range values {
+		reasons[users[i]] = values[i]
+	}
+	return users, reasons, true
+}
+
+// the dismissed user is not recommended again
+func (logger *RedisLogger) DismissRecommend(userid, peer string) {
+	conn := logger.conn
+	conn.Send("MULTI")
+	conn.Send("SADD", redisUserDismissPrefix+userid, peer)
+	conn.Send("ZREM", redisUserRecommendPrefix+userid, peer)
+	conn.Send("HDEL", redisUserReasonPrefix+userid, peer)
+	if _, err := conn.Do("EXEC"); err != nil {
+		log.Println(err)
+	}
+}
+
+func (logger *RedisLogger) Dismissed(userid string) []string {
+	users, _ := redis.Strings(logger.conn.Do("SMEMBERS", redisUserDismissPrefix+userid))
+	return users
+}
+
+// the user requests to follow the private peer, it returns false if the request is pending already.
+func (logger *RedisLogger) AddFollowRequest(userid, peer string) bool {
+	conn := logger.conn
+	conn.Send("MULTI")
+	conn.Send("ZADD", redisUserFollowRequestPrefix+peer, time.Now().Unix(), userid)
+	conn.Send("SADD", redisUserFollowRequestedPrefix+userid, peer)
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	added, _ := redis.Int(values[0], nil)
+	return added > 0
+}
+
+// cancel or reject the follow request, it returns false if there is no such request.
+func (logger *RedisLogger) RemoveFollowRequest(userid, peer string) bool {
+	conn := logger.conn
+	conn.Send("MULTI")
+	conn.Send("ZREM", redisUserFollowRequestPrefix+peer, userid)
+	conn.Send("SREM", redisUserFollowRequestedPrefix+userid, peer)
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	removed, _ := redis.Int(values[0], nil)
+	return removed > 0
+}
+
+// the request is removed and both follow sets are updated in one step, only if the request is pending.
+var acceptFollowScript = redis.NewScript(4, `
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("SREM", KEYS[2], ARGV[2])
+redis.call("SADD", KEYS[3], ARGV[2])
+redis.call("SADD", KEYS[4], ARGV[1])
+return 1
+`)
+
+// the peer accepts the follow request of the user
+func (logger *RedisLogger) AcceptFollowRequest(userid, peer string) bool {
+	accepted, err := redis.Bool(acceptFollowScript.Do(logger.conn,
+		redisUserFollowRequestPrefix+peer, redisUserFollowRequestedPrefix+userid,
+		redisUserFollowPrefix+userid, redisUserFollowerPrefix+peer,
+		userid, peer))
+	if err != nil {
+		log.Println(err)
+	}
+	return accepted
+}
+
+// the users requested to follow the user, the latest first
+func (logger *RedisLogger) FollowRequests(userid string) []string {
+	users, _ := redis.Strings(logger.conn.Do("ZREVRANGE", redisUserFollowRequestPrefix+userid, 0, -1))
+	return users
+}
+
+// whether the user has requested to follow the peer
+func (logger *RedisLogger) FollowRequested(userid, peer string) bool {
+	requested, _ := redis.Bool(logger.conn.Do("SISMEMBER", redisUserFollowRequestedPrefix+userid, peer))
+	return requested
+}
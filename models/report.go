@@ -0,0 +1,282 @@
+// report
+package models
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// the reported targets
+const (
+	ReportArticle = "article"
+	ReportComment = "comment"
+	ReportMessage = "message"
+	ReportUser    = "user"
+)
+
+const (
+	ReportPending   = "pending"
+	ReportResolving = "resolving" // claimed by the moderator, the action is being applied
+	ReportResolved  = "resolved"
+
+	ReportClaimExpire = 10 * time.Minute // the claim of the failed moderator is taken over after it
+)
+
+// the resolutions of the reports
+const (
+	ReportDismiss = "dismiss" // nothing wrong
+	ReportDelete  = "delete"  // delete the content, or reset the profile of the user
+	ReportWarn    = "warn"    // warn the owner
+	ReportBan     = "ban"     // ban the owner
+)
+
+func init() {
+	ensureIndex(reportColl, "status", "-time")
+	ensureIndex(reportColl, "assignee", "status")
+	ensureIndex(reportColl, "type", "target")
+	ensureIndex(reportColl, "reporter", "type", "target")
+	ensureIndex(reportColl, "claim")
+}
+
+// The abusive content reported by the users. The reports are handled in the moderation queue,
+// all the pending reports on the same target are resolved together.
+type Report struct {
+	Id          bson.ObjectId `bson:"_id,omitempty"`
+	Type        string
+	Target      string // the id of the article, comment or message, or the userid
+	Owner       string // the author of the content or the reported user
+	Reporter    string
+	Reason      string
+	Evidence    []string  `bson:",omitempty"` // the texts or the image urls
+	Contents    []Segment `bson:",omitempty"` // the snapshot of the reported content, it's kept if the target is changed
+	Time        time.Time
+	Status      string
+	Assignee    string    `bson:",omitempty"` // the moderator handling the report
+	Resolution  string    `bson:",omitempty"`
+	Resolver    string    `bson:",omitempty"`
+	Note        string    `bson:",omitempty"`
+	ResolveTime time.Time `bson:"resolve_time,omitempty"`
+	ClaimId     string    `bson:"claim,omitempty"` // the claim of the resolving moderator
+	ClaimTime   time.Time `bson:"claim_time,omitempty"`
+}
+
+func ValidReportType(typ string) bool {
+	switch typ {
+	case ReportArticle, ReportComment, ReportMessage, ReportUser:
+		return true
+	}
+	return false
+}
+
+func ValidResolution(resolution string) bool {
+	switch resolution {
+	case ReportDismiss, ReportDelete, ReportWarn, ReportBan:
+		return true
+	}
+	return false
+}
+
+func (this *Report) FindById(id string) (bool, error) {
+	if !bson.IsObjectIdHex(id) {
+		return false, nil
+	}
+	if err := findOne(reportColl, bson.M{"_id": bson.ObjectIdHex(id)}, nil, this); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, errors.NewError(errors.DbError, err.Error())
+	}
+	return true, nil
+}
+
+// Save the report, the user can only report the same target once before it's resolved.
+// It returns false if the report is pending already.
+func (this *Report) Save() (bool, error) {
+	query := bson.M{
+		"reporter": this.Reporter,
+		"type":     this.Type,
+		"target":   this.Target,
+		"status":   ReportPending,
+	}
+	if n, err := count(reportColl, query); err != nil {
+		return false, errors.NewError(errors.DbError, err.Error())
+	} else if n > 0 {
+		return false, nil
+	}
+
+	this.Id = bson.NewObjectId()
+	this.Time = time.Now()
+	this.Status = ReportPending
+	if err := save(reportColl, this, true); err != nil {
+		return false, errors.NewError(errors.DbError, err.Error())
+	}
+	// the images are kept until the report is resolved
+	changeFileRefs(nil, this.fileRefs())
+	return true, nil
+}
+
+func (this *Report) fileRefs() []string {
+	return append(imageRefs(this.Contents), this.Evidence...)
+}
+
+// Assign the pending report to the moderator, the assignee is cleared if it's empty.
+func (this *Report) Assign(assignee string) error {
+	selector := bson.M{
+		"_id":    this.Id,
+		"status": ReportPending,
+	}
+	change := bson.M{
+		"$set": bson.M{
+			"assignee": assignee,
+		},
+	}
+	if len(assignee) == 0 {
+		change = bson.M{
+			"$unset": bson.M{
+				"assignee": 1,
+			},
+		}
+	}
+	if err := update(reportColl, selector, change, true); err != nil {
+		if err == mgo.ErrNotFound {
+			return errors.NewError(errors.NotExistsError, "举报已处理")
+		}
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	this.Assignee = assignee
+	return nil
+}
+
+// Claim all the pending reports on the target of the report for the moderator, so the action on the target
+// is applied only once. The claimed reports are resolved by ResolveReports after the action is applied,
+// or put back to the queue by UnclaimReports if it fails.
+func (this *Report) Claim(resolver string) ([]Report, error) {
+	now := time.Now()
+	claim := bson.NewObjectId().Hex()
+	selector := bson.M{
+		"type":   this.Type,
+		"target": this.Target,
+		"$or": []bson.M{
+			{"status": ReportPending},
+			{"status": ReportResolving, "claim_time": bson.M{"$lt": now.Add(-ReportClaimExpire)}},
+		},
+	}
+	change := bson.M{
+		"$set": bson.M{
+			"status":     ReportResolving,
+			"resolver":   resolver,
+			"claim":      claim,
+			"claim_time": now,
+		},
+	}
+	if _, err := updateAll(reportColl, selector, change, true); err != nil {
+		return nil, errors.NewError(errors.DbError, err.Error())
+	}
+
+	var reports []Report
+	if err := search(reportColl, bson.M{"claim": claim}, nil, 0, 0, nil, nil, &reports); err != nil {
+		return nil, errors.NewError(errors.DbError, err.Error())
+	}
+	if len(reports) == 0 {
+		return nil, errors.NewError(errors.NotExistsError, "举报已处理")
+	}
+	return reports, nil
+}
+
+func reportIds(reports []Report) []bson.ObjectId {
+	ids := make([]bson.ObjectId, len(reports))
+	for i, _ := range reports {
+		ids[i] = reports[i].Id
+	}
+	return ids
+}
+
+// Resolve the claimed reports.
+func ResolveReports(reports []Report, resolution, note string) error {
+	if len(reports) == 0 {
+		return nil
+	}
+	selector := bson.M{
+		"_id":    bson.M{"$in": reportIds(reports)},
+		"status": ReportResolving,
+		"claim":  reports[0].ClaimId,
+	}
+	now := time.Now()
+	change := bson.M{
+		"$set": bson.M{
+			"status":       ReportResolved,
+			"resolution":   resolution,
+			"note":         note,
+			"resolve_time": now,
+		},
+		"$unset": bson.M{
+			"claim":      1,
+			"claim_time": 1,
+		},
+	}
+	if _, err := updateAll(reportColl, selector, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+
+	for i, _ := range reports {
+		changeFileRefs(reports[i].fileRefs(), nil)
+		reports[i].Status = ReportResolved
+		reports[i].Resolution = resolution
+		reports[i].Note = note
+		reports[i].ResolveTime = now
+		reports[i].ClaimId = ""
+		reports[i].ClaimTime = time.Time{}
+	}
+	return nil
+}
+
+// Put the claimed reports back to the queue.
+func UnclaimReports(reports []Report) error {
+	if len(reports) == 0 {
+		return nil
+	}
+	selector := bson.M{
+		"_id":    bson.M{"$in": reportIds(reports)},
+		"status": ReportResolving,
+		"claim":  reports[0].ClaimId,
+	}
+	change := bson.M{
+		"$set": bson.M{
+			"status": ReportPending,
+		},
+		"$unset": bson.M{
+			"resolver":   1,
+			"claim":      1,
+			"claim_time": 1,
+		},
+	}
+	if _, err := updateAll(reportColl, selector, change, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+// the reports in the moderation queue, the empty filters are ignored, the oldest first.
+func Reports(status, typ, assignee, owner, reporter string, pageIndex, pageCount int) (total int, reports []Report, err error) {
+	query := bson.M{}
+	if len(status) > 0 {
+		query["status"] = status
+	}
+	if len(typ) > 0 {
+		query["type"] = typ
+	}
+	if len(assignee) > 0 {
+		query["assignee"] = assignee
+	}
+	if len(owner) > 0 {
+		query["owner"] = owner
+	}
+	if len(reporter) > 0 {
+		query["reporter"] = reporter
+	}
+
+	err = search(reportColl, query, nil, pageIndex*pageCount, pageCount, []string{"time"}, &total, &reports)
+	return
+}
@@ -0,0 +1,106 @@
+// revision
+package models
+
+import (
+	"github.com/ginuerzh/sports/errors"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+func init() {
+	ensureIndex(revisionColl, "article", "-_id")
+}
+
+type Revision struct {
+	Id      bson.ObjectId `bson:"_id,omitempty"`
+	Article string
+	Editor  string
+	Time    time.Time
+	Removed []Segment `bson:",omitempty"`
+	Added   []Segment `bson:",omitempty"`
+}
+
+func (this *Revision) Save() error {
+	this.Id = bson.NewObjectId()
+	if err := save(revisionColl, this, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
+
+// revisions of the article, newest first.
+func Revisions(articleId string, paging *Paging) (int, []Revision, error) {
+	var revisions []Revision
+	total := 0
+
+	query := bson.M{"article": articleId}
+	pageUp := false
+	sortFields := []string{"-_id"}
+	if bson.IsObjectIdHex(paging.First) {
+		pageUp = true
+		sortFields = []string{"_id"}
+		query["_id"] = bson.M{"$gt": bson.ObjectIdHex(paging.First)}
+	} else if bson.IsObjectIdHex(paging.Last) {
+		query["_id"] = bson.M{"$lt": bson.ObjectIdHex(paging.Last)}
+	}
+	if paging.Count <= 0 {
+		paging.Count = DefaultPageSize
+	}
+
+	if err := search(revisionColl, query, nil, 0, paging.Count, sortFields, &total, &revisions); err != nil {
+		return total, nil, err
+	}
+
+	paging.First = ""
+	paging.Last = ""
+	paging.Count = 0
+	if len(revisions) > 0 {
+		if pageUp {
+			for i := 0; i < len(revisions)/2; i++ {
+				revisions[i], revisions[len(revisions)-i-1] = revisions[len(revisions)-i-1], revisions[i]
+			}
+		}
+		paging.First = revisions[0].Id.Hex()
+		paging.Last = revisions[len(revisions)-1].Id.Hex()
+		paging.Count = total
+	}
+
+	return total, revisions, nil
+}
+
+// segments removed from old and added in new, based on the longest common subsequence.
+func DiffSegments(old, new []Segment) (removed, added []Segment) {
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(old) && j < len(new) {
+		if old[i] == new[j] {
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			removed = append(removed, old[i])
+			i++
+		} else {
+			added = append(added, new[j])
+			j++
+		}
+	}
+	removed = append(removed, old[i:]...)
+	added = append(added, new[j:]...)
+
+	return
+}
@@ -3,6 +3,7 @@ package models
 
 import (
 	"github.com/ginuerzh/sports/errors"
+	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
 	"time"
 )
@@ -35,3 +36,32 @@ func (r *Rule) Save() error {
 	}
 	return nil
 }
+
+const challengeAwardsRule = "challenge_awards"
+
+// The awards of the group challenges set by the admins, it's kept in the rules.
+type ChallengeAwards struct {
+	Id       string `bson:"_id" json:"-"`
+	Winner   Props  `json:"winner_awards"`   // for the contributing members of the winner group
+	Finisher Props  `json:"finisher_awards"` // for the contributing members of the groups reached the target
+}
+
+// It returns false if the awards are not set.
+func (this *ChallengeAwards) Find() (bool, error) {
+	if err := findOne(ruleColl, bson.M{"_id": challengeAwardsRule}, nil, this); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, errors.NewError(errors.DbError, err.Error())
+	}
+	return true, nil
+}
+
+// The awards apply to the challenges created later.
+func (this *ChallengeAwards) Save() error {
+	this.Id = challengeAwardsRule
+	if _, err := upsert(ruleColl, bson.M{"_id": challengeAwardsRule}, this, true); err != nil {
+		return errors.NewError(errors.DbError, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+// session
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/garyburd/redigo/redis"
+	"github.com/ginuerzh/sports/errors"
+	"io"
+	"log"
+	"time"
+)
+
+const (
+	AccessTokenExpire  = 2 * 60 * 60       // 2h
+	RefreshTokenExpire = 30 * 24 * 60 * 60 // 1mon
+)
+
+type LoginSession struct {
+	Id           string `redis:"-"`
+	Userid       string `redis:"userid"`
+	Device       string `redis:"device"`
+	Ip           string `redis:"ip"`
+	LoginTime    int64  `redis:"login"`
+	LastSeen     int64  `redis:"seen"`
+	AccessToken  string `redis:"access"`
+	RefreshToken string `redis:"refresh"`
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		log.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (logger *RedisLogger) session(sid string) *LoginSession {
+	v, err := redis.Values(logger.conn.Do("HGETALL", redisSessionPrefix+sid))
+	if err != nil || len(v) == 0 {
+		return nil
+	}
+	s := &LoginSession{Id: sid}
+	if err := redis.ScanStruct(v, s); err != nil {
+		log.Println(err)
+		return nil
+	}
+	return s
+}
+
+// save the session with the new token pair, the old tokens are invalidated.
+func (logger *RedisLogger) issueTokens(s *LoginSession) {
+	conn := logger.conn
+	conn.Send("MULTI")
+	if len(s.AccessToken) > 0 {
+		conn.Send("DEL", redisUserOnlineUserPrefix+s.AccessToken, redisTokenSessionPrefix+s.AccessToken)
+	}
+	if len(s.RefreshToken) > 0 {
+		conn.Send("DEL", redisRefreshTokenPrefix+s.RefreshToken)
+	}
+
+	s.AccessToken = randomToken()
+	s.RefreshToken = randomToken()
+	s.LastSeen = time.Now().Unix()
+
+	conn.Send("SETEX", redisUserOnlineUserPrefix+s.AccessToken, AccessTokenExpire, s.Userid)
+	conn.Send("SETEX", redisTokenSessionPrefix+s.AccessToken, AccessTokenExpire, s.Id)
+	conn.Send("SETEX", redisRefreshTokenPrefix+s.RefreshToken, RefreshTokenExpire, s.Id)
+	conn.Send("HMSET", redis.Args{}.Add(redisSessionPrefix+s.Id).AddFlat(s)...)
+	conn.Send("EXPIRE", redisSessionPrefix+s.Id, RefreshTokenExpire)
+	conn.Send("ZADD", redisUserSessionsPrefix+s.Userid, s.LastSeen, s.Id)
+	if _, err := conn.Do("EXEC"); err != nil {
+		log.Println(err)
+	}
+}
+
+// start a new session of the user on the device
+func (logger *RedisLogger) NewSession(userid, device, ip string) *LoginSession {
+	s := &LoginSession{
+		Id:        randomToken(),
+		Userid:    userid,
+		Device:    device,
+		Ip:        ip,
+		LoginTime: time.Now().Unix(),
+	}
+	logger.issueTokens(s)
+	return s
+}
+
+// exchange the refresh token for a new token pair, the refresh token can only be used once.
+func (logger *RedisLogger) RefreshSession(refreshToken, ip string) (*LoginSession, error) {
+	sid, _ := redis.String(logger.conn.Do("GET", redisRefreshTokenPrefix+refreshToken))
+	s := logger.session(sid)
+	if s == nil || s.RefreshToken != refreshToken {
+		return nil, errors.NewError(errors.AccessError)
+	}
+	if len(ip) > 0 {
+		s.Ip = ip
+	}
+	logger.issueTokens(s)
+	return s, nil
+}
+
+// the session id of the access token
+func (logger *RedisLogger) TokenSession(accessToken string) string {
+	sid, _ := redis.String(logger.conn.Do("GET", redisTokenSessionPrefix+accessToken))
+	return sid
+}
+
+// update the last seen time and address of the session
+func (logger *RedisLogger) TouchSession(accessToken, ip string) {
+	sid := logger.TokenSession(accessToken)
+	if len(sid) == 0 {
+		return
+	}
+	userid, _ := redis.String(logger.conn.Do("HGET", redisSessionPrefix+sid, "userid"))
+	if len(userid) == 0 {
+		return
+	}
+
+	now := time.Now().Unix()
+	conn := logger.conn
+	conn.Send("MULTI")
+	conn.Send("HMSET", redisSessionPrefix+sid, "seen", now, "ip", ip)
+	conn.Send("ZADD", redisUserSessionsPrefix+userid, now, sid)
+	conn.Do("EXEC")
+}
+
+// the sessions of the user, the recent first
+func (logger *RedisLogger) Sessions(userid string) []LoginSession {
+	ids, _ := redis.Strings(logger.conn.Do("ZREVRANGE", redisUserSessionsPrefix+userid, 0, -1))
+
+	var sessions []LoginSession
+	var expired []interface{}
+	for _, id := range ids {
+		if s := logger.session(id); s != nil {
+			sessions = append(sessions, *s)
+		} else {
+			expired = append(expired, id)
+		}
+	}
+	if len(expired) > 0 {
+		logger.conn.Do("ZREM", redis.Args{}.Add(redisUserSessionsPrefix+userid).Add(expired...)...)
+	}
+	return sessions
+}
+
+// revoke the session of the user, the websocket connection of the session is closed.
+func (logger *RedisLogger) RevokeSession(userid, sid string) bool {
+	s := logger.session(sid)
+	if s == nil || s.Userid != userid {
+		return false
+	}
+
+	conn := logger.conn
+	conn.Send("MULTI")
+	conn.Send("DEL", redisUserOnlineUserPrefix+s.AccessToken, redisTokenSessionPrefix+s.AccessToken,
+		redisRefreshTokenPrefix+s.RefreshToken, redisSessionPrefix+sid)
+	conn.Send("ZREM", redisUserSessionsPrefix+userid, sid)
+	conn.Do("EXEC")
+
+	event := &Event{
+		Type: EventRevoke,
+		Time: time.Now().Unix(),
+		Data: EventData{
+			Type: EventRevoke,
+			Id:   sid,
+			To:   userid,
+		},
+	}
+	logger.PubMsg(EventRevoke, userid, event.Bytes())
+	return true
+}
+
+// revoke all the sessions of the user except the session 'except'
+func (logger *RedisLogger) RevokeSessions(userid, except string) int {
+	n := 0
+	for _, s := range logger.Sessions(userid) {
+		if s.Id != except && logger.RevokeSession(userid, s.Id) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,78 @@
+// oauth
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnsupported  = errors.New("oauth: unsupported by the provider")
+	ErrInvalidToken = errors.New("oauth: invalid token")
+	ErrNoProvider   = errors.New("oauth: unknown provider")
+)
+
+// Profile is the user info of the third-party account.
+type Profile struct {
+	Uid      string
+	Nickname string
+	Gender   string
+	Avatar   string
+	Url      string
+	Location string
+	About    string
+}
+
+// Provider is the third-party login service.
+type Provider interface {
+	Name() string
+	// verify the access token, it returns the uid that the token is issued to.
+	Verify(uid, token string) (string, error)
+	Profile(uid, token string) (*Profile, error)
+	// the mutual friends of the user, ErrUnsupported if the provider doesn't open it.
+	Friends(uid, token string) ([]Profile, error)
+}
+
+var (
+	providers = make(map[string]Provider)
+	mu        sync.RWMutex
+
+	client = &http.Client{Timeout: 30 * time.Second}
+)
+
+func Register(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[p.Name()] = p
+}
+
+func Get(name string) (Provider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if p, ok := providers[name]; ok {
+		return p, nil
+	}
+	return nil, ErrNoProvider
+}
+
+func getJson(url string, result interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func postJson(url string, body string, result interface{}) error {
+	resp, err := client.Post(url, "application/x-www-form-urlencoded", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(result)
+}
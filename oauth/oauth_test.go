@@ -0,0 +1,183 @@
+package oauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	testToken = "token"
+	testAppId = "app"
+)
+
+// fakeServer serves the apis of the providers, only the testToken is valid.
+func fakeServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	reply := func(w http.ResponseWriter, v interface{}) {
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// weibo
+	mux.HandleFunc("/oauth2/get_token_info", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.FormValue("access_token") != testToken {
+			reply(w, map[string]interface{}{"error": "invalid_access_token", "error_code": 21332})
+			return
+		}
+		reply(w, map[string]interface{}{"uid": 1001, "appkey": testAppId, "expire_in": 3600})
+	})
+	mux.HandleFunc("/2/users/show.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("access_token") != testToken || r.FormValue("uid") != "1001" {
+			reply(w, map[string]interface{}{"error": "invalid_access_token", "error_code": 21332})
+			return
+		}
+		reply(w, map[string]interface{}{"id": 1001, "screen_name": "weibo", "gender": "m", "location": "北京"})
+	})
+	mux.HandleFunc("/2/friendships/friends/bilateral.json", func(w http.ResponseWriter, r *http.Request) {
+		users := []map[string]interface{}{}
+		switch r.FormValue("page") {
+		case "1":
+			users = append(users, map[string]interface{}{"id": 1002}, map[string]interface{}{"id": 1003})
+		case "2":
+			users = append(users, map[string]interface{}{"id": 1004})
+		}
+		reply(w, map[string]interface{}{"users": users, "total_number": 3})
+	})
+
+	// qq
+	mux.HandleFunc("/oauth2.0/me", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("access_token") != testToken {
+			reply(w, map[string]interface{}{"error": 100016})
+			return
+		}
+		reply(w, map[string]interface{}{"client_id": testAppId, "openid": "qqopenid"})
+	})
+	mux.HandleFunc("/user/get_user_info", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("access_token") != testToken || r.FormValue("oauth_consumer_key") != testAppId {
+			reply(w, map[string]interface{}{"ret": 1002, "msg": "invalid token"})
+			return
+		}
+		reply(w, map[string]interface{}{"nickname": "qq", "gender": "女", "province": "广东", "city": "深圳"})
+	})
+
+	// weixin
+	mux.HandleFunc("/sns/auth", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("access_token") != testToken || r.FormValue("openid") != "wxopenid" {
+			reply(w, map[string]interface{}{"errcode": 40003, "errmsg": "invalid openid"})
+			return
+		}
+		reply(w, map[string]interface{}{"errcode": 0, "errmsg": "ok"})
+	})
+	mux.HandleFunc("/sns/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("access_token") != testToken {
+			reply(w, map[string]interface{}{"errcode": 40001, "errmsg": "invalid credential"})
+			return
+		}
+		reply(w, map[string]interface{}{"openid": r.FormValue("openid"), "nickname": "weixin", "sex": 1, "country": "中国"})
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestWeibo(t *testing.T) {
+	s := fakeServer(t)
+	defer s.Close()
+
+	w := NewWeibo(testAppId)
+	w.ApiUrl = s.URL
+
+	if uid, err := w.Verify("", testToken); err != nil || uid != "1001" {
+		t.Errorf("Verify = %q, %v, want 1001", uid, err)
+	}
+	if _, err := w.Verify("1002", testToken); err != ErrInvalidToken {
+		t.Errorf("Verify of another uid = %v, want ErrInvalidToken", err)
+	}
+	if _, err := w.Verify("", "bad"); err == nil {
+		t.Error("Verify of an invalid token succeeded")
+	}
+	other := NewWeibo("other")
+	other.ApiUrl = s.URL
+	if _, err := other.Verify("", testToken); err != ErrInvalidToken {
+		t.Errorf("Verify of the token of another app = %v, want ErrInvalidToken", err)
+	}
+
+	p, err := w.Profile("1001", testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Uid != "1001" || p.Nickname != "weibo" || p.Location != "北京" {
+		t.Errorf("Profile = %+v", p)
+	}
+
+	friends, err := w.Friends("1001", testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(friends) != 3 || friends[2].Uid != "1004" {
+		t.Errorf("Friends = %+v, want 3 friends of 2 pages", friends)
+	}
+}
+
+func TestQQ(t *testing.T) {
+	s := fakeServer(t)
+	defer s.Close()
+
+	q := NewQQ(testAppId)
+	q.ApiUrl = s.URL
+
+	if openid, err := q.Verify("", testToken); err != nil || openid != "qqopenid" {
+		t.Errorf("Verify = %q, %v, want qqopenid", openid, err)
+	}
+	if _, err := q.Verify("other", testToken); err != ErrInvalidToken {
+		t.Errorf("Verify of another openid = %v, want ErrInvalidToken", err)
+	}
+	if _, err := q.Verify("", "bad"); err != ErrInvalidToken {
+		t.Errorf("Verify of an invalid token = %v, want ErrInvalidToken", err)
+	}
+
+	p, err := q.Profile("qqopenid", testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Uid != "qqopenid" || p.Gender != "f" || p.Location != "广东 深圳" {
+		t.Errorf("Profile = %+v", p)
+	}
+	if _, err := q.Profile("qqopenid", "bad"); err == nil {
+		t.Error("Profile of an invalid token succeeded")
+	}
+	if _, err := q.Friends("qqopenid", testToken); err != ErrUnsupported {
+		t.Errorf("Friends = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestWeixin(t *testing.T) {
+	s := fakeServer(t)
+	defer s.Close()
+
+	w := NewWeixin()
+	w.ApiUrl = s.URL
+
+	if openid, err := w.Verify("wxopenid", testToken); err != nil || openid != "wxopenid" {
+		t.Errorf("Verify = %q, %v, want wxopenid", openid, err)
+	}
+	if _, err := w.Verify("", testToken); err != ErrInvalidToken {
+		t.Errorf("Verify without openid = %v, want ErrInvalidToken", err)
+	}
+	if _, err := w.Verify("other", testToken); err != ErrInvalidToken {
+		t.Errorf("Verify of another openid = %v, want ErrInvalidToken", err)
+	}
+
+	p, err := w.Profile("wxopenid", testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Uid != "wxopenid" || p.Gender != "m" || p.Location != "中国" {
+		t.Errorf("Profile = %+v", p)
+	}
+	if _, err := w.Profile("wxopenid", "bad"); err == nil {
+		t.Error("Profile of an invalid token succeeded")
+	}
+}
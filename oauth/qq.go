@@ -0,0 +1,87 @@
+// qq
+package oauth
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const QQApiUrl = "https://graph.qq.com"
+
+// QQ identifies the user by openid of the app.
+type QQ struct {
+	AppId  string
+	ApiUrl string
+}
+
+func NewQQ(appId string) *QQ {
+	return &QQ{AppId: appId, ApiUrl: QQApiUrl}
+}
+
+func (q *QQ) Name() string {
+	return "qq"
+}
+
+func (q *QQ) Verify(openid, token string) (string, error) {
+	result := &struct {
+		ClientId string `json:"client_id"`
+		OpenId   string `json:"openid"`
+		Error    int    `json:"error"`
+	}{}
+
+	v := url.Values{}
+	v.Set("access_token", token)
+	v.Set("fmt", "json")
+	if err := getJson(q.ApiUrl+"/oauth2.0/me?"+v.Encode(), result); err != nil {
+		return "", err
+	}
+	if result.Error != 0 || len(result.OpenId) == 0 ||
+		(len(openid) > 0 && openid != result.OpenId) ||
+		(len(q.AppId) > 0 && result.ClientId != q.AppId) {
+		return "", ErrInvalidToken
+	}
+	return result.OpenId, nil
+}
+
+func (q *QQ) Profile(openid, token string) (*Profile, error) {
+	result := &struct {
+		Ret      int    `json:"ret"`
+		Msg      string `json:"msg"`
+		Nickname string `json:"nickname"`
+		Gender   string `json:"gender"`
+		Province string `json:"province"`
+		City     string `json:"city"`
+		Avatar   string `json:"figureurl_qq_2"`
+	}{}
+
+	v := url.Values{}
+	v.Set("access_token", token)
+	v.Set("oauth_consumer_key", q.AppId)
+	v.Set("openid", openid)
+	if err := getJson(q.ApiUrl+"/user/get_user_info?"+v.Encode(), result); err != nil {
+		return nil, err
+	}
+	if result.Ret != 0 {
+		return nil, errors.New("qq: " + strconv.Itoa(result.Ret) + " " + result.Msg)
+	}
+
+	p := &Profile{
+		Uid:      openid,
+		Nickname: result.Nickname,
+		Avatar:   result.Avatar,
+		Location: strings.TrimSpace(result.Province + " " + result.City),
+	}
+	switch result.Gender {
+	case "男":
+		p.Gender = "m"
+	case "女":
+		p.Gender = "f"
+	}
+	return p, nil
+}
+
+func (q *QQ) Friends(openid, token string) ([]Profile, error) {
+	return nil, ErrUnsupported
+}
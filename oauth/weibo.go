@@ -0,0 +1,133 @@
+// weibo
+package oauth
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+const WeiboApiUrl = "https://api.weibo.com"
+
+type weiboError struct {
+	Request   string `json:"request"`
+	ErrorDesc string `json:"error"`
+	ErrCode   int    `json:"error_code"`
+}
+
+func (e weiboError) err() error {
+	if e.ErrCode > 0 || len(e.ErrorDesc) > 0 {
+		return errors.New("weibo: " + strconv.Itoa(e.ErrCode) + " " + e.ErrorDesc)
+	}
+	return nil
+}
+
+type weiboUser struct {
+	Id          uint64 `json:"id"`
+	ScreenName  string `json:"screen_name"`
+	Gender      string `json:"gender"`
+	Url         string `json:"url"`
+	Avatar      string `json:"avatar_large"`
+	Location    string `json:"location"`
+	Description string `json:"description"`
+}
+
+func (u *weiboUser) profile() Profile {
+	return Profile{
+		Uid:      strconv.FormatUint(u.Id, 10),
+		Nickname: u.ScreenName,
+		Gender:   u.Gender,
+		Avatar:   u.Avatar,
+		Url:      u.Url,
+		Location: u.Location,
+		About:    u.Description,
+	}
+}
+
+type Weibo struct {
+	AppKey string
+	ApiUrl string
+}
+
+func NewWeibo(appKey string) *Weibo {
+	return &Weibo{AppKey: appKey, ApiUrl: WeiboApiUrl}
+}
+
+func (w *Weibo) Name() string {
+	return "weibo"
+}
+
+func (w *Weibo) Verify(uid, token string) (string, error) {
+	result := &struct {
+		Uid    uint64 `json:"uid"`
+		AppKey string `json:"appkey"`
+		Expire int64  `json:"expire_in"`
+		weiboError
+	}{}
+
+	v := url.Values{}
+	v.Set("access_token", token)
+	if err := postJson(w.ApiUrl+"/oauth2/get_token_info", v.Encode(), result); err != nil {
+		return "", err
+	}
+	if err := result.err(); err != nil {
+		return "", err
+	}
+	verified := strconv.FormatUint(result.Uid, 10)
+	if result.Expire <= 0 || (len(uid) > 0 && uid != verified) ||
+		(len(w.AppKey) > 0 && result.AppKey != w.AppKey) {
+		return "", ErrInvalidToken
+	}
+	return verified, nil
+}
+
+func (w *Weibo) Profile(uid, token string) (*Profile, error) {
+	result := &struct {
+		weiboUser
+		weiboError
+	}{}
+
+	v := url.Values{}
+	v.Set("uid", uid)
+	v.Set("access_token", token)
+	if err := getJson(w.ApiUrl+"/2/users/show.json?"+v.Encode(), result); err != nil {
+		return nil, err
+	}
+	if err := result.err(); err != nil {
+		return nil, err
+	}
+	p := result.weiboUser.profile()
+	return &p, nil
+}
+
+func (w *Weibo) Friends(uid, token string) ([]Profile, error) {
+	result := &struct {
+		Users []weiboUser `json:"users"`
+		Total int         `json:"total_number"`
+		weiboError
+	}{}
+
+	v := url.Values{}
+	v.Set("source", w.AppKey)
+	v.Set("access_token", token)
+	v.Set("uid", uid)
+
+	var friends []Profile
+	for page := 1; ; page++ {
+		v.Set("page", strconv.Itoa(page))
+		result.Users = nil
+		if err := getJson(w.ApiUrl+"/2/friendships/friends/bilateral.json?"+v.Encode(), result); err != nil {
+			return friends, err
+		}
+		if err := result.err(); err != nil {
+			return friends, err
+		}
+		for i, _ := range result.Users {
+			friends = append(friends, result.Users[i].profile())
+		}
+		if len(result.Users) == 0 || len(friends) >= result.Total {
+			break
+		}
+	}
+	return friends, nil
+}
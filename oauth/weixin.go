@@ -0,0 +1,95 @@
+// weixin
+package oauth
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const WeixinApiUrl = "https://api.weixin.qq.com"
+
+type weixinError struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (e weixinError) err() error {
+	if e.ErrCode != 0 {
+		return errors.New("weixin: " + strconv.Itoa(e.ErrCode) + " " + e.ErrMsg)
+	}
+	return nil
+}
+
+// Weixin identifies the user by openid.
+type Weixin struct {
+	ApiUrl string
+}
+
+func NewWeixin() *Weixin {
+	return &Weixin{ApiUrl: WeixinApiUrl}
+}
+
+func (w *Weixin) Name() string {
+	return "weixin"
+}
+
+func (w *Weixin) Verify(openid, token string) (string, error) {
+	if len(openid) == 0 {
+		return "", ErrInvalidToken
+	}
+	result := &weixinError{}
+
+	v := url.Values{}
+	v.Set("access_token", token)
+	v.Set("openid", openid)
+	if err := getJson(w.ApiUrl+"/sns/auth?"+v.Encode(), result); err != nil {
+		return "", err
+	}
+	if result.err() != nil {
+		return "", ErrInvalidToken
+	}
+	return openid, nil
+}
+
+func (w *Weixin) Profile(openid, token string) (*Profile, error) {
+	result := &struct {
+		OpenId   string `json:"openid"`
+		Nickname string `json:"nickname"`
+		Sex      int    `json:"sex"`
+		Province string `json:"province"`
+		City     string `json:"city"`
+		Country  string `json:"country"`
+		Avatar   string `json:"headimgurl"`
+		weixinError
+	}{}
+
+	v := url.Values{}
+	v.Set("access_token", token)
+	v.Set("openid", openid)
+	if err := getJson(w.ApiUrl+"/sns/userinfo?"+v.Encode(), result); err != nil {
+		return nil, err
+	}
+	if err := result.err(); err != nil {
+		return nil, err
+	}
+
+	p := &Profile{
+		Uid:      result.OpenId,
+		Nickname: result.Nickname,
+		Avatar:   result.Avatar,
+		Location: strings.TrimSpace(result.Country + " " + result.Province + " " + result.City),
+	}
+	switch result.Sex {
+	case 1:
+		p.Gender = "m"
+	case 2:
+		p.Gender = "f"
+	}
+	return p, nil
+}
+
+func (w *Weixin) Friends(openid, token string) ([]Profile, error) {
+	return nil, ErrUnsupported
+}
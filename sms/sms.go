@@ -0,0 +1,70 @@
+// sms
+package sms
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// Sender sends the text message to the phone.
+type Sender interface {
+	Send(phone, text string) error
+}
+
+// ConsoleSender writes the messages to the log instead of sending them, for development.
+type ConsoleSender struct{}
+
+func (ConsoleSender) Send(phone, text string) error {
+	log.Println("sms to", phone+":", text)
+	return nil
+}
+
+// YunpianSender sends the messages by the yunpian sms api.
+type YunpianSender struct {
+	ApiKey string
+	Url    string // the api url, the default is used if empty
+}
+
+const yunpianUrl = "https://sms.yunpian.com/v2/sms/single_send.json"
+
+func (s YunpianSender) Send(phone, text string) error {
+	api := s.Url
+	if len(api) == 0 {
+		api = yunpianUrl
+	}
+	resp, err := http.PostForm(api, url.Values{"apikey": {s.ApiKey}, "mobile": {phone}, "text": {text}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || result.Code != 0 {
+		return fmt.Errorf("sms: %d %s", result.Code, result.Msg)
+	}
+	return nil
+}
+
+// New returns the sender of the kind: yunpian or console.
+func New(kind, apiKey string) (Sender, error) {
+	switch kind {
+	case "yunpian":
+		if len(apiKey) == 0 {
+			return nil, errors.New("sms: the api key of yunpian is required")
+		}
+		return YunpianSender{ApiKey: apiKey}, nil
+	case "console":
+		return ConsoleSender{}, nil
+	}
+	return nil, errors.New("sms: unknown sender " + kind)
+}
@@ -0,0 +1,85 @@
+// local
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps the blobs in a directory, for development and testing.
+// The blobs are served by the download api at the base url.
+type LocalStore struct {
+	dir     string
+	baseUrl string
+}
+
+func NewLocalStore(dir, baseUrl string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{dir: dir, baseUrl: baseUrl}, nil
+}
+
+func (s *LocalStore) path(id string) string {
+	return filepath.Join(s.dir, id[:2], id)
+}
+
+func (s *LocalStore) Put(name, contentType string, r io.Reader) (string, int64, error) {
+	id := newId()
+	path := s.path(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, err
+	}
+
+	// write to a temp file first, so the readers never see a partial blob.
+	f, err := ioutil.TempFile(filepath.Dir(path), ".upload")
+	if err != nil {
+		return "", 0, err
+	}
+	n, err := io.Copy(f, r)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", 0, err
+	}
+	return id, n, nil
+}
+
+func (s *LocalStore) Get(id string) (io.ReadCloser, error) {
+	if !validId(id) {
+		return nil, ErrNotFound
+	}
+	f, err := os.Open(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *LocalStore) Delete(id string) error {
+	if !validId(id) {
+		return ErrNotFound
+	}
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *LocalStore) URL(id string) (string, error) {
+	return strings.TrimRight(s.baseUrl, "/") + "/1/file/get?fileid=" + id, nil
+}
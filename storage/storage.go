@@ -0,0 +1,74 @@
+// storage
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+const (
+	KindWeedfs = "weedfs"
+	KindLocal  = "local"
+	KindS3     = "s3"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores the file data, a blob is identified by the id returned by Put.
+type BlobStore interface {
+	Put(name, contentType string, r io.Reader) (id string, size int64, err error)
+	// The returned reader is an io.ReadSeeker if the store supports random access.
+	Get(id string) (io.ReadCloser, error)
+	Delete(id string) error
+	URL(id string) (string, error)
+}
+
+type Config struct {
+	Kind string
+
+	// weed-fs master
+	WeedfsAddr string
+
+	// local filesystem
+	Dir     string
+	BaseUrl string // url prefix of the download api
+
+	// s3 compatible
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PublicUrl string // optional, such as a cdn
+}
+
+func New(config Config) (BlobStore, error) {
+	switch config.Kind {
+	case KindWeedfs, "":
+		return NewWeedfsStore(config.WeedfsAddr), nil
+	case KindLocal:
+		return NewLocalStore(config.Dir, config.BaseUrl)
+	case KindS3:
+		return NewS3Store(config.Endpoint, config.Region, config.Bucket,
+			config.AccessKey, config.SecretKey, config.PublicUrl)
+	}
+	return nil, errors.New("unknown storage: " + config.Kind)
+}
+
+func newId() string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func validId(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,45 @@
+// weedfs
+package storage
+
+import (
+	"gopkg.in/ginuerzh/weedo.v0"
+	"io"
+	"net/http"
+)
+
+type WeedfsStore struct {
+	client *weedo.Client
+}
+
+func NewWeedfsStore(master string) *WeedfsStore {
+	return &WeedfsStore{client: weedo.NewClient(master)}
+}
+
+func (s *WeedfsStore) Put(name, contentType string, r io.Reader) (string, int64, error) {
+	return s.client.Master().Submit(name, contentType, r)
+}
+
+func (s *WeedfsStore) Get(id string) (io.ReadCloser, error) {
+	_, url, err := s.client.GetUrl(id)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	return resp.Body, nil
+}
+
+func (s *WeedfsStore) Delete(id string) error {
+	return s.client.Delete(id, 1)
+}
+
+func (s *WeedfsStore) URL(id string) (string, error) {
+	url, _, err := s.client.GetUrl(id)
+	return url, err
+}